@@ -0,0 +1,151 @@
+package gosync
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rkcloudchain/gosync/syncpb"
+)
+
+// BatchBlockRequester is a BlockRequester able to request many ranges in a single call.
+// Patch uses DoRequests when the requester implements it.
+type BatchBlockRequester interface {
+	BlockRequester
+
+	// DoRequests returns the data of every range, in order.
+	DoRequests(ranges []*syncpb.MissingBlockSpan) ([][]byte, error)
+}
+
+// ContextBatchBlockRequester is a BatchBlockRequester whose batches can be cancelled.
+type ContextBatchBlockRequester interface {
+	BatchBlockRequester
+	DoRequestsContext(ctx context.Context, ranges []*syncpb.MissingBlockSpan) ([][]byte, error)
+}
+
+// batchWrapper is implemented by the batch requesters wrapping another requester,
+// which only request batches as such when the other one does.
+type batchWrapper interface {
+	batching() bool
+}
+
+// supportsBatches reports whether requester requests batches as such.
+func supportsBatches(requester BlockRequester) bool {
+	if _, ok := requester.(BatchBlockRequester); !ok {
+		return false
+	}
+	if w, ok := requester.(batchWrapper); ok {
+		return w.batching()
+	}
+	return true
+}
+
+// spanBatch is a range of consecutive missing spans of a plan, requested together.
+type spanBatch struct {
+	start int
+	end   int
+}
+
+// batches groups the blocks requested by a single call. Every block is alone in its
+// batch unless the requester supports batches.
+func (r *rsync) batches(blocks []*syncpb.MissingBlockSpan) []spanBatch {
+	batching := supportsBatches(r.reference)
+
+	batches := make([]spanBatch, 0, len(blocks))
+	for i, block := range blocks {
+		if batching && i > 0 && len(block.Data) == 0 {
+			last := &batches[len(batches)-1]
+			if first := blocks[last.start]; len(first.Data) == 0 && last.end-last.start < r.batchSpans {
+				var length int64
+				for _, b := range blocks[last.start:i] {
+					length += spanLength(b)
+				}
+				if length+spanLength(block) <= r.prefetchMemory {
+					last.end++
+					continue
+				}
+			}
+		}
+
+		batches = append(batches, spanBatch{start: i, end: i + 1})
+	}
+
+	return batches
+}
+
+// requestBatch returns the verified data of blocks, requested in a single call when possible.
+// A block whose data is invalid is requested again on its own when retries are allowed.
+func (r *rsync) requestBatch(ctx context.Context, blocks []*syncpb.MissingBlockSpan, algorithm syncpb.StrongHashAlgorithm) ([][]byte, error) {
+	requester, ok := r.reference.(BatchBlockRequester)
+	if !ok || !supportsBatches(r.reference) || len(blocks) == 1 {
+		data := make([][]byte, len(blocks))
+		for i, block := range blocks {
+			var err error
+			if data[i], err = r.requestMissingBlock(ctx, block, algorithm); err != nil {
+				return nil, err
+			}
+		}
+		return data, nil
+	}
+
+	ranges := r.coalesce(blocks)
+	responses, err := doRequests(ctx, requester, ranges)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read from reference file: %v", err)
+	}
+	if len(responses) != len(ranges) {
+		return nil, fmt.Errorf("Invalid batch response: got %d ranges, expected %d", len(responses), len(ranges))
+	}
+
+	data := make([][]byte, len(blocks))
+	j := 0
+	for i, block := range blocks {
+		for ranges[j].EndOffset < block.EndOffset {
+			j++
+		}
+
+		response := responses[j]
+		start := block.StartOffset - ranges[j].StartOffset
+		end := start + spanLength(block)
+		if end > int64(len(response)) {
+			end = int64(len(response))
+		}
+		if start < end {
+			data[i] = response[start:end]
+		}
+
+		if err := r.checkMissingBlock(block, algorithm, data[i]); err != nil {
+			if _, ok := err.(*ErrSignatureMismatch); ok || r.requestRetries == 0 {
+				return nil, err
+			}
+
+			if data[i], err = r.requestMissingBlock(ctx, block, algorithm); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return data, nil
+}
+
+// coalesce returns the ranges covering blocks, merging the blocks separated by at most
+// coalesceGap bytes into ranges no larger than the request block size.
+func (r *rsync) coalesce(blocks []*syncpb.MissingBlockSpan) []*syncpb.MissingBlockSpan {
+	ranges := make([]*syncpb.MissingBlockSpan, 0, len(blocks))
+
+	for _, block := range blocks {
+		if len(ranges) > 0 {
+			last := ranges[len(ranges)-1]
+			gap := block.StartOffset - last.EndOffset - 1
+			length := block.EndOffset - last.StartOffset + 1
+
+			if gap <= r.coalesceGap && (r.requestBlockSize == 0 || length <= r.requestBlockSize) {
+				last.EndOffset = block.EndOffset
+				continue
+			}
+		}
+
+		ranges = append(ranges, &syncpb.MissingBlockSpan{StartOffset: block.StartOffset, EndOffset: block.EndOffset})
+	}
+
+	return ranges
+}
@@ -0,0 +1,114 @@
+package gosync
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/rkcloudchain/gosync/syncpb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPatchBatchRequests(t *testing.T) {
+	local, reference, patcher := newTestPlan(t)
+
+	requester := &fakeRequester{BytesRequester: reference}
+	r, err := New(&Config{BlockSize: 256, MaxBatchSpans: 8, Requester: requester})
+	require.NoError(t, err)
+
+	output := bytes.NewBuffer(nil)
+	require.NoError(t, r.Patch(bytes.NewReader(local), patcher, output))
+	assert.Equal(t, reference, output.Bytes())
+	assert.Empty(t, requester.ranges)
+
+	ranges := 0
+	for _, batch := range requester.batches {
+		assert.True(t, len(batch) <= 8)
+		ranges += len(batch)
+	}
+	assert.Equal(t, len(patcher.Missing), ranges)
+	assert.Equal(t, (len(patcher.Missing)+7)/8, len(requester.batches))
+}
+
+func TestPatchBatchCoalescing(t *testing.T) {
+	local, reference, patcher := newTestPlan(t)
+
+	requester := &fakeRequester{BytesRequester: reference}
+	r, err := New(&Config{BlockSize: 256, PrefetchRequests: 4, CoalesceGap: 1024, Requester: requester})
+	require.NoError(t, err)
+
+	output := bytes.NewBuffer(nil)
+	require.NoError(t, r.Patch(bytes.NewReader(local), patcher, output))
+	assert.Equal(t, reference, output.Bytes())
+
+	ranges := 0
+	for _, batch := range requester.batches {
+		ranges += len(batch)
+	}
+	assert.True(t, ranges < len(patcher.Missing))
+}
+
+func TestCoalesce(t *testing.T) {
+	r := &rsync{coalesceGap: 4, requestBlockSize: 20}
+	ranges := r.coalesce([]*syncpb.MissingBlockSpan{
+		{StartOffset: 0, EndOffset: 4},
+		{StartOffset: 9, EndOffset: 12},
+		{StartOffset: 18, EndOffset: 19},
+		{StartOffset: 21, EndOffset: 30},
+		{StartOffset: 31, EndOffset: 31},
+	})
+	assert.Equal(t, []*syncpb.MissingBlockSpan{
+		{StartOffset: 0, EndOffset: 12},
+		{StartOffset: 18, EndOffset: 31},
+	}, ranges)
+}
+
+func TestPatchBatchInvalidData(t *testing.T) {
+	local, reference, patcher := newTestPlan(t)
+
+	requester := &fakeRequester{BytesRequester: reference, corrupt: -1}
+	r, err := New(&Config{BlockSize: 256, Requester: requester})
+	require.NoError(t, err)
+
+	err = r.Patch(bytes.NewReader(local), patcher, bytes.NewBuffer(nil))
+	require.IsType(t, &ErrChecksumMismatch{}, err)
+	assert.Equal(t, patcher.Missing[0].StartOffset, err.(*ErrChecksumMismatch).Offset)
+
+	// The ranges failing in a batch are requested again on their own.
+	requester = &fakeRequester{BytesRequester: reference, corrupt: -1, batchesOnly: true}
+	r, err = New(&Config{BlockSize: 256, MaxRequestRetries: 1, Requester: requester})
+	require.NoError(t, err)
+
+	output := bytes.NewBuffer(nil)
+	require.NoError(t, r.Patch(bytes.NewReader(local), patcher, output))
+	assert.Equal(t, reference, output.Bytes())
+	assert.Equal(t, len(patcher.Missing), len(requester.ranges))
+}
+
+func TestInvalidBatchConfig(t *testing.T) {
+	_, err := New(&Config{MaxBatchSpans: -1})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Invalid batch spans")
+
+	_, err = New(&Config{CoalesceGap: -1})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Invalid coalesce gap")
+}
+
+func TestPatchMalformedMissingSpans(t *testing.T) {
+	reference := []byte("0123456789abcdef")
+	r, err := New(&Config{BlockSize: 4, PrefetchRequests: 4, CoalesceGap: 8, Requester: &fakeRequester{BytesRequester: reference}})
+	require.NoError(t, err)
+
+	for _, missing := range [][]*syncpb.MissingBlockSpan{
+		{{StartOffset: 8, EndOffset: 11}, {StartOffset: 0, EndOffset: 3}},
+		{{StartOffset: 0, EndOffset: 7}, {StartOffset: 4, EndOffset: 11}},
+		{{StartOffset: 4, EndOffset: 3}},
+		{{StartOffset: -4, EndOffset: 3}},
+	} {
+		patcher := &syncpb.PatcherBlockSpan{Missing: missing}
+		err := r.Patch(bytes.NewReader(nil), patcher, bytes.NewBuffer(nil))
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "Invalid missing span")
+	}
+}
@@ -0,0 +1,678 @@
+package gosync
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rkcloudchain/gosync/logging"
+	"github.com/rkcloudchain/gosync/syncpb"
+)
+
+const (
+	defaultCachePageSize = 64 * 1024
+	defaultCacheMemory   = 64 * 1024 * 1024
+	defaultCacheDisk     = 1024 * 1024 * 1024
+)
+
+// CacheConfig contains the parameters of a CachingRequester.
+type CacheConfig struct {
+	// Source identifies the content of the wrapped requester, such as its URL and version.
+	// Pages are cached under keys derived from it, so it must change with the content.
+	Source string
+
+	// SizeFunc returns the size of the content. It is required.
+	SizeFunc func() (int64, error)
+
+	// PageSize is the unit in which ranges are fetched and cached, 64KiB by default.
+	PageSize int64
+
+	// MaxMemory bounds the size of the pages cached in memory, 64MiB by default.
+	MaxMemory int64
+
+	// Dir is the directory of the on-disk cache, which is disabled when empty.
+	// Pages stored there by a previous requester of the same source are reused.
+	Dir string
+
+	// MaxDisk bounds the size of the pages cached in Dir, 1GiB by default. The bound covers the
+	// pages of all the sources in Dir, which are evicted together, and the smallest one applies
+	// when requesters of a process share Dir. Requesters of other processes are not accounted
+	// for until the directory is loaded again.
+	MaxDisk int64
+}
+
+func (c *CacheConfig) validate() error {
+	if c.SizeFunc == nil {
+		return errors.New("File size function must be specified")
+	}
+
+	if c.PageSize < 0 {
+		return fmt.Errorf("Invalid cache page size %d", c.PageSize)
+	}
+
+	if c.PageSize == 0 {
+		c.PageSize = defaultCachePageSize
+	}
+
+	if c.MaxMemory < 0 {
+		return fmt.Errorf("Invalid cache memory %d", c.MaxMemory)
+	}
+
+	if c.MaxMemory == 0 {
+		c.MaxMemory = defaultCacheMemory
+	}
+
+	if c.MaxDisk < 0 {
+		return fmt.Errorf("Invalid cache disk size %d", c.MaxDisk)
+	}
+
+	if c.MaxDisk == 0 {
+		c.MaxDisk = defaultCacheDisk
+	}
+
+	return nil
+}
+
+// CacheStats counts the pages served by a CachingRequester.
+type CacheStats struct {
+	MemoryHits int64
+	DiskHits   int64
+	Misses     int64
+
+	// SharedHits counts the pages awaited from a fetch already in flight for another request.
+	SharedHits int64
+
+	// FetchedBytes is the amount of data requested from the wrapped requester.
+	FetchedBytes int64
+}
+
+// CachingRequester is a BlockRequester caching the ranges of another requester in memory
+// and optionally on disk. Ranges are split into pages, so overlapping requests share the
+// pages they have in common. It is safe for concurrent use when the wrapped requester is,
+// and concurrent requests of the same missing pages share a single fetch. Batches of ranges
+// are served from the cache, and their missing pages fetched in a single batch.
+type CachingRequester struct {
+	requester BlockRequester
+	config    CacheConfig
+	size      int64
+	prefix    string
+
+	mu       sync.Mutex
+	memory   *pageLRU
+	disk     *diskCache
+	inflight map[int64]*pageCall
+	stats    CacheStats
+}
+
+// pageCall is the fetch of a page in flight. Once done is closed, data holds the page,
+// or nil when the fetch failed.
+type pageCall struct {
+	done chan struct{}
+	data []byte
+}
+
+// NewCachingRequester returns a CachingRequester around requester given configuration.
+func NewCachingRequester(requester BlockRequester, c *CacheConfig) (*CachingRequester, error) {
+	config := *c
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	size, err := config.SizeFunc()
+	if err != nil {
+		return nil, err
+	}
+
+	source := sha256.Sum256([]byte(config.Source))
+	r := &CachingRequester{
+		requester: requester,
+		config:    config,
+		size:      size,
+		prefix:    fmt.Sprintf("%s-%d-", hex.EncodeToString(source[:16]), config.PageSize),
+		memory:    newPageLRU(config.MaxMemory),
+		inflight:  make(map[int64]*pageCall),
+	}
+
+	if config.Dir != "" {
+		if r.disk, err = openDiskCache(config.Dir, config.MaxDisk); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// Stats returns the number of pages served so far from each level of the cache.
+func (r *CachingRequester) Stats() CacheStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stats
+}
+
+// DoRequest returns the bytes from startOffset to endOffset, inclusive.
+func (r *CachingRequester) DoRequest(startOffset int64, endOffset int64) ([]byte, error) {
+	return r.DoRequestContext(context.Background(), startOffset, endOffset)
+}
+
+// DoRequestContext is DoRequest with a context cancelling the requests of missing pages.
+func (r *CachingRequester) DoRequestContext(ctx context.Context, startOffset int64, endOffset int64) ([]byte, error) {
+	data, err := r.DoRequestsContext(ctx, []*syncpb.MissingBlockSpan{{StartOffset: startOffset, EndOffset: endOffset}})
+	if err != nil {
+		return nil, err
+	}
+	return data[0], nil
+}
+
+// DoRequests returns the bytes of every range, in order.
+func (r *CachingRequester) DoRequests(ranges []*syncpb.MissingBlockSpan) ([][]byte, error) {
+	return r.DoRequestsContext(context.Background(), ranges)
+}
+
+// DoRequestsContext is DoRequests with a context cancelling the requests of missing pages.
+// The pages missing from all the ranges are requested in a single batch when the wrapped
+// requester is a BatchBlockRequester.
+func (r *CachingRequester) DoRequestsContext(ctx context.Context, ranges []*syncpb.MissingBlockSpan) ([][]byte, error) {
+	var indices []int64
+	for _, rng := range ranges {
+		if err := checkRange(rng.StartOffset, rng.EndOffset, r.size); err != nil {
+			return nil, err
+		}
+		for index := rng.StartOffset / r.config.PageSize; index <= rng.EndOffset/r.config.PageSize; index++ {
+			indices = append(indices, index)
+		}
+	}
+
+	// Every page is looked up once, even when ranges share it.
+	sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+	unique := indices[:0]
+	for i, index := range indices {
+		if i == 0 || index != indices[i-1] {
+			unique = append(unique, index)
+		}
+	}
+	indices = unique
+
+	pages := make([][]byte, len(indices))
+	for i, index := range indices {
+		pages[i] = r.cached(index)
+	}
+
+	owned, waiting := r.claim(indices, pages)
+	err := r.fetchMissing(ctx, indices, pages, func(i int) bool { return owned[i] != nil })
+	r.release(indices, pages, owned)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, call := range waiting {
+		if call == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-call.done:
+			pages[i] = call.data
+		}
+	}
+
+	// The pages whose shared fetch failed are requested again.
+	if err := r.fetchMissing(ctx, indices, pages, func(int) bool { return true }); err != nil {
+		return nil, err
+	}
+
+	data := make([][]byte, len(ranges))
+	for i, rng := range ranges {
+		first := sort.Search(len(indices), func(j int) bool { return indices[j] >= rng.StartOffset/r.config.PageSize })
+		data[i] = make([]byte, 0, rng.EndOffset-rng.StartOffset+1)
+		for j := first; j < len(indices) && indices[j]*r.config.PageSize <= rng.EndOffset; j++ {
+			pageStart := indices[j] * r.config.PageSize
+			from, to := int64(0), int64(len(pages[j]))
+			if rng.StartOffset > pageStart {
+				from = rng.StartOffset - pageStart
+			}
+			if rng.EndOffset < pageStart+to-1 {
+				to = rng.EndOffset - pageStart + 1
+			}
+			data[i] = append(data[i], pages[j][from:to]...)
+		}
+	}
+
+	return data, nil
+}
+
+// batching reports whether batches are requested as such from the wrapped requester.
+func (r *CachingRequester) batching() bool {
+	return supportsBatches(r.requester)
+}
+
+// claim registers the fetches of the missing pages of the given indices. It returns the
+// calls this request must complete, and the calls of pages already in flight for another one.
+func (r *CachingRequester) claim(indices []int64, pages [][]byte) (owned, waiting []*pageCall) {
+	owned = make([]*pageCall, len(pages))
+	waiting = make([]*pageCall, len(pages))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, index := range indices {
+		if pages[i] != nil {
+			continue
+		}
+
+		if page, ok := r.memory.get(pageKey{index: index}); ok {
+			// Stored since it was looked up.
+			r.stats.MemoryHits++
+			pages[i] = page.data
+		} else if call, ok := r.inflight[index]; ok {
+			r.stats.SharedHits++
+			waiting[i] = call
+		} else {
+			owned[i] = &pageCall{done: make(chan struct{})}
+			r.inflight[index] = owned[i]
+		}
+	}
+
+	return owned, waiting
+}
+
+// release completes the calls of the pages claimed by a request, fetched or not.
+func (r *CachingRequester) release(indices []int64, pages [][]byte, owned []*pageCall) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, call := range owned {
+		if call == nil {
+			continue
+		}
+
+		call.data = pages[i]
+		delete(r.inflight, indices[i])
+		close(call.done)
+	}
+}
+
+// pageRun is a range of consecutive missing pages, requested together.
+type pageRun struct {
+	start int
+	end   int
+}
+
+// fetchMissing fetches the missing pages of the given sorted indices for which fetchable is true.
+// Contiguous missing pages are requested together, and all of them in a single batch when possible.
+func (r *CachingRequester) fetchMissing(ctx context.Context, indices []int64, pages [][]byte, fetchable func(int) bool) error {
+	var runs []pageRun
+	for i := 0; i < len(pages); i++ {
+		if pages[i] != nil || !fetchable(i) {
+			continue
+		}
+
+		j := i + 1
+		for j < len(pages) && pages[j] == nil && fetchable(j) && indices[j] == indices[j-1]+1 {
+			j++
+		}
+
+		runs = append(runs, pageRun{start: i, end: j})
+		i = j - 1
+	}
+
+	ranges := make([]*syncpb.MissingBlockSpan, len(runs))
+	for i, run := range runs {
+		startOffset := indices[run.start] * r.config.PageSize
+		endOffset := (indices[run.end-1]+1)*r.config.PageSize - 1
+		if endOffset >= r.size {
+			endOffset = r.size - 1
+		}
+		ranges[i] = &syncpb.MissingBlockSpan{StartOffset: startOffset, EndOffset: endOffset}
+	}
+
+	if requester, ok := r.requester.(BatchBlockRequester); ok && len(runs) > 1 && supportsBatches(r.requester) {
+		responses, err := doRequests(ctx, requester, ranges)
+		if err != nil {
+			return err
+		}
+		if len(responses) != len(ranges) {
+			return fmt.Errorf("Invalid batch response: got %d ranges, expected %d", len(responses), len(ranges))
+		}
+
+		for i, run := range runs {
+			if err := r.storeRun(indices[run.start], ranges[i], responses[i], pages[run.start:run.end]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for i, run := range runs {
+		data, err := doRequest(ctx, r.requester, ranges[i].StartOffset, ranges[i].EndOffset)
+		if err != nil {
+			return err
+		}
+		if err := r.storeRun(indices[run.start], ranges[i], data, pages[run.start:run.end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cached returns a page from memory or disk, or nil when it is missing.
+func (r *CachingRequester) cached(index int64) []byte {
+	r.mu.Lock()
+	if page, ok := r.memory.get(pageKey{index: index}); ok {
+		r.stats.MemoryHits++
+		r.mu.Unlock()
+		return page.data
+	}
+	r.mu.Unlock()
+
+	key := pageKey{prefix: r.prefix, index: index}
+	if r.disk == nil || !r.disk.get(key) {
+		return nil
+	}
+
+	data, err := os.ReadFile(r.disk.path(key))
+	if err == nil && int64(len(data)) != r.pageLength(index) {
+		err = fmt.Errorf("Invalid cached page length %d", len(data))
+	}
+	if err != nil {
+		logging.Warningf("Could not read cached page %d: %v", index, err)
+		r.disk.remove(key)
+		return nil
+	}
+
+	r.mu.Lock()
+	r.stats.DiskHits++
+	r.memory.add(&cachedPage{key: pageKey{index: index}, length: int64(len(data)), data: data})
+	r.mu.Unlock()
+	return data
+}
+
+// storeRun splits the data of the consecutive pages starting at index into pages, and caches them.
+func (r *CachingRequester) storeRun(index int64, rng *syncpb.MissingBlockSpan, data []byte, pages [][]byte) error {
+	if int64(len(data)) != rng.EndOffset-rng.StartOffset+1 {
+		return fmt.Errorf("Invalid response for range %d-%d: got %d bytes, expected %d", rng.StartOffset, rng.EndOffset, len(data), rng.EndOffset-rng.StartOffset+1)
+	}
+
+	for i := range pages {
+		offset := int64(i) * r.config.PageSize
+		pages[i] = data[offset : offset+r.pageLength(index+int64(i))]
+		if len(pages) > 1 {
+			// Pages are evicted separately, they must not retain the whole response.
+			pages[i] = append([]byte(nil), pages[i]...)
+		}
+		r.store(index+int64(i), pages[i])
+	}
+
+	r.mu.Lock()
+	r.stats.Misses += int64(len(pages))
+	r.stats.FetchedBytes += int64(len(data))
+	r.mu.Unlock()
+	return nil
+}
+
+// store caches a page in memory and, when enabled, on disk.
+func (r *CachingRequester) store(index int64, data []byte) {
+	r.mu.Lock()
+	r.memory.add(&cachedPage{key: pageKey{index: index}, length: int64(len(data)), data: data})
+	r.mu.Unlock()
+
+	if r.disk == nil {
+		return
+	}
+
+	key := pageKey{prefix: r.prefix, index: index}
+	if err := r.writePage(key, data); err != nil {
+		logging.Warningf("Could not cache page %d on disk: %v", index, err)
+		return
+	}
+	r.disk.add(key, int64(len(data)))
+}
+
+// writePage writes a page to a temporary file renamed into place, so that readers never see partial pages.
+func (r *CachingRequester) writePage(key pageKey, data []byte) error {
+	f, err := os.CreateTemp(r.disk.dir, r.prefix+"tmp-")
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), r.disk.path(key))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// pageLength returns the length of a page, which is shorter at the end of the content.
+func (r *CachingRequester) pageLength(index int64) int64 {
+	length := r.size - index*r.config.PageSize
+	if length > r.config.PageSize {
+		length = r.config.PageSize
+	}
+	if length < 0 {
+		length = 0
+	}
+	return length
+}
+
+// pageKey identifies a page. The pages of a directory are told apart by the prefix of their source.
+type pageKey struct {
+	prefix string
+	index  int64
+}
+
+type cachedPage struct {
+	key    pageKey
+	length int64
+	data   []byte
+}
+
+// pageLRU holds pages up to a total length, evicting the least recently used ones.
+type pageLRU struct {
+	max   int64
+	used  int64
+	order *list.List
+	pages map[pageKey]*list.Element
+}
+
+func newPageLRU(max int64) *pageLRU {
+	return &pageLRU{max: max, order: list.New(), pages: make(map[pageKey]*list.Element)}
+}
+
+func (l *pageLRU) get(key pageKey) (*cachedPage, bool) {
+	e, ok := l.pages[key]
+	if !ok {
+		return nil, false
+	}
+
+	l.order.MoveToFront(e)
+	return e.Value.(*cachedPage), true
+}
+
+// add inserts or replaces a page, and returns the pages evicted to make room for it.
+// A page larger than the limit is not kept.
+func (l *pageLRU) add(page *cachedPage) []*cachedPage {
+	l.remove(page.key)
+
+	l.pages[page.key] = l.order.PushFront(page)
+	l.used += page.length
+	return l.evict()
+}
+
+// resize changes the limit, and returns the pages evicted to fit it.
+func (l *pageLRU) resize(max int64) []*cachedPage {
+	l.max = max
+	return l.evict()
+}
+
+func (l *pageLRU) evict() []*cachedPage {
+	var evicted []*cachedPage
+	for l.used > l.max {
+		e := l.order.Back()
+		p := e.Value.(*cachedPage)
+		l.order.Remove(e)
+		delete(l.pages, p.key)
+		l.used -= p.length
+		evicted = append(evicted, p)
+	}
+	return evicted
+}
+
+func (l *pageLRU) remove(key pageKey) {
+	if e, ok := l.pages[key]; ok {
+		l.order.Remove(e)
+		delete(l.pages, key)
+		l.used -= e.Value.(*cachedPage).length
+	}
+}
+
+var (
+	diskCachesMu sync.Mutex
+	diskCaches   = make(map[string]*diskCache)
+)
+
+// diskCache indexes the pages of a cache directory. It is shared by the requesters of a
+// process using the directory, so that their pages are bounded together.
+type diskCache struct {
+	dir string
+
+	mu    sync.Mutex
+	pages *pageLRU
+}
+
+// openDiskCache returns the index of dir, loading the pages already there on first use.
+// The index is bounded by the smallest max it is opened with.
+func openDiskCache(dir string, max int64) (*diskCache, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	diskCachesMu.Lock()
+	defer diskCachesMu.Unlock()
+
+	if d, ok := diskCaches[dir]; ok {
+		d.mu.Lock()
+		var evicted []*cachedPage
+		if max < d.pages.max {
+			evicted = d.pages.resize(max)
+		}
+		d.mu.Unlock()
+
+		d.removeFiles(evicted)
+		return d, nil
+	}
+
+	d := &diskCache{dir: dir, pages: newPageLRU(max)}
+	if err := d.load(); err != nil {
+		return nil, err
+	}
+	diskCaches[dir] = d
+	return d, nil
+}
+
+// load indexes the pages of all the sources already in the directory, oldest first.
+// Other files, such as the temporary files of pages being written, are left alone.
+func (d *diskCache) load() error {
+	if err := os.MkdirAll(d.dir, 0755); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return err
+	}
+
+	// Files removed since the listing are skipped.
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil {
+			infos = append(infos, info)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ModTime().Before(infos[j].ModTime()) })
+
+	for _, info := range infos {
+		if key, ok := parsePageName(info.Name()); ok && info.Mode().IsRegular() {
+			d.add(key, info.Size())
+		}
+	}
+
+	return nil
+}
+
+// parsePageName returns the key of a page file, named after the prefix of its source and its index.
+func parsePageName(name string) (pageKey, bool) {
+	i := strings.LastIndexByte(name, '-')
+	if i < 0 {
+		return pageKey{}, false
+	}
+
+	index, err := strconv.ParseInt(name[i+1:], 10, 64)
+	if err != nil || index < 0 {
+		return pageKey{}, false
+	}
+
+	parts := strings.Split(name[:i], "-")
+	if len(parts) != 2 || len(parts[0]) != 32 {
+		return pageKey{}, false
+	}
+	if _, err := hex.DecodeString(parts[0]); err != nil {
+		return pageKey{}, false
+	}
+	if _, err := strconv.ParseInt(parts[1], 10, 64); err != nil {
+		return pageKey{}, false
+	}
+
+	return pageKey{prefix: name[:i+1], index: index}, true
+}
+
+func (d *diskCache) path(key pageKey) string {
+	return filepath.Join(d.dir, key.prefix+strconv.FormatInt(key.index, 10))
+}
+
+func (d *diskCache) get(key pageKey) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.pages.get(key)
+	return ok
+}
+
+// add indexes a page written to the directory, and removes the pages evicted for it.
+func (d *diskCache) add(key pageKey, length int64) {
+	d.mu.Lock()
+	evicted := d.pages.add(&cachedPage{key: key, length: length})
+	d.mu.Unlock()
+
+	d.removeFiles(evicted)
+}
+
+// remove drops a page from the index and the directory.
+func (d *diskCache) remove(key pageKey) {
+	d.mu.Lock()
+	d.pages.remove(key)
+	d.mu.Unlock()
+
+	os.Remove(d.path(key))
+}
+
+func (d *diskCache) removeFiles(pages []*cachedPage) {
+	for _, p := range pages {
+		os.Remove(d.path(p.key))
+	}
+}
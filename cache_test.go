@@ -0,0 +1,324 @@
+package gosync
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rkcloudchain/gosync/syncpb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	_ ContextBlockRequester      = (*CachingRequester)(nil)
+	_ ContextBatchBlockRequester = (*CachingRequester)(nil)
+)
+
+func TestCachingRequesterPages(t *testing.T) {
+	content := randomBytes(5, 100)
+	requester := &fakeRequester{BytesRequester: content}
+
+	r, err := NewCachingRequester(singleRequests(requester), &CacheConfig{SizeFunc: requester.Size, PageSize: 16})
+	require.NoError(t, err)
+
+	data, err := r.DoRequest(0, 39)
+	require.NoError(t, err)
+	assert.Equal(t, content[0:40], data)
+	assert.Equal(t, [][2]int64{{0, 47}}, requester.ranges)
+
+	data, err = r.DoRequest(20, 30)
+	require.NoError(t, err)
+	assert.Equal(t, content[20:31], data)
+	assert.Len(t, requester.ranges, 1)
+
+	// Only the pages missing from a partially cached range are requested.
+	data, err = r.DoRequest(40, 99)
+	require.NoError(t, err)
+	assert.Equal(t, content[40:100], data)
+	assert.Equal(t, [][2]int64{{0, 47}, {48, 99}}, requester.ranges)
+
+	assert.Equal(t, CacheStats{MemoryHits: 2, Misses: 7, FetchedBytes: 100}, r.Stats())
+
+	_, err = r.DoRequest(90, 100)
+	assert.EqualError(t, err, "Invalid range 90-100 of 100 bytes")
+}
+
+func TestCachingRequesterMemoryBound(t *testing.T) {
+	content := randomBytes(5, 64)
+	requester := &fakeRequester{BytesRequester: content}
+
+	r, err := NewCachingRequester(singleRequests(requester), &CacheConfig{SizeFunc: requester.Size, PageSize: 16, MaxMemory: 32})
+	require.NoError(t, err)
+
+	for _, offset := range []int64{0, 16, 32, 0} {
+		data, err := r.DoRequest(offset, offset+15)
+		require.NoError(t, err)
+		assert.Equal(t, content[offset:offset+16], data)
+	}
+
+	assert.Equal(t, CacheStats{Misses: 4, FetchedBytes: 64}, r.Stats())
+	assert.Equal(t, int64(32), r.memory.used)
+}
+
+func TestCachingRequesterDisk(t *testing.T) {
+	content := randomBytes(5, 100)
+	dir, err := os.MkdirTemp("", "gosync")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	config := &CacheConfig{Source: "reference@1", SizeFunc: BytesRequester(content).Size, PageSize: 16, MaxMemory: 16, Dir: dir}
+
+	requester := &fakeRequester{BytesRequester: content}
+	r, err := NewCachingRequester(singleRequests(requester), config)
+	require.NoError(t, err)
+
+	data, err := r.DoRequest(10, 99)
+	require.NoError(t, err)
+	assert.Equal(t, content[10:100], data)
+
+	// The pages evicted from memory are read back from disk.
+	data, err = r.DoRequest(0, 20)
+	require.NoError(t, err)
+	assert.Equal(t, content[0:21], data)
+	assert.Len(t, requester.ranges, 1)
+	assert.Equal(t, int64(2), r.Stats().DiskHits)
+
+	// Another requester of the same source reuses the disk cache.
+	requester = &fakeRequester{BytesRequester: content}
+	r, err = NewCachingRequester(singleRequests(requester), config)
+	require.NoError(t, err)
+
+	data, err = r.DoRequest(0, 99)
+	require.NoError(t, err)
+	assert.Equal(t, content, data)
+	assert.Empty(t, requester.ranges)
+	assert.Equal(t, CacheStats{DiskHits: 7}, r.Stats())
+
+	// A different source does not.
+	config.Source = "reference@2"
+	r, err = NewCachingRequester(singleRequests(requester), config)
+	require.NoError(t, err)
+
+	_, err = r.DoRequest(0, 99)
+	require.NoError(t, err)
+	assert.Len(t, requester.ranges, 1)
+}
+
+func TestCachingRequesterDiskBound(t *testing.T) {
+	content := randomBytes(5, 100)
+	dir, err := os.MkdirTemp("", "gosync")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	config := &CacheConfig{SizeFunc: BytesRequester(content).Size, PageSize: 16, MaxMemory: 16, Dir: dir, MaxDisk: 48}
+	r, err := NewCachingRequester(BytesRequester(content), config)
+	require.NoError(t, err)
+
+	_, err = r.DoRequest(0, 99)
+	require.NoError(t, err)
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, files, 3)
+
+	// A corrupted page is fetched again.
+	for _, f := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, f.Name()), []byte("garbage"), 0644))
+	}
+	requester := &fakeRequester{BytesRequester: content}
+	r, err = NewCachingRequester(singleRequests(requester), config)
+	require.NoError(t, err)
+
+	data, err := r.DoRequest(60, 99)
+	require.NoError(t, err)
+	assert.Equal(t, content[60:100], data)
+	assert.Equal(t, [][2]int64{{48, 99}}, requester.ranges)
+}
+
+// dirSize returns the total size of the files of dir.
+func dirSize(t *testing.T, dir string) int64 {
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+
+	var size int64
+	for _, f := range files {
+		info, err := f.Info()
+		require.NoError(t, err)
+		size += info.Size()
+	}
+	return size
+}
+
+func TestCachingRequesterSharedDir(t *testing.T) {
+	content := randomBytes(5, 100)
+	dir, err := os.MkdirTemp("", "gosync")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// The pages of all the sources are bounded together.
+	for _, source := range []string{"a", "b", "c"} {
+		config := &CacheConfig{Source: source, SizeFunc: BytesRequester(content).Size, PageSize: 16, Dir: dir, MaxDisk: 64}
+		r, err := NewCachingRequester(BytesRequester(content), config)
+		require.NoError(t, err)
+
+		_, err = r.DoRequest(0, 99)
+		require.NoError(t, err)
+		assert.True(t, dirSize(t, dir) <= 64, "%d bytes cached", dirSize(t, dir))
+	}
+
+	// The smallest bound of the requesters sharing the directory applies.
+	config := &CacheConfig{Source: "d", SizeFunc: BytesRequester(content).Size, PageSize: 16, Dir: dir, MaxDisk: 32}
+	_, err = NewCachingRequester(BytesRequester(content), config)
+	require.NoError(t, err)
+	assert.True(t, dirSize(t, dir) <= 32, "%d bytes cached", dirSize(t, dir))
+
+	// Pages written by another process are loaded with the directory, and the files
+	// being written are left alone.
+	abs, err := filepath.Abs(dir)
+	require.NoError(t, err)
+	diskCachesMu.Lock()
+	delete(diskCaches, abs)
+	diskCachesMu.Unlock()
+
+	tmp := filepath.Join(dir, "0123456789abcdef0123456789abcdef-16-tmp-42")
+	require.NoError(t, os.WriteFile(tmp, make([]byte, 16), 0644))
+	other := filepath.Join(dir, "0123456789abcdef0123456789abcdef-16-0")
+	require.NoError(t, os.WriteFile(other, make([]byte, 16), 0644))
+
+	config.MaxDisk = 16
+	_, err = NewCachingRequester(BytesRequester(content), config)
+	require.NoError(t, err)
+	assert.FileExists(t, tmp)
+	assert.True(t, dirSize(t, dir) <= 32, "%d bytes cached", dirSize(t, dir))
+}
+
+func TestCachingRequesterPatch(t *testing.T) {
+	local, reference, patcher := newTestPlan(t)
+
+	requester := &fakeRequester{BytesRequester: reference}
+	cache, err := NewCachingRequester(singleRequests(requester), &CacheConfig{SizeFunc: requester.Size, PageSize: 4096})
+	require.NoError(t, err)
+
+	r, err := New(&Config{BlockSize: 256, PrefetchRequests: 4, Requester: cache})
+	require.NoError(t, err)
+
+	var fetched int64
+	for i := 0; i < 3; i++ {
+		output := bytes.NewBuffer(nil)
+		require.NoError(t, r.Patch(bytes.NewReader(local), patcher, output))
+		assert.Equal(t, reference, output.Bytes())
+
+		// Later patches are served from the cache.
+		if i == 0 {
+			fetched = cache.Stats().FetchedBytes
+		}
+	}
+	assert.Equal(t, fetched, cache.Stats().FetchedBytes)
+}
+
+func TestCachingRequesterBatches(t *testing.T) {
+	content := randomBytes(5, 100)
+	requester := &fakeRequester{BytesRequester: content}
+
+	r, err := NewCachingRequester(requester, &CacheConfig{SizeFunc: requester.Size, PageSize: 16})
+	require.NoError(t, err)
+	assert.True(t, supportsBatches(r))
+
+	_, err = r.DoRequest(16, 31)
+	require.NoError(t, err)
+	assert.Len(t, requester.ranges, 1)
+
+	// Only the missing pages are requested, in a single batch.
+	data, err := r.DoRequests([]*syncpb.MissingBlockSpan{
+		{StartOffset: 0, EndOffset: 20},
+		{StartOffset: 10, EndOffset: 40},
+		{StartOffset: 70, EndOffset: 99},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{content[0:21], content[10:41], content[70:100]}, data)
+	assert.Equal(t, [][]*syncpb.MissingBlockSpan{{
+		{StartOffset: 0, EndOffset: 15},
+		{StartOffset: 32, EndOffset: 47},
+		{StartOffset: 64, EndOffset: 99},
+	}}, requester.batches)
+	assert.Len(t, requester.ranges, 1)
+
+	_, err = r.DoRequests([]*syncpb.MissingBlockSpan{{StartOffset: 0, EndOffset: 100}})
+	assert.EqualError(t, err, "Invalid range 0-100 of 100 bytes")
+
+	// Other requesters are requested range by range.
+	plain, err := NewCachingRequester(BytesRequester(content), &CacheConfig{SizeFunc: requester.Size, PageSize: 16})
+	require.NoError(t, err)
+	assert.False(t, supportsBatches(plain))
+}
+
+func TestCachingRequesterSharedFetches(t *testing.T) {
+	content := randomBytes(5, 64)
+
+	for _, failures := range []int{0, 1} {
+		requester := &fakeRequester{
+			BytesRequester: content,
+			failures:       failures,
+			started:        make(chan struct{}),
+			release:        make(chan struct{}),
+		}
+
+		r, err := NewCachingRequester(singleRequests(requester), &CacheConfig{SizeFunc: requester.Size, PageSize: 16})
+		require.NoError(t, err)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data, err := r.DoRequest(0, 31)
+			if failures > 0 {
+				assert.Equal(t, errInjected, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, content[0:32], data)
+		}()
+		<-requester.started
+
+		// The second request waits for the page it shares with the first one.
+		var data []byte
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data, err = r.DoRequest(16, 47)
+		}()
+		for r.Stats().SharedHits == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		close(requester.release)
+		wg.Wait()
+
+		require.NoError(t, err)
+		assert.Equal(t, content[16:48], data)
+
+		if failures == 0 {
+			assert.Equal(t, [][2]int64{{0, 31}, {32, 47}}, requester.ranges)
+		} else {
+			// The page of the failed fetch is requested again.
+			assert.Equal(t, [][2]int64{{0, 31}, {32, 47}, {16, 31}}, requester.ranges)
+		}
+		assert.Equal(t, int64(1), r.Stats().SharedHits)
+	}
+}
+
+func TestInvalidCacheConfig(t *testing.T) {
+	_, err := NewCachingRequester(BytesRequester(nil), &CacheConfig{})
+	assert.EqualError(t, err, "File size function must be specified")
+
+	for _, c := range []*CacheConfig{{PageSize: -1}, {MaxMemory: -1}, {MaxDisk: -1}} {
+		c.SizeFunc = BytesRequester(nil).Size
+		_, err := NewCachingRequester(BytesRequester(nil), c)
+		assert.Error(t, err)
+		assert.True(t, strings.HasPrefix(err.Error(), "Invalid cache"))
+	}
+}
@@ -0,0 +1,217 @@
+package gosync
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/rkcloudchain/gosync/syncpb"
+)
+
+// gearTable holds the random values of the gear hash. They are generated from a fixed
+// seed, so that every signer cuts the same content at the same boundaries.
+var gearTable = func() (table [256]uint64) {
+	seed := uint64(0)
+	for i := range table {
+		// splitmix64
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return
+}()
+
+// chunker cuts a stream into content-defined chunks with FastCDC: a boundary follows the
+// first byte where the gear hash of the preceding bytes matches a mask, looking no closer
+// than min bytes and no further than max bytes from the previous boundary. The mask is
+// harder to match before avg bytes and easier after, which keeps chunk sizes close to avg.
+type chunker struct {
+	reader        io.Reader
+	min, avg, max int
+	maskS, maskL  uint64
+
+	buffer     []byte
+	start, end int
+	eof        bool
+}
+
+func newChunker(reader io.Reader, min, avg, max int64) *chunker {
+	bits := uint(0)
+	for int64(1)<<(bits+1) <= avg {
+		bits++
+	}
+
+	return &chunker{
+		reader: reader,
+		min:    int(min),
+		avg:    int(avg),
+		max:    int(max),
+		maskS:  topBits(bits + 1),
+		maskL:  topBits(bits - 1),
+		buffer: make([]byte, 2*max),
+	}
+}
+
+// topBits returns a mask of the n most significant bits, which depend on the most bytes of a gear hash.
+func topBits(n uint) uint64 {
+	if n == 0 {
+		return 0
+	}
+	return ^uint64(0) << (64 - n)
+}
+
+// Next returns the next chunk, which is valid until the following call, or io.EOF after the last one.
+func (c *chunker) Next() ([]byte, error) {
+	if c.end-c.start < c.max && !c.eof {
+		if err := c.fill(); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.start == c.end {
+		return nil, io.EOF
+	}
+
+	data := c.buffer[c.start:c.end]
+	chunk := data[:c.cut(data)]
+	c.start += len(chunk)
+	return chunk, nil
+}
+
+// fill moves the pending data to the front of the buffer and reads until it is full or the stream ends.
+func (c *chunker) fill() error {
+	c.end = copy(c.buffer, c.buffer[c.start:c.end])
+	c.start = 0
+
+	n, err := io.ReadFull(c.reader, c.buffer[c.end:])
+	c.end += n
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		c.eof = true
+		return nil
+	}
+	return err
+}
+
+// cut returns the length of the chunk at the start of data.
+func (c *chunker) cut(data []byte) int {
+	n := len(data)
+	if n <= c.min {
+		return n
+	}
+	if n > c.max {
+		n = c.max
+	}
+
+	normal := c.avg
+	if normal > n {
+		normal = n
+	}
+
+	var h uint64
+	i := c.min
+	for ; i < normal; i++ {
+		h = (h << 1) + gearTable[data[i]]
+		if h&c.maskS == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		h = (h << 1) + gearTable[data[i]]
+		if h&c.maskL == 0 {
+			return i + 1
+		}
+	}
+
+	return n
+}
+
+// createChunkSign reads the input file, and returns the checksums of its content-defined chunks.
+func (r *rsync) createChunkSign(ctx context.Context, dest io.Reader) ([]*syncpb.ChunkChecksum, error) {
+	strongHasher := r.strongHasher()
+	rolling := r.weakHasher.New()
+	chunker := newChunker(dest, r.minChunkSize, r.blockSize, r.maxChunkSize)
+
+	checksums := make([]*syncpb.ChunkChecksum, 0)
+	var offset int64
+
+	for index := uint32(0); ; index++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Could not read chunk %d: %v", index, err)
+		}
+
+		rolling.Reset()
+		rolling.Write(chunk)
+
+		checksums = append(checksums, &syncpb.ChunkChecksum{
+			BlockIndex: index,
+			WeakHash:   rolling.Sum32(),
+			StrongHash: computeStrongHash(strongHasher, chunk),
+			BlockSize:  int64(len(chunk)),
+			Offset:     offset,
+		})
+		offset += int64(len(chunk))
+	}
+
+	return checksums, nil
+}
+
+// scanChunks is scan for content-defined signatures. The source is cut into chunks the
+// way the signed file was, and every chunk is looked up by its strong hash.
+func (r *rsync) scanChunks(ctx context.Context, source io.Reader, checksums *syncpb.ChunkChecksums, onMatch func(blockMatchResult) error, onLiteral func(byte) error) (int64, error) {
+	strongHasher := r.strongHasher()
+	strongLength := int(checksums.StrongHashLength)
+	if strongLength == 0 {
+		strongLength = strongHasher.Size()
+	}
+
+	// The first chunk of identical content is the one reused.
+	chunks := make(map[string]blockMatchResult, len(checksums.Checksums))
+	for _, chunk := range checksums.Checksums {
+		if _, ok := chunks[string(chunk.StrongHash)]; !ok {
+			chunks[string(chunk.StrongHash)] = blockMatchResult{Index: chunk.BlockIndex, Size: chunk.BlockSize, LocalOffset: chunk.Offset}
+		}
+	}
+
+	chunker := newChunker(source, checksums.MinChunkSize, checksums.ConfigBlockSize, checksums.MaxChunkSize)
+	var offset int64
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+
+		data, err := chunker.Next()
+		if err == io.EOF {
+			return offset, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		strong := computeStrongHash(strongHasher, data)[:strongLength]
+		if m, ok := chunks[string(strong)]; ok && m.Size == int64(len(data)) {
+			m.ComparisonOffset = offset
+			if err := onMatch(m); err != nil {
+				return 0, err
+			}
+		} else if onLiteral != nil {
+			for _, c := range data {
+				if err := onLiteral(c); err != nil {
+					return 0, err
+				}
+			}
+		}
+
+		offset += int64(len(data))
+	}
+}
@@ -0,0 +1,178 @@
+package gosync
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/rkcloudchain/gosync/syncpb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func chunkSizes(t *testing.T, data []byte, min, avg, max int64) []int {
+	var sizes []int
+	c := newChunker(bytes.NewReader(data), min, avg, max)
+	for {
+		chunk, err := c.Next()
+		if err == io.EOF {
+			return sizes
+		}
+		require.NoError(t, err)
+		sizes = append(sizes, len(chunk))
+	}
+}
+
+func TestChunker(t *testing.T) {
+	data := make([]byte, 1024*1024)
+	rand.New(rand.NewSource(3)).Read(data)
+
+	sizes := chunkSizes(t, data, 1024, 4096, 16384)
+	total := 0
+	for i, size := range sizes {
+		total += size
+		assert.True(t, size <= 16384)
+		if i < len(sizes)-1 {
+			assert.True(t, size >= 1024)
+		}
+	}
+	assert.Equal(t, len(data), total)
+
+	// The average stays close to the requested one.
+	average := total / len(sizes)
+	assert.True(t, average > 2048 && average < 8192, "average chunk size %d", average)
+
+	assert.Equal(t, sizes, chunkSizes(t, data, 1024, 4096, 16384))
+	assert.Empty(t, chunkSizes(t, nil, 1024, 4096, 16384))
+	assert.Equal(t, []int{100}, chunkSizes(t, data[:100], 1024, 4096, 16384))
+}
+
+func TestChunkerResynchronizes(t *testing.T) {
+	data := make([]byte, 256*1024)
+	rand.New(rand.NewSource(4)).Read(data)
+
+	edited := append([]byte{'x'}, data...)
+
+	a := chunkSizes(t, data, 256, 1024, 4096)
+	b := chunkSizes(t, edited, 256, 1024, 4096)
+
+	// After the first few chunks, the boundaries are the same.
+	assert.Equal(t, a[len(a)-len(a)/2:], b[len(b)-len(a)/2:])
+}
+
+func TestCDCSign(t *testing.T) {
+	local := make([]byte, 64*1024)
+	rand.New(rand.NewSource(5)).Read(local)
+
+	r := newTestGoSync(t, &Config{BlockSize: 1024, ContentDefinedChunking: true}, nil)
+	checksums, err := r.Sign(bytes.NewReader(local))
+	require.NoError(t, err)
+
+	assert.Equal(t, syncpb.ChunkingFastCDC, checksums.ChunkingAlgorithm)
+	assert.Equal(t, int64(256), checksums.MinChunkSize)
+	assert.Equal(t, int64(1024), checksums.ConfigBlockSize)
+	assert.Equal(t, int64(4096), checksums.MaxChunkSize)
+
+	var offset int64
+	for i, chunk := range checksums.Checksums {
+		assert.Equal(t, uint32(i), chunk.BlockIndex)
+		assert.Equal(t, offset, chunk.Offset)
+		offset += chunk.BlockSize
+	}
+	assert.Equal(t, int64(len(local)), offset)
+
+	at, err := r.SignAt(bytes.NewReader(local), int64(len(local)))
+	require.NoError(t, err)
+	assert.Equal(t, checksums, at)
+}
+
+func TestCDCDeltaPatch(t *testing.T) {
+	rnd := rand.New(rand.NewSource(6))
+	local := make([]byte, 64*1024)
+	rnd.Read(local)
+
+	// A byte inserted near the start shifts everything after it.
+	reference := append(append(append([]byte(nil), local[:100]...), 'x'), local[100:]...)
+	reference = append(reference, []byte("appended")...)
+
+	r := newTestGoSync(t, &Config{BlockSize: 1024, ContentDefinedChunking: true}, reference)
+	checksums, err := r.Sign(bytes.NewReader(local))
+	require.NoError(t, err)
+
+	patcher, err := r.Delta(bytes.NewReader(reference), checksums)
+	require.NoError(t, err)
+
+	var missing int64
+	for _, block := range patcher.Missing {
+		missing += spanLength(block)
+	}
+	assert.True(t, missing < 16*1024, "%d bytes missing", missing)
+
+	for _, found := range patcher.Found {
+		assert.Equal(t, checksums.Checksums[found.StartIndex].Offset, found.LocalOffset)
+	}
+
+	output := bytes.NewBuffer(nil)
+	require.NoError(t, r.Patch(bytes.NewReader(local), patcher, output))
+	assert.Equal(t, reference, output.Bytes())
+
+	// The streamed plan is the same.
+	ch := make(chan *syncpb.BlockSpan, 1024)
+	require.NoError(t, r.DeltaStream(bytes.NewReader(reference), checksums, NewChanDeltaWriter(ch)))
+	close(ch)
+
+	output.Reset()
+	require.NoError(t, r.PatchStream(bytes.NewReader(local), NewChanSpanReader(ch), output))
+	assert.Equal(t, reference, output.Bytes())
+}
+
+func TestInvalidCDC(t *testing.T) {
+	_, err := New(&Config{BlockSize: 1024, ContentDefinedChunking: true, MinChunkSize: 2048})
+	assert.EqualError(t, err, "Invalid chunk sizes 2048-1024-4096")
+
+	_, err = New(&Config{BlockSize: 1024, ContentDefinedChunking: true, MaxChunkSize: 512})
+	assert.EqualError(t, err, "Invalid chunk sizes 256-1024-512")
+
+	_, err = New(&Config{BlockSize: 1024, ContentDefinedChunking: true, MaxChunkSize: 1 << 30})
+	assert.EqualError(t, err, "Invalid chunk sizes 256-1024-1073741824")
+
+	// The chunker needs an average of a few bits of the gear hash.
+	_, err = New(&Config{BlockSize: 1, ContentDefinedChunking: true})
+	assert.EqualError(t, err, "Invalid chunk sizes 1-1-4")
+
+	_, err = New(&Config{BlockSize: 63, ContentDefinedChunking: true, MinChunkSize: 1, MaxChunkSize: 64})
+	assert.EqualError(t, err, "Invalid chunk sizes 1-63-64")
+
+	r := newTestGoSync(t, &Config{BlockSize: 1024, ContentDefinedChunking: true}, nil)
+	checksums, err := r.Sign(bytes.NewReader([]byte("The quick brown fox")))
+	require.NoError(t, err)
+
+	checksums.MinChunkSize = 0
+	_, err = r.Delta(bytes.NewReader(nil), checksums)
+	assert.EqualError(t, err, "Invalid chunk sizes 0-1024-4096")
+
+	checksums.MinChunkSize = 256
+	checksums.MaxChunkSize = 1 << 30
+	_, err = r.Delta(bytes.NewReader(nil), checksums)
+	assert.EqualError(t, err, "Invalid chunk sizes 256-1024-1073741824")
+
+	checksums.MinChunkSize = 1
+	checksums.ConfigBlockSize = 1
+	checksums.MaxChunkSize = 4
+	_, err = r.Delta(bytes.NewReader(nil), checksums)
+	assert.EqualError(t, err, "Invalid chunk sizes 1-1-4")
+	checksums.MinChunkSize = 256
+	checksums.ConfigBlockSize = 1024
+
+	// Chunks of signatures older than offsetsVersion cannot be located.
+	checksums.MaxChunkSize = 4096
+	checksums.FormatVersion = 1
+	_, err = r.Delta(bytes.NewReader(nil), checksums)
+	assert.EqualError(t, err, "Unsupported format version 1 for content-defined chunks")
+
+	checksums.FormatVersion = formatVersion
+	checksums.ChunkingAlgorithm = 7
+	_, err = r.Delta(bytes.NewReader(nil), checksums)
+	assert.EqualError(t, err, "Unknown chunking algorithm 7")
+}
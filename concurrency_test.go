@@ -0,0 +1,66 @@
+package gosync
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrentOperations(t *testing.T) {
+	rnd := rand.New(rand.NewSource(11))
+	reference := make([]byte, 64*1024)
+	rnd.Read(reference)
+
+	r, err := New(&Config{
+		BlockSize:           512,
+		StrongHasher:        sha256.New,
+		MaxRequestBlockSize: 4096,
+		Requester:           BytesRequester(reference),
+		SizeFunc:            func() (int64, error) { return int64(len(reference)), nil },
+	})
+	require.NoError(t, err)
+
+	locals := make([][]byte, 8)
+	for i := range locals {
+		local := append([]byte(nil), reference...)
+		for j := 0; j < 16; j++ {
+			local[rnd.Intn(len(local))] ^= 0xff
+		}
+		locals[i] = append([]byte(fmt.Sprintf("local %d", i)), local[i*1024:]...)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(locals))
+	outputs := make([][]byte, len(locals))
+
+	for i := range locals {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			checksums, err := r.Sign(bytes.NewReader(locals[i]))
+			require.NoError(t, err)
+			patcher, err := r.Delta(bytes.NewReader(reference), checksums)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+
+			output := bytes.NewBuffer(nil)
+			errs[i] = r.Patch(bytes.NewReader(locals[i]), patcher, output)
+			outputs[i] = output.Bytes()
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range locals {
+		assert.NoError(t, errs[i])
+		assert.Equal(t, reference, outputs[i])
+	}
+}
@@ -1,8 +1,8 @@
 package gosync
 
 import (
+	"context"
 	"crypto/md5"
-	"errors"
 	"fmt"
 	"hash"
 	"io"
@@ -12,8 +12,14 @@ import (
 
 const (
 	maxBlockSize               = 128 * 1024
+	minAutoBlockSize           = 512
+	maxAutoBlockSize           = 1024 * 1024
+	maxChunkSize               = 4 * maxAutoBlockSize
+	minChunkAverage            = 64
 	defaultBlockSize           = 64 * 1024
 	defaultMaxRequestBlockSize = 512 * 1024
+	defaultPrefetchMemory      = 64 * 1024 * 1024
+	defaultMaxBatchSpans       = 64
 )
 
 // ReadSeekerAt is the combination of ReadSeeker and ReaderAt interfaces
@@ -27,42 +33,112 @@ type BlockRequester interface {
 	DoRequest(startOffset int64, enfOffset int64) (data []byte, err error)
 }
 
+// ContextBlockRequester is a BlockRequester whose requests can be cancelled.
+type ContextBlockRequester interface {
+	BlockRequester
+	DoRequestContext(ctx context.Context, startOffset int64, endOffset int64) (data []byte, err error)
+}
+
 // Config contains the parameters to start a gosync service.
 type Config struct {
 	// BlockSize force a fixed checksum block-size
 	BlockSize int64
 
+	// AutoBlockSize makes Sign choose the block size of every file from its size, as its
+	// square root like rsync, between 512 bytes and 1 MiB. BlockSize is still used when Sign
+	// cannot tell the size of its input, which is neither a working io.Seeker nor signed with SignAt.
+	AutoBlockSize bool
+
+	// ContentDefinedChunking makes Sign cut the file at boundaries that depend on its content,
+	// with BlockSize, at least 64 bytes, as the average chunk size, instead of every BlockSize bytes. Delta then
+	// cuts the source the same way and looks its chunks up by hash instead of scanning for blocks.
+	ContentDefinedChunking bool
+
+	// MinChunkSize and MaxChunkSize bound the size of content-defined chunks,
+	// BlockSize/4 and BlockSize*4 by default. With AutoBlockSize, they keep their ratio to BlockSize.
+	MinChunkSize int64
+	MaxChunkSize int64
+
 	// Logger is the logger used for gosync log.
 	Logger logging.Logger
 
-	// A hash function for calculating a strong checksum
-	StrongHasher hash.Hash
+	// StrongHasher creates the hash function calculating strong checksums,
+	// a new one is used by every operation.
+	StrongHasher func() hash.Hash
+
+	// StrongHashLength truncates the strong checksums stored in signatures, 0 keeps them whole.
+	StrongHashLength int
+
+	// WeakHasher is the rolling checksum algorithm used by Sign, Adler32 by default.
+	// Delta always uses the algorithm recorded in the signature, which is either a built-in
+	// one or this one. A custom WeakHasher needs an algorithm identifier of its own.
+	WeakHasher WeakHasher
 
 	// MaxRequestBlockSize defines the maximum file block size for the remote transfer
 	MaxRequestBlockSize int64
 
+	// EmbedLiterals makes Delta copy the missing data into the patch plan,
+	// so that Patch does not need a Requester.
+	EmbedLiterals bool
+
+	// SpanDigests makes Delta record the digest of every found span in the plan besides
+	// the digests of the missing spans and of the whole source, so that Patch reports
+	// which span was corrupted.
+	SpanDigests bool
+
+	// MaxRequestRetries is the number of times Patch requests a missing span again
+	// after a response of the wrong length or digest.
+	MaxRequestRetries int
+
+	// PrefetchRequests is the number of missing spans Patch requests in parallel
+	// ahead of the output, 1 disables prefetching.
+	PrefetchRequests int
+
+	// PrefetchMemory bounds the size of the prefetched data held by Patch, 64 MiB by default.
+	// A span larger than the budget is still requested, on its own.
+	PrefetchMemory int64
+
+	// MaxBatchSpans is the number of missing spans Patch requests in a single call
+	// when the Requester is a BatchBlockRequester, 64 by default.
+	MaxBatchSpans int
+
+	// CoalesceGap merges the missing spans of a batch separated by at most this many
+	// bytes into a single range. The bytes between them are requested and discarded.
+	CoalesceGap int64
+
 	// Resolver is an interface used by the patchers to obtain blocks from the source.
+	// It may be nil when patching plans with embedded literals.
 	Requester BlockRequester
 
-	// Function for getting the file size
+	// Function for getting the file size, required by Delta
 	SizeFunc func() (int64, error)
+
+	// Concurrency is the number of goroutines scanning the source in Delta
+	// and hashing blocks in SignAt, 1 by default.
+	Concurrency int
 }
 
 func (c *Config) validate() error {
-	if c.BlockSize > maxBlockSize {
+	if c.BlockSize < 0 || c.BlockSize > maxBlockSize {
 		return fmt.Errorf("Invalid block length %d", c.BlockSize)
 	}
 
-	if c.Requester == nil {
-		return errors.New("Block requester must be specified")
+	if c.BlockSize == 0 {
+		c.BlockSize = defaultBlockSize
 	}
 
-	if c.SizeFunc == nil {
-		return errors.New("File size function must be specified")
-	}
+	if c.ContentDefinedChunking {
+		if c.MinChunkSize == 0 {
+			c.MinChunkSize = (c.BlockSize + 3) / 4
+		}
 
-	if c.BlockSize == 0 {
-		c.BlockSize = defaultBlockSize
+		if c.MaxChunkSize == 0 {
+			c.MaxChunkSize = c.BlockSize * 4
+		}
+
+		if c.BlockSize < minChunkAverage || c.MinChunkSize < 0 || c.MinChunkSize > c.BlockSize || c.MaxChunkSize < c.BlockSize || c.MaxChunkSize > maxChunkSize {
+			return fmt.Errorf("Invalid chunk sizes %d-%d-%d", c.MinChunkSize, c.BlockSize, c.MaxChunkSize)
+		}
 	}
 
 	if c.Logger != nil {
@@ -70,7 +146,55 @@ func (c *Config) validate() error {
 	}
 
 	if c.StrongHasher == nil {
-		c.StrongHasher = md5.New()
+		c.StrongHasher = md5.New
+	}
+
+	if c.StrongHashLength < 0 || c.StrongHashLength > c.StrongHasher().Size() {
+		return fmt.Errorf("Invalid strong hash length %d", c.StrongHashLength)
+	}
+
+	if c.WeakHasher == nil {
+		c.WeakHasher = Adler32
+	}
+
+	if h, ok := weakHashers[c.WeakHasher.Algorithm()]; ok && h != c.WeakHasher {
+		return fmt.Errorf("Invalid weak hash algorithm %d, reserved for a built-in one", c.WeakHasher.Algorithm())
+	}
+
+	if c.Concurrency < 0 {
+		return fmt.Errorf("Invalid concurrency %d", c.Concurrency)
+	}
+
+	if c.Concurrency == 0 {
+		c.Concurrency = 1
+	}
+
+	if c.MaxRequestRetries < 0 {
+		return fmt.Errorf("Invalid request retries %d", c.MaxRequestRetries)
+	}
+
+	if c.PrefetchRequests < 0 {
+		return fmt.Errorf("Invalid prefetch requests %d", c.PrefetchRequests)
+	}
+
+	if c.PrefetchMemory < 0 {
+		return fmt.Errorf("Invalid prefetch memory %d", c.PrefetchMemory)
+	}
+
+	if c.PrefetchMemory == 0 {
+		c.PrefetchMemory = defaultPrefetchMemory
+	}
+
+	if c.MaxBatchSpans < 0 {
+		return fmt.Errorf("Invalid batch spans %d", c.MaxBatchSpans)
+	}
+
+	if c.MaxBatchSpans == 0 {
+		c.MaxBatchSpans = defaultMaxBatchSpans
+	}
+
+	if c.CoalesceGap < 0 {
+		return fmt.Errorf("Invalid coalesce gap %d", c.CoalesceGap)
 	}
 
 	if c.MaxRequestBlockSize == 0 {
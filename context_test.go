@@ -0,0 +1,100 @@
+package gosync
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/rkcloudchain/gosync/syncpb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// cancellingReader cancels a context once more than limit bytes have been read.
+type cancellingReader struct {
+	io.ReaderAt
+	limit  int64
+	cancel context.CancelFunc
+}
+
+func (c *cancellingReader) ReadAt(p []byte, off int64) (int, error) {
+	if off > c.limit {
+		c.cancel()
+	}
+	return c.ReaderAt.ReadAt(p, off)
+}
+
+func TestSignContextCancelled(t *testing.T) {
+	r := &rsync{blockSize: 4, strongHasher: md5.New, weakHasher: Adler32}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := r.SignContext(ctx, bytes.NewReader([]byte("hello world")))
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestDeltaContextCancelled(t *testing.T) {
+	r := &rsync{blockSize: 64, strongHasher: md5.New, weakHasher: Adler32, sizeFunc: func() (int64, error) { return 4 * 1024 * 1024, nil }}
+	checksums, err := r.Sign(bytes.NewReader([]byte("hello world")))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	source := &cancellingReader{ReaderAt: bytes.NewReader(make([]byte, 4*1024*1024)), limit: 1024 * 1024, cancel: cancel}
+	_, err = r.DeltaContext(ctx, source, checksums)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestPatchContextCancelled(t *testing.T) {
+	r := &rsync{blockSize: 4, strongHasher: md5.New, weakHasher: Adler32, reference: BytesRequester([]byte("0123456789"))}
+	patcher := &syncpb.PatcherBlockSpan{
+		Found:   []*syncpb.FoundBlockSpan{{ComparisonOffset: 0, BlockSize: 4}},
+		Missing: []*syncpb.MissingBlockSpan{{StartOffset: 4, EndOffset: 7}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	output := bytes.NewBuffer(nil)
+	err := r.PatchContext(ctx, bytes.NewReader([]byte("abcd")), patcher, output)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 0, output.Len())
+}
+
+func TestPatchContextRequester(t *testing.T) {
+	requester := &fakeRequester{hangs: -1}
+	r, err := New(&Config{BlockSize: 4, Requester: requester})
+	require.NoError(t, err)
+
+	patcher := &syncpb.PatcherBlockSpan{Missing: []*syncpb.MissingBlockSpan{{StartOffset: 0, EndOffset: 3}}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err = r.PatchContext(ctx, bytes.NewReader(nil), patcher, bytes.NewBuffer(nil))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), context.DeadlineExceeded.Error())
+	assert.Len(t, requester.ranges, 1)
+}
+
+func TestPatchContextBatchRequester(t *testing.T) {
+	requester := &fakeRequester{hangs: -1}
+	r, err := New(&Config{BlockSize: 4, Requester: requester})
+	require.NoError(t, err)
+
+	patcher := &syncpb.PatcherBlockSpan{Missing: []*syncpb.MissingBlockSpan{{StartOffset: 0, EndOffset: 3}, {StartOffset: 8, EndOffset: 11}}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err = r.PatchContext(ctx, bytes.NewReader(nil), patcher, bytes.NewBuffer(nil))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), context.DeadlineExceeded.Error())
+	assert.Empty(t, requester.ranges)
+	assert.Len(t, requester.batches, 1)
+}
@@ -0,0 +1,48 @@
+package gosync
+
+import "fmt"
+
+// ErrUnsupportedFormat is returned when a signature or a patch plan was
+// produced with a format version this library does not understand.
+type ErrUnsupportedFormat struct {
+	Version uint32
+}
+
+func (e *ErrUnsupportedFormat) Error() string {
+	return fmt.Sprintf("Unsupported format version %d, expected at most %d", e.Version, formatVersion)
+}
+
+// ErrInvalidSignature is returned when a signature carries block or chunk sizes
+// that are out of range.
+type ErrInvalidSignature struct {
+	Message string
+}
+
+func (e *ErrInvalidSignature) Error() string {
+	return e.Message
+}
+
+// ErrSignatureMismatch is returned when a signature or a patch plan does not
+// agree with the local configuration or data.
+type ErrSignatureMismatch struct {
+	Field  string
+	Remote interface{}
+	Local  interface{}
+}
+
+func (e *ErrSignatureMismatch) Error() string {
+	return fmt.Sprintf("Signature mismatch on %s: got %v, local %v", e.Field, e.Remote, e.Local)
+}
+
+// ErrChecksumMismatch is returned when the patched output differs from the source,
+// either as a whole or in the range of a single span.
+type ErrChecksumMismatch struct {
+	Offset   int64
+	Length   int64
+	Expected []byte
+	Actual   []byte
+}
+
+func (e *ErrChecksumMismatch) Error() string {
+	return fmt.Sprintf("Checksum mismatch on %d bytes at offset %d: expected %x, got %x", e.Length, e.Offset, e.Expected, e.Actual)
+}
@@ -1,10 +1,20 @@
 module github.com/rkcloudchain/gosync
 
-go 1.12
+go 1.19
 
 require (
 	github.com/gogo/protobuf v1.2.1
-	github.com/golang/protobuf v1.3.1
-	github.com/petar/GoLLRB v0.0.0-20190514000832-33fb24c13b99
+	github.com/golang/protobuf v1.5.4
 	github.com/stretchr/testify v1.3.0
+	google.golang.org/grpc v1.63.2
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/net v0.34.0 // indirect
+	golang.org/x/sys v0.29.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240227224415-6ceb2ff114de // indirect
+	google.golang.org/protobuf v1.33.0 // indirect
 )
@@ -1,6 +1,7 @@
 package gosync
 
 import (
+	"context"
 	"io"
 
 	"github.com/rkcloudchain/gosync/syncpb"
@@ -8,11 +9,30 @@ import (
 
 // GoSync represents a rsync service
 type GoSync interface {
-	Sign(io.Reader) *syncpb.ChunkChecksums
+	Sign(io.Reader) (*syncpb.ChunkChecksums, error)
+
+	SignContext(context.Context, io.Reader) (*syncpb.ChunkChecksums, error)
+
+	// SignAt hashes the blocks of the first size bytes of a file concurrently.
+	SignAt(io.ReaderAt, int64) (*syncpb.ChunkChecksums, error)
+
+	SignAtContext(context.Context, io.ReaderAt, int64) (*syncpb.ChunkChecksums, error)
 
 	Delta(io.ReaderAt, *syncpb.ChunkChecksums) (*syncpb.PatcherBlockSpan, error)
 
+	DeltaContext(context.Context, io.ReaderAt, *syncpb.ChunkChecksums) (*syncpb.PatcherBlockSpan, error)
+
+	DeltaStream(io.Reader, *syncpb.ChunkChecksums, DeltaWriter) error
+
+	DeltaStreamContext(context.Context, io.Reader, *syncpb.ChunkChecksums, DeltaWriter) error
+
 	Patch(io.ReadSeeker, *syncpb.PatcherBlockSpan, io.Writer) error
+
+	PatchContext(context.Context, io.ReadSeeker, *syncpb.PatcherBlockSpan, io.Writer) error
+
+	PatchStream(io.ReadSeeker, SpanReader, io.Writer) error
+
+	PatchStreamContext(context.Context, io.ReadSeeker, SpanReader, io.Writer) error
 }
 
 // New returns a new gosync instance given configuration.
@@ -2,10 +2,14 @@ package gosync
 
 import (
 	"bytes"
+	"crypto/md5"
 	"crypto/sha256"
+	"crypto/sha512"
 	"testing"
 
+	"github.com/rkcloudchain/gosync/syncpb"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestErrorConfig(t *testing.T) {
@@ -14,26 +18,75 @@ func TestErrorConfig(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "Invalid block length")
 
-	c = &Config{BlockSize: 4}
+	c = &Config{StrongHashLength: 17, Requester: BytesRequester([]byte("")), SizeFunc: func() (int64, error) { return 0, nil }}
 	err = c.validate()
 	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "Block requester must be specified")
+	assert.Contains(t, err.Error(), "Invalid strong hash length")
 
-	c = &Config{BlockSize: 4, Requester: NewReadSeekerRequester(bytes.NewReader([]byte("")))}
-	err = c.validate()
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "File size function must be specified")
-
-	c = &Config{Requester: NewReadSeekerRequester(bytes.NewReader([]byte(""))), SizeFunc: func() (int64, error) { return 0, nil }}
+	c = &Config{Requester: BytesRequester([]byte("")), SizeFunc: func() (int64, error) { return 0, nil }}
 	err = c.validate()
 	assert.NoError(t, err)
 	assert.Equal(t, int64(defaultBlockSize), c.BlockSize)
 	assert.NotNil(t, c.StrongHasher)
 	assert.Equal(t, int64(defaultMaxRequestBlockSize), c.MaxRequestBlockSize)
+	assert.Equal(t, Adler32, c.WeakHasher)
+}
+
+func TestMissingRequesterAndSizeFunc(t *testing.T) {
+	r, err := New(&Config{BlockSize: 4})
+	require.NoError(t, err)
+
+	checksums, err := r.Sign(bytes.NewReader([]byte("hello world")))
+	require.NoError(t, err)
+
+	local := bytes.NewReader([]byte("hello world"))
+	_, err = r.Delta(bytes.NewReader([]byte("hello")), checksums)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "File size function must be specified")
+
+	patcher := &syncpb.PatcherBlockSpan{Missing: []*syncpb.MissingBlockSpan{{StartOffset: 0, EndOffset: 4}}}
+	err = r.Patch(local, patcher, bytes.NewBuffer(nil))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Block requester must be specified")
+}
+
+func TestEmbeddedLiterals(t *testing.T) {
+	local := []byte("The qwik brown fox jumped 0v3r the lazy")
+	reference := []byte("The quick brown fox jumped over the lazy dog")
+
+	sender, err := New(&Config{
+		BlockSize:           4,
+		MaxRequestBlockSize: 8,
+		EmbedLiterals:       true,
+		SizeFunc:            func() (int64, error) { return int64(len(reference)), nil },
+	})
+	require.NoError(t, err)
+
+	receiver, err := New(&Config{BlockSize: 4})
+	require.NoError(t, err)
+
+	checksums, err := receiver.Sign(bytes.NewReader(local))
+	require.NoError(t, err)
+
+	patcher, err := sender.Delta(bytes.NewReader(reference), checksums)
+	require.NoError(t, err)
+	require.NotEmpty(t, patcher.Missing)
+	for _, block := range patcher.Missing {
+		assert.Equal(t, reference[block.StartOffset:block.EndOffset+1], block.Data)
+	}
+
+	data, err := patcher.Marshal()
+	require.NoError(t, err)
+	decoded := &syncpb.PatcherBlockSpan{}
+	require.NoError(t, decoded.Unmarshal(data))
+
+	output := bytes.NewBuffer(nil)
+	require.NoError(t, receiver.Patch(bytes.NewReader(local), decoded, output))
+	assert.Equal(t, reference, output.Bytes())
 }
 
 func TestNewWithErrorConfig(t *testing.T) {
-	c := &Config{}
+	c := &Config{BlockSize: -1}
 	_, err := New(c)
 	assert.Error(t, err)
 }
@@ -45,16 +98,17 @@ func TestGoRSync(t *testing.T) {
 
 	cfg := &Config{
 		BlockSize:           4,
-		StrongHasher:        sha256.New(),
+		StrongHasher:        sha256.New,
 		MaxRequestBlockSize: 16,
-		Requester:           NewReadSeekerRequester(reader),
+		Requester:           NewReaderAtRequester(reader, reader.Size()),
 		SizeFunc:            func() (int64, error) { return int64(len(reference)), nil },
 	}
 
 	r, err := New(cfg)
 	assert.NoError(t, err)
 
-	checksums := r.Sign(local)
+	checksums, err := r.Sign(local)
+	require.NoError(t, err)
 
 	patcher, err := r.Delta(reader, checksums)
 	assert.NoError(t, err)
@@ -64,3 +118,250 @@ func TestGoRSync(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, reference, output.Bytes())
 }
+
+func TestSignatureHeader(t *testing.T) {
+	local := []byte("The qwik brown fox jumped 0v3r the lazy")
+	r := newTestGoSync(t, &Config{BlockSize: 4, StrongHasher: sha256.New}, nil)
+
+	checksums, err := r.Sign(bytes.NewReader(local))
+	require.NoError(t, err)
+	assert.Equal(t, uint32(formatVersion), checksums.FormatVersion)
+	assert.Equal(t, syncpb.StrongHashSHA256, checksums.StrongHashAlgorithm)
+	assert.Equal(t, uint32(sha256.Size), checksums.StrongHashLength)
+	assert.Equal(t, syncpb.WeakHashAdler32, checksums.WeakHashAlgorithm)
+	assert.Equal(t, int64(len(local)), checksums.SourceLength)
+	assert.Len(t, checksums.BlockHashesDigest, sha256.Size)
+}
+
+func TestTruncatedStrongHash(t *testing.T) {
+	local := bytes.NewReader([]byte("The qwik brown fox jumped 0v3r the lazy"))
+	reference := []byte("The quick brown fox jumped over the lazy dog")
+
+	r, err := New(&Config{
+		BlockSize:        4,
+		StrongHashLength: 6,
+		Requester:        BytesRequester(reference),
+		SizeFunc:         func() (int64, error) { return int64(len(reference)), nil },
+	})
+	require.NoError(t, err)
+
+	checksums, err := r.Sign(local)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(6), checksums.StrongHashLength)
+	assert.Len(t, checksums.Checksums[0].StrongHash, 6)
+	assert.Empty(t, checksums.BlockHashesDigest)
+
+	patcher, err := r.Delta(bytes.NewReader(reference), checksums)
+	require.NoError(t, err)
+
+	output := bytes.NewBuffer(nil)
+	require.NoError(t, r.Patch(local, patcher, output))
+	assert.Equal(t, reference, output.Bytes())
+}
+
+func TestDeltaSignatureMismatch(t *testing.T) {
+	local := []byte("The qwik brown fox jumped 0v3r the lazy")
+	reference := []byte("The quick brown fox jumped over the lazy dog")
+
+	checksums, err := newTestGoSync(t, &Config{BlockSize: 4, StrongHasher: sha256.New}, nil).Sign(bytes.NewReader(local))
+	require.NoError(t, err)
+
+	_, err = newTestGoSync(t, &Config{BlockSize: 4, StrongHasher: md5.New}, reference).Delta(bytes.NewReader(reference), checksums)
+	require.IsType(t, &ErrSignatureMismatch{}, err)
+	assert.Equal(t, "strong_hash_algorithm", err.(*ErrSignatureMismatch).Field)
+
+	r := newTestGoSync(t, &Config{BlockSize: 4, StrongHasher: sha256.New}, reference)
+
+	checksums.SourceLength++
+	_, err = r.Delta(bytes.NewReader(reference), checksums)
+	require.IsType(t, &ErrSignatureMismatch{}, err)
+	assert.Equal(t, "source_length", err.(*ErrSignatureMismatch).Field)
+	checksums.SourceLength--
+
+	checksums.Checksums[1].StrongHash[0]++
+	_, err = r.Delta(bytes.NewReader(reference), checksums)
+	require.IsType(t, &ErrSignatureMismatch{}, err)
+	assert.Equal(t, "block_hashes_digest", err.(*ErrSignatureMismatch).Field)
+	checksums.Checksums[1].StrongHash[0]--
+
+	checksums.FormatVersion = formatVersion + 1
+	_, err = r.Delta(bytes.NewReader(reference), checksums)
+	assert.IsType(t, &ErrUnsupportedFormat{}, err)
+}
+
+func TestCustomStrongHashMismatch(t *testing.T) {
+	local := []byte("The qwik brown fox jumped 0v3r the lazy")
+	reference := []byte("The quick brown fox jumped over the lazy dog")
+
+	r := newTestGoSync(t, &Config{BlockSize: 4, StrongHasher: sha512.New384}, reference)
+	checksums, err := r.Sign(bytes.NewReader(local))
+	require.NoError(t, err)
+	assert.Equal(t, syncpb.StrongHashCustom, checksums.StrongHashAlgorithm)
+	assert.NotEmpty(t, checksums.StrongHashProbe)
+
+	other := newTestGoSync(t, &Config{BlockSize: 4, StrongHasher: sha512.New512_224}, reference)
+	_, err = other.Delta(bytes.NewReader(reference), checksums)
+	require.IsType(t, &ErrSignatureMismatch{}, err)
+	assert.Equal(t, "strong_hash_probe", err.(*ErrSignatureMismatch).Field)
+
+	patcher, err := r.Delta(bytes.NewReader(reference), checksums)
+	require.NoError(t, err)
+
+	err = other.Patch(bytes.NewReader(local), patcher, bytes.NewBuffer(nil))
+	require.IsType(t, &ErrSignatureMismatch{}, err)
+	assert.Equal(t, "digest_probe", err.(*ErrSignatureMismatch).Field)
+
+	output := bytes.NewBuffer(nil)
+	require.NoError(t, r.Patch(bytes.NewReader(local), patcher, output))
+	assert.Equal(t, reference, output.Bytes())
+}
+
+func TestPatchBasisMismatch(t *testing.T) {
+	local := []byte("The qwik brown fox jumped 0v3r the lazy")
+	reference := []byte("The quick brown fox jumped over the lazy dog")
+	r := newTestGoSync(t, &Config{BlockSize: 4, StrongHasher: sha256.New}, reference)
+
+	checksums, err := r.Sign(bytes.NewReader(local))
+	require.NoError(t, err)
+
+	patcher, err := r.Delta(bytes.NewReader(reference), checksums)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(local)), patcher.BasisLength)
+
+	err = r.Patch(bytes.NewReader(local[1:]), patcher, bytes.NewBuffer(nil))
+	require.IsType(t, &ErrSignatureMismatch{}, err)
+	assert.Equal(t, "basis_length", err.(*ErrSignatureMismatch).Field)
+
+	patcher.FormatVersion = formatVersion + 1
+	err = r.Patch(bytes.NewReader(local), patcher, bytes.NewBuffer(nil))
+	assert.IsType(t, &ErrUnsupportedFormat{}, err)
+}
+
+func TestLegacySignature(t *testing.T) {
+	local := []byte("The qwik brown fox jumped 0v3r the lazy")
+	reference := []byte("The quick brown fox jumped over the lazy dog")
+	r := newTestGoSync(t, &Config{BlockSize: 4, StrongHasher: md5.New}, reference)
+
+	signed, err := r.Sign(bytes.NewReader(local))
+	require.NoError(t, err)
+
+	// Signatures of format 0 only have the block size and the blocks.
+	checksums := &syncpb.ChunkChecksums{ConfigBlockSize: signed.ConfigBlockSize}
+	for _, chunk := range signed.Checksums {
+		checksums.Checksums = append(checksums.Checksums, &syncpb.ChunkChecksum{BlockIndex: chunk.BlockIndex, WeakHash: chunk.WeakHash, StrongHash: chunk.StrongHash, BlockSize: chunk.BlockSize})
+	}
+
+	patcher, err := r.Delta(bytes.NewReader(reference), checksums)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(local)), patcher.BasisLength)
+
+	output := bytes.NewBuffer(nil)
+	require.NoError(t, r.Patch(bytes.NewReader(local), patcher, output))
+	assert.Equal(t, reference, output.Bytes())
+
+	ch := make(chan *syncpb.BlockSpan, 64)
+	require.NoError(t, r.DeltaStream(bytes.NewReader(reference), checksums, NewChanDeltaWriter(ch)))
+	close(ch)
+
+	output.Reset()
+	require.NoError(t, r.PatchStream(bytes.NewReader(local), NewChanSpanReader(ch), output))
+	assert.Equal(t, reference, output.Bytes())
+}
+
+func TestPatchMismatchedConfigs(t *testing.T) {
+	local := []byte("The quick brown fox jumped over the lazy dog, and then it jumped back again")
+	reference := []byte("The quick brown cat jumped over the lazy dog, and then it jumped back again!")
+
+	signer, err := New(&Config{BlockSize: 8})
+	require.NoError(t, err)
+	checksums, err := signer.Sign(bytes.NewReader(local))
+	require.NoError(t, err)
+
+	sender := newTestGoSync(t, &Config{BlockSize: 4, StrongHasher: md5.New}, reference)
+	patcher, err := sender.Delta(bytes.NewReader(reference), checksums)
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), patcher.ConfigBlockSize)
+
+	// Plans older than offsetsVersion locate their spans by index, in blocks of the size
+	// recorded in the plan rather than the one of the receiver.
+	const olderVersion = offsetsVersion - 1
+	patcher.FormatVersion = olderVersion
+
+	receiver, err := New(&Config{BlockSize: 16, Requester: BytesRequester(reference)})
+	require.NoError(t, err)
+
+	output := bytes.NewBuffer(nil)
+	require.NoError(t, receiver.Patch(bytes.NewReader(local), patcher, output))
+	assert.Equal(t, reference, output.Bytes())
+
+	ch := make(chan *syncpb.BlockSpan, 64)
+	require.NoError(t, sender.DeltaStream(bytes.NewReader(reference), checksums, NewChanDeltaWriter(ch)))
+	close(ch)
+
+	spans := make(chan *syncpb.BlockSpan, 64)
+	for span := range ch {
+		if header := span.GetHeader(); header != nil {
+			header.FormatVersion = olderVersion
+		}
+		spans <- span
+	}
+	close(spans)
+
+	output.Reset()
+	require.NoError(t, receiver.PatchStream(bytes.NewReader(local), NewChanSpanReader(spans), output))
+	assert.Equal(t, reference, output.Bytes())
+}
+
+func TestPatchLocalOffsets(t *testing.T) {
+	local := []byte("0123456789abcdef")
+	r, err := New(&Config{BlockSize: 4})
+	require.NoError(t, err)
+
+	// A span at the start of the local file keeps its zero offset.
+	patcher := &syncpb.PatcherBlockSpan{
+		Found:           []*syncpb.FoundBlockSpan{{ComparisonOffset: 0, StartIndex: 2, EndIndex: 2, BlockSize: 4}},
+		FormatVersion:   formatVersion,
+		BasisLength:     int64(len(local)),
+		ConfigBlockSize: 4,
+	}
+
+	output := bytes.NewBuffer(nil)
+	require.NoError(t, r.Patch(bytes.NewReader(local), patcher, output))
+	assert.Equal(t, "0123", output.String())
+
+	patcher.Found[0].LocalOffset = 6
+	output.Reset()
+	require.NoError(t, r.Patch(bytes.NewReader(local), patcher, output))
+	assert.Equal(t, "6789", output.String())
+
+	// Older plans locate it by its index, whatever its local offset.
+	patcher.FormatVersion = 1
+	output.Reset()
+	require.NoError(t, r.Patch(bytes.NewReader(local), patcher, output))
+	assert.Equal(t, "89ab", output.String())
+}
+
+func TestDeltaLegacySignatureOffsets(t *testing.T) {
+	local := []byte("The quick brown fox jumped over the lazy dog")
+	reference := []byte("The quick brown cat jumped over the lazy dog")
+	r := newTestGoSync(t, &Config{BlockSize: 4, StrongHasher: md5.New}, reference)
+
+	checksums, err := r.Sign(bytes.NewReader(local))
+	require.NoError(t, err)
+
+	// Signatures of format 1 do not record block offsets.
+	checksums.FormatVersion = 1
+	for _, chunk := range checksums.Checksums {
+		chunk.Offset = 0
+	}
+
+	patcher, err := r.Delta(bytes.NewReader(reference), checksums)
+	require.NoError(t, err)
+	for _, found := range patcher.Found {
+		assert.Equal(t, int64(found.StartIndex)*4, found.LocalOffset)
+	}
+
+	output := bytes.NewBuffer(nil)
+	require.NoError(t, r.Patch(bytes.NewReader(local), patcher, output))
+	assert.Equal(t, reference, output.Bytes())
+}
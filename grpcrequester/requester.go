@@ -0,0 +1,140 @@
+// Package grpcrequester serves files, their signatures and deltas with the SyncService,
+// and fetches the blocks of a remote file with its streaming RPC.
+package grpcrequester
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rkcloudchain/gosync/syncpb"
+	"google.golang.org/grpc"
+)
+
+// Requester is a block requester reading ranges of a file served by a SyncService.
+type Requester struct {
+	// MaxFetchBytes bounds the total length of the ranges of a FetchBlocks RPC, larger
+	// batches are split into several RPCs. It must not exceed the bound of the server,
+	// DefaultMaxFetchBytes by default.
+	MaxFetchBytes int64
+
+	client syncpb.SyncServiceClient
+	path   string
+}
+
+// New returns a Requester of the file at path on the server of conn.
+func New(conn *grpc.ClientConn, path string) *Requester {
+	return &Requester{MaxFetchBytes: DefaultMaxFetchBytes, client: syncpb.NewSyncServiceClient(conn), path: path}
+}
+
+// DoRequest returns the bytes of the file from startOffset to endOffset, inclusive.
+func (r *Requester) DoRequest(startOffset int64, endOffset int64) ([]byte, error) {
+	return r.DoRequestContext(context.Background(), startOffset, endOffset)
+}
+
+// DoRequestContext is DoRequest with a context cancelling the RPC.
+func (r *Requester) DoRequestContext(ctx context.Context, startOffset int64, endOffset int64) ([]byte, error) {
+	data, err := r.DoRequestsContext(ctx, []*syncpb.MissingBlockSpan{{StartOffset: startOffset, EndOffset: endOffset}})
+	if err != nil {
+		return nil, err
+	}
+	return data[0], nil
+}
+
+// DoRequests returns the bytes of every range, streamed by as few RPCs as MaxFetchBytes allows.
+func (r *Requester) DoRequests(ranges []*syncpb.MissingBlockSpan) ([][]byte, error) {
+	return r.DoRequestsContext(context.Background(), ranges)
+}
+
+// DoRequestsContext is DoRequests with a context cancelling the RPCs.
+func (r *Requester) DoRequestsContext(ctx context.Context, ranges []*syncpb.MissingBlockSpan) ([][]byte, error) {
+	data := make([][]byte, len(ranges))
+
+	// Ranges are cut into spans filling RPCs of up to MaxFetchBytes, in order.
+	var spans []*syncpb.MissingBlockSpan
+	var owners []int
+	var length int64
+	for i, rng := range ranges {
+		for start := rng.StartOffset; ; {
+			end := rng.EndOffset
+			if r.MaxFetchBytes > 0 && end-start+1 > r.MaxFetchBytes-length {
+				end = start + r.MaxFetchBytes - length - 1
+			}
+
+			spans = append(spans, &syncpb.MissingBlockSpan{StartOffset: start, EndOffset: end})
+			owners = append(owners, i)
+			length += end - start + 1
+
+			if r.MaxFetchBytes > 0 && length >= r.MaxFetchBytes {
+				if err := r.fetch(ctx, spans, owners, data); err != nil {
+					return nil, err
+				}
+				spans, owners, length = nil, nil, 0
+			}
+
+			if end >= rng.EndOffset {
+				break
+			}
+			start = end + 1
+		}
+	}
+
+	if len(spans) > 0 {
+		if err := r.fetch(ctx, spans, owners, data); err != nil {
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+// fetch requests spans with a single RPC, appending the data of every span to the one of its owner range.
+func (r *Requester) fetch(ctx context.Context, spans []*syncpb.MissingBlockSpan, owners []int, data [][]byte) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := r.client.FetchBlocks(ctx, &syncpb.FetchBlocksRequest{Path: r.path, Spans: spans})
+	if err != nil {
+		return err
+	}
+
+	for i, want := range spans {
+		span, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+
+		if span.StartOffset != want.StartOffset || span.EndOffset != want.EndOffset {
+			return fmt.Errorf("Unexpected range %d-%d in the response, expected %d-%d",
+				span.StartOffset, span.EndOffset, want.StartOffset, want.EndOffset)
+		}
+
+		if data[owners[i]] == nil {
+			data[owners[i]] = span.Data
+		} else {
+			data[owners[i]] = append(data[owners[i]], span.Data...)
+		}
+	}
+
+	return nil
+}
+
+// Signature returns the signature of the file, computed by the server.
+func (r *Requester) Signature() (*syncpb.ChunkChecksums, error) {
+	return r.SignatureContext(context.Background())
+}
+
+// SignatureContext is Signature with a context cancelling the RPC.
+func (r *Requester) SignatureContext(ctx context.Context) (*syncpb.ChunkChecksums, error) {
+	return r.client.GetSignature(ctx, &syncpb.SignatureRequest{Path: r.path})
+}
+
+// Delta returns the plan patching a file of the given checksums into the file,
+// computed by the server.
+func (r *Requester) Delta(checksums *syncpb.ChunkChecksums) (*syncpb.PatcherBlockSpan, error) {
+	return r.DeltaContext(context.Background(), checksums)
+}
+
+// DeltaContext is Delta with a context cancelling the RPC.
+func (r *Requester) DeltaContext(ctx context.Context, checksums *syncpb.ChunkChecksums) (*syncpb.PatcherBlockSpan, error) {
+	return r.client.ComputeDelta(ctx, &syncpb.DeltaRequest{Path: r.path, Checksums: checksums})
+}
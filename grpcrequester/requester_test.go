@@ -0,0 +1,227 @@
+package grpcrequester
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rkcloudchain/gosync"
+	"github.com/rkcloudchain/gosync/syncpb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+var (
+	_ gosync.ContextBlockRequester      = (*Requester)(nil)
+	_ gosync.ContextBatchBlockRequester = (*Requester)(nil)
+	_ syncpb.SyncServiceServer          = (*Server)(nil)
+)
+
+var reference = []byte("The quick brown fox jumped over the lazy dog")
+
+// newTestConn serves the reference file as "file" in a temporary directory,
+// next to a sparse file of 1 MiB as "large", a symbolic link "link" to "file" and
+// a symbolic link "escape" to a file outside the directory, over an in-process listener.
+func newTestConn(t *testing.T) *grpc.ClientConn {
+	dir, err := os.MkdirTemp("", "grpcrequester")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file"), reference, 0644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "subdir"), 0755))
+
+	large, err := os.Create(filepath.Join(dir, "large"))
+	require.NoError(t, err)
+	require.NoError(t, large.Truncate(1024*1024))
+	require.NoError(t, large.Close())
+
+	outside, err := os.CreateTemp("", "grpcrequester")
+	require.NoError(t, err)
+	outside.Close()
+	t.Cleanup(func() { os.Remove(outside.Name()) })
+
+	require.NoError(t, os.Symlink("file", filepath.Join(dir, "link")))
+	require.NoError(t, os.Symlink(outside.Name(), filepath.Join(dir, "escape")))
+
+	server, err := NewServer(dir, &gosync.Config{BlockSize: 4})
+	require.NoError(t, err)
+
+	listener := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer()
+	syncpb.RegisterSyncServiceServer(s, server)
+	go s.Serve(listener)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func TestDoRequest(t *testing.T) {
+	r := New(newTestConn(t), "file")
+
+	data, err := r.DoRequest(4, 8)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("quick"), data)
+
+	_, err = r.DoRequest(40, 50)
+	assert.Equal(t, codes.OutOfRange, status.Code(err))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = r.DoRequestContext(ctx, 0, 3)
+	assert.Equal(t, codes.Canceled, status.Code(err))
+}
+
+func TestDoRequests(t *testing.T) {
+	data, err := New(newTestConn(t), "file").DoRequests([]*syncpb.MissingBlockSpan{
+		{StartOffset: 0, EndOffset: 2},
+		{StartOffset: 10, EndOffset: 14},
+		{StartOffset: 41, EndOffset: 43},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("The"), []byte("brown"), []byte("dog")}, data)
+}
+
+func TestInvalidPath(t *testing.T) {
+	conn := newTestConn(t)
+
+	_, err := New(conn, "missing").DoRequest(0, 3)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = New(conn, "subdir").Signature()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// Paths are relative to the served directory.
+	data, err := New(conn, "../../subdir/../file").DoRequest(0, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("The"), data)
+
+	// Symbolic links are followed within the directory only.
+	data, err = New(conn, "link").DoRequest(0, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("The"), data)
+
+	_, err = New(conn, "escape").Signature()
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestSignature(t *testing.T) {
+	g, err := gosync.New(&gosync.Config{BlockSize: 4})
+	require.NoError(t, err)
+
+	signature, err := g.Sign(bytes.NewReader(reference))
+	require.NoError(t, err)
+
+	checksums, err := New(newTestConn(t), "file").Signature()
+	require.NoError(t, err)
+	assert.Equal(t, signature, checksums)
+}
+
+func TestDelta(t *testing.T) {
+	r := New(newTestConn(t), "file")
+
+	_, err := r.Delta(nil)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	g, err := gosync.New(&gosync.Config{BlockSize: 4})
+	require.NoError(t, err)
+	checksums, err := g.Sign(bytes.NewReader(reference))
+	require.NoError(t, err)
+	checksums.FormatVersion = 100
+
+	_, err = r.Delta(checksums)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestOversizedRequests(t *testing.T) {
+	conn := newTestConn(t)
+
+	g, err := gosync.New(&gosync.Config{BlockSize: 4})
+	require.NoError(t, err)
+	checksums, err := g.Sign(bytes.NewReader(reference))
+	require.NoError(t, err)
+
+	checksums.ConfigBlockSize = 1 << 40
+	_, err = New(conn, "file").Delta(checksums)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	cdc, err := gosync.New(&gosync.Config{BlockSize: 64, ContentDefinedChunking: true})
+	require.NoError(t, err)
+	checksums, err = cdc.Sign(bytes.NewReader(reference))
+	require.NoError(t, err)
+
+	checksums.MaxChunkSize = 1 << 40
+	_, err = New(conn, "file").Delta(checksums)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// Every span is in range, but together they are too large.
+	spans := make([]*syncpb.MissingBlockSpan, DefaultMaxFetchBytes/(1024*1024)+1)
+	for i := range spans {
+		spans[i] = &syncpb.MissingBlockSpan{StartOffset: 0, EndOffset: 1024*1024 - 1}
+	}
+	unbounded := New(conn, "large")
+	unbounded.MaxFetchBytes = 0
+	_, err = unbounded.DoRequests(spans)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// The requester splits them into RPCs the server accepts.
+	data, err := New(conn, "large").DoRequests(spans)
+	require.NoError(t, err)
+	require.Len(t, data, len(spans))
+	for _, d := range data {
+		assert.Len(t, d, 1024*1024)
+	}
+}
+
+func TestSplitRequests(t *testing.T) {
+	r := New(newTestConn(t), "file")
+	r.MaxFetchBytes = 4
+
+	data, err := r.DoRequests([]*syncpb.MissingBlockSpan{
+		{StartOffset: 0, EndOffset: 8},
+		{StartOffset: 10, EndOffset: 14},
+		{StartOffset: 41, EndOffset: 43},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("The quick"), []byte("brown"), []byte("dog")}, data)
+
+	_, err = r.DoRequests([]*syncpb.MissingBlockSpan{{StartOffset: 4, EndOffset: 3}})
+	assert.Equal(t, codes.OutOfRange, status.Code(err))
+}
+
+func TestSyncOverGRPC(t *testing.T) {
+	local := []byte("The qwik brown fox jumped 0v3r the lazy")
+
+	// The batches of the patch are larger than the RPCs.
+	requester := New(newTestConn(t), "file")
+	requester.MaxFetchBytes = 3
+	g, err := gosync.New(&gosync.Config{BlockSize: 4, CoalesceGap: 8, Requester: requester})
+	require.NoError(t, err)
+
+	checksums, err := g.Sign(bytes.NewReader(local))
+	require.NoError(t, err)
+
+	patcher, err := requester.Delta(checksums)
+	require.NoError(t, err)
+	assert.NotEmpty(t, patcher.Found)
+	assert.NotEmpty(t, patcher.Missing)
+
+	output := bytes.NewBuffer(nil)
+	require.NoError(t, g.Patch(bytes.NewReader(local), patcher, output))
+	assert.Equal(t, reference, output.Bytes())
+}
@@ -0,0 +1,205 @@
+package grpcrequester
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/rkcloudchain/gosync"
+	"github.com/rkcloudchain/gosync/syncpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultMaxFetchBytes is the default bound of the total length of the spans of a FetchBlocks request.
+const DefaultMaxFetchBytes = 64 * 1024 * 1024
+
+// Server implements the SyncService for the files of a directory. Symbolic links are
+// followed as long as they resolve to files of the directory.
+type Server struct {
+	// MaxFetchBytes bounds the total length of the spans of a FetchBlocks request,
+	// DefaultMaxFetchBytes by default. Requesters must not be configured with a larger bound.
+	MaxFetchBytes int64
+
+	dir    string
+	config gosync.Config
+}
+
+// NewServer returns a Server of the files below dir. The configuration signs the files and
+// computes the deltas, its SizeFunc is replaced by the size of each file.
+func NewServer(dir string, c *gosync.Config) (*Server, error) {
+	s := &Server{MaxFetchBytes: DefaultMaxFetchBytes, dir: dir}
+	if c != nil {
+		s.config = *c
+	}
+
+	if _, err := gosync.New(&s.config); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// GetSignature returns the signature of a file.
+func (s *Server) GetSignature(ctx context.Context, req *syncpb.SignatureRequest) (*syncpb.ChunkChecksums, error) {
+	f, size, err := s.open(req.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	g, err := s.newGoSync(size)
+	if err != nil {
+		return nil, err
+	}
+
+	checksums, err := g.SignAtContext(ctx, f, size)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return checksums, nil
+}
+
+// ComputeDelta returns the plan patching the file of the given checksums into a file of the server.
+func (s *Server) ComputeDelta(ctx context.Context, req *syncpb.DeltaRequest) (*syncpb.PatcherBlockSpan, error) {
+	if req.Checksums == nil {
+		return nil, status.Error(codes.InvalidArgument, "Missing checksums")
+	}
+
+	f, size, err := s.open(req.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	g, err := s.newGoSync(size)
+	if err != nil {
+		return nil, err
+	}
+
+	patcher, err := g.DeltaContext(ctx, f, req.Checksums)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return patcher, nil
+}
+
+// FetchBlocks sends the data of every requested span of a file, in order.
+// The spans are checked up front, and cannot add up to more than MaxFetchBytes.
+func (s *Server) FetchBlocks(req *syncpb.FetchBlocksRequest, stream syncpb.SyncService_FetchBlocksServer) error {
+	f, size, err := s.open(req.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var total int64
+	for _, span := range req.Spans {
+		if span.StartOffset < 0 || span.EndOffset < span.StartOffset || span.EndOffset >= size {
+			return status.Errorf(codes.OutOfRange, "Invalid range %d-%d of %d bytes", span.StartOffset, span.EndOffset, size)
+		}
+
+		total += span.EndOffset - span.StartOffset + 1
+		if total > s.MaxFetchBytes {
+			return status.Errorf(codes.InvalidArgument, "Requested more than %d bytes", s.MaxFetchBytes)
+		}
+	}
+
+	for _, span := range req.Spans {
+		if err := stream.Context().Err(); err != nil {
+			return statusError(err)
+		}
+
+		data := make([]byte, span.EndOffset-span.StartOffset+1)
+		if n, err := f.ReadAt(data, span.StartOffset); n < len(data) {
+			return status.Errorf(codes.Internal, "Could not read range %d-%d: %v", span.StartOffset, span.EndOffset, err)
+		}
+
+		if err := stream.Send(&syncpb.MissingBlockSpan{StartOffset: span.StartOffset, EndOffset: span.EndOffset, Data: data}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// open opens a regular file of the directory. The name is a slash-separated path,
+// which cannot escape the directory, neither by itself nor through symbolic links.
+func (s *Server) open(name string) (*os.File, int64, error) {
+	file, err := s.resolve(name)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, 0, status.Errorf(codes.NotFound, "File %s not found", name)
+		}
+		if os.IsPermission(err) {
+			return nil, 0, status.Errorf(codes.PermissionDenied, "File %s not readable", name)
+		}
+		return nil, 0, status.Error(codes.Internal, err.Error())
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, status.Error(codes.Internal, err.Error())
+	}
+	if !info.Mode().IsRegular() {
+		f.Close()
+		return nil, 0, status.Errorf(codes.InvalidArgument, "%s is not a regular file", name)
+	}
+
+	return f, info.Size(), nil
+}
+
+// resolve returns the path of a file of the directory, with its symbolic links resolved.
+func (s *Server) resolve(name string) (string, error) {
+	root, err := filepath.EvalSymlinks(s.dir)
+	if err != nil {
+		return "", status.Error(codes.Internal, err.Error())
+	}
+
+	file, err := filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(path.Clean("/"+name))))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", status.Errorf(codes.NotFound, "File %s not found", name)
+		}
+		return "", status.Error(codes.Internal, err.Error())
+	}
+
+	if rel, err := filepath.Rel(root, file); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", status.Errorf(codes.PermissionDenied, "File %s is outside the served directory", name)
+	}
+	return file, nil
+}
+
+// newGoSync returns an instance computing deltas of a file of the given size.
+func (s *Server) newGoSync(size int64) (gosync.GoSync, error) {
+	c := s.config
+	c.SizeFunc = func() (int64, error) { return size, nil }
+
+	g, err := gosync.New(&c)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return g, nil
+}
+
+// statusError maps the errors of the library to the status codes of the service.
+func statusError(err error) error {
+	switch err.(type) {
+	case *gosync.ErrInvalidSignature, *gosync.ErrSignatureMismatch, *gosync.ErrUnsupportedFormat:
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	switch err {
+	case context.Canceled, context.DeadlineExceeded:
+		return status.FromContextError(err).Err()
+	}
+
+	return status.Error(codes.Internal, err.Error())
+}
@@ -0,0 +1,265 @@
+package gosync
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rkcloudchain/gosync/syncpb"
+	"github.com/stretchr/testify/require"
+)
+
+// errInjected is the error of the requests failed by a fakeRequester.
+var errInjected = errors.New("connection reset")
+
+// fakeRequester serves a byte slice like BytesRequester, through single requests and
+// batches, with or without a context. It records what it serves and injects the faults
+// set in its fields. A fault count decreases with every request, batch or range it
+// affects, and a negative count affects all of them. Wrap it with singleRequests or
+// withoutContext to stand for a requester without batch or context support.
+type fakeRequester struct {
+	BytesRequester
+
+	// offsets limits the faults, when set, to the ranges starting at one of them.
+	offsets []int64
+	// batchesOnly limits the faults to batches, sparing single requests.
+	batchesOnly bool
+	// failures fails requests and batches with errInjected.
+	failures int
+	// hangs blocks requests and batches until their context is done, or for a second without one.
+	hangs int
+	// short truncates the data of ranges by a byte.
+	short int
+	// corrupt flips the first byte of the data of ranges.
+	corrupt int
+	// delay slows every request and batch down.
+	delay time.Duration
+	// started, when set, is closed by the first request or batch, which then waits for release.
+	started chan struct{}
+	release chan struct{}
+	// missing are the missing spans of the plan whose output is written to the requester,
+	// which measures how much of their data is served ahead of the output.
+	missing []*syncpb.MissingBlockSpan
+
+	mu          sync.Mutex
+	gated       bool
+	ranges      [][2]int64
+	batches     [][]*syncpb.MissingBlockSpan
+	inFlight    int
+	maxInFlight int
+	served      int64
+	written     int64
+	maxAhead    int64
+}
+
+func (f *fakeRequester) DoRequest(startOffset int64, endOffset int64) ([]byte, error) {
+	return f.DoRequestContext(context.Background(), startOffset, endOffset)
+}
+
+func (f *fakeRequester) DoRequestContext(ctx context.Context, startOffset int64, endOffset int64) ([]byte, error) {
+	data, err := f.serve(ctx, []*syncpb.MissingBlockSpan{{StartOffset: startOffset, EndOffset: endOffset}}, false)
+	if err != nil {
+		return nil, err
+	}
+	return data[0], nil
+}
+
+func (f *fakeRequester) DoRequests(ranges []*syncpb.MissingBlockSpan) ([][]byte, error) {
+	return f.DoRequestsContext(context.Background(), ranges)
+}
+
+func (f *fakeRequester) DoRequestsContext(ctx context.Context, ranges []*syncpb.MissingBlockSpan) ([][]byte, error) {
+	return f.serve(ctx, ranges, true)
+}
+
+// Write records the output written by Patch.
+func (f *fakeRequester) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	f.written += int64(len(p))
+	f.mu.Unlock()
+	return len(p), nil
+}
+
+// serve answers a single request, or a batch of ranges.
+func (f *fakeRequester) serve(ctx context.Context, ranges []*syncpb.MissingBlockSpan, batch bool) ([][]byte, error) {
+	f.mu.Lock()
+	if batch {
+		f.batches = append(f.batches, ranges)
+	} else {
+		f.ranges = append(f.ranges, [2]int64{ranges[0].StartOffset, ranges[0].EndOffset})
+	}
+
+	gate := f.started != nil && !f.gated
+	f.gated = true
+	targeted := (batch || !f.batchesOnly) && f.targets(ranges...)
+	fail := targeted && take(&f.failures)
+	hang := targeted && !fail && take(&f.hangs)
+
+	f.inFlight++
+	if f.inFlight > f.maxInFlight {
+		f.maxInFlight = f.inFlight
+	}
+	for _, r := range ranges {
+		f.served += spanLength(r)
+	}
+	ahead := f.served
+	for _, block := range f.missing {
+		if block.EndOffset < f.written {
+			ahead -= spanLength(block)
+		}
+	}
+	if ahead > f.maxAhead {
+		f.maxAhead = ahead
+	}
+	f.mu.Unlock()
+
+	if gate {
+		close(f.started)
+		<-f.release
+	}
+	time.Sleep(f.delay)
+
+	f.mu.Lock()
+	f.inFlight--
+	f.mu.Unlock()
+
+	if fail {
+		return nil, errInjected
+	}
+	if hang {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Second):
+			return nil, errors.New("hung")
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data := make([][]byte, len(ranges))
+	for i, r := range ranges {
+		d, err := f.BytesRequester.DoRequest(r.StartOffset, r.EndOffset)
+		if err != nil {
+			return nil, err
+		}
+		data[i] = append([]byte(nil), d...)
+
+		if !targeted || !f.targets(r) {
+			continue
+		}
+		if take(&f.short) {
+			data[i] = data[i][:len(data[i])-1]
+		} else if take(&f.corrupt) {
+			data[i][0] ^= 0xff
+		}
+	}
+	return data, nil
+}
+
+// targets reports whether the faults apply to one of ranges.
+func (f *fakeRequester) targets(ranges ...*syncpb.MissingBlockSpan) bool {
+	if f.offsets == nil {
+		return true
+	}
+
+	for _, r := range ranges {
+		for _, offset := range f.offsets {
+			if r.StartOffset == offset {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// take uses up one of count, reporting whether there was one. Negative counts never run out.
+func take(count *int) bool {
+	if *count == 0 {
+		return false
+	}
+	if *count > 0 {
+		*count--
+	}
+	return true
+}
+
+// singleRequests hides the batch support of requester.
+func singleRequests(requester ContextBlockRequester) ContextBlockRequester {
+	return struct{ ContextBlockRequester }{requester}
+}
+
+// withoutContext hides the context support of requester.
+func withoutContext(requester BlockRequester) BlockRequester {
+	return struct{ BlockRequester }{requester}
+}
+
+// newTestGoSync returns a GoSync for config, requesting reference unless config has a requester.
+func newTestGoSync(t *testing.T, config *Config, reference []byte) GoSync {
+	if config.Requester == nil {
+		config.Requester = BytesRequester(reference)
+	}
+	if config.SizeFunc == nil {
+		config.SizeFunc = BytesRequester(reference).Size
+	}
+
+	r, err := New(config)
+	require.NoError(t, err)
+	return r
+}
+
+// randomBytes returns size bytes generated from seed.
+func randomBytes(seed int64, size int) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+// editedCopy returns reference with random insertions, deletions, overwrites and repeated blocks.
+func editedCopy(rnd *rand.Rand, reference []byte, edits int) []byte {
+	source := append([]byte(nil), reference...)
+	for i := 0; i < edits; i++ {
+		at := rnd.Intn(len(source))
+		switch rnd.Intn(4) {
+		case 0:
+			insert := make([]byte, rnd.Intn(64)+1)
+			rnd.Read(insert)
+			source = append(source[:at], append(insert, source[at:]...)...)
+		case 1:
+			end := at + rnd.Intn(64) + 1
+			if end > len(source) {
+				end = len(source)
+			}
+			source = append(source[:at], source[end:]...)
+		case 2:
+			source[at] ^= 0xff
+		case 3:
+			from := rnd.Intn(len(reference) - 256)
+			source = append(source[:at], append(append([]byte(nil), reference[from:from+256]...), source[at:]...)...)
+		}
+	}
+	return source
+}
+
+// newTestPlan returns a local file, a reference made of it with many edits, and the plan
+// from one to the other in blocks of 256 bytes and requests of at most 1024 bytes.
+func newTestPlan(t *testing.T) ([]byte, []byte, *syncpb.PatcherBlockSpan) {
+	rnd := rand.New(rand.NewSource(9))
+	local := make([]byte, 64*1024)
+	rnd.Read(local)
+	reference := editedCopy(rnd, local, 30)
+
+	r := newTestGoSync(t, &Config{BlockSize: 256, MaxRequestBlockSize: 1024}, reference)
+	checksums, err := r.Sign(bytes.NewReader(local))
+	require.NoError(t, err)
+	patcher, err := r.Delta(bytes.NewReader(reference), checksums)
+	require.NoError(t, err)
+	require.True(t, len(patcher.Missing) > 10)
+
+	return local, reference, patcher
+}
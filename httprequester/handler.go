@@ -0,0 +1,58 @@
+package httprequester
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/rkcloudchain/gosync/syncpb"
+)
+
+// Handler serves a file with support for range requests, and its signature
+// when the SignatureQuery parameter is present.
+type Handler struct {
+	name      string
+	content   io.ReaderAt
+	size      int64
+	modtime   time.Time
+	signature []byte
+}
+
+// NewHandler returns a Handler serving the size bytes of content. The signature may be nil,
+// the modification time may be zero.
+func NewHandler(name string, content io.ReaderAt, size int64, modtime time.Time, signature *syncpb.ChunkChecksums) (*Handler, error) {
+	h := &Handler{name: name, content: content, size: size, modtime: modtime}
+
+	if signature != nil {
+		data, err := proto.Marshal(signature)
+		if err != nil {
+			return nil, err
+		}
+		h.signature = data
+	}
+
+	return h, nil
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if _, ok := r.URL.Query()[SignatureQuery]; ok {
+		if h.signature == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.Write(h.signature)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, h.name, h.modtime, io.NewSectionReader(h.content, 0, h.size))
+}
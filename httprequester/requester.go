@@ -0,0 +1,254 @@
+// Package httprequester fetches blocks of a remote file with HTTP range requests,
+// and serves files and their signatures to such clients.
+package httprequester
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/rkcloudchain/gosync/syncpb"
+)
+
+// SignatureQuery is the query parameter requesting the signature of a file from a Handler.
+const SignatureQuery = "signature"
+
+// Requester is a block requester reading ranges of the file at a URL.
+type Requester struct {
+	url    string
+	client *http.Client
+}
+
+// New returns a Requester of the file at rawurl. The default client is used when client is nil.
+func New(rawurl string, client *http.Client) *Requester {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Requester{url: rawurl, client: client}
+}
+
+// DoRequest returns the bytes of the file from startOffset to endOffset, inclusive.
+func (r *Requester) DoRequest(startOffset int64, endOffset int64) ([]byte, error) {
+	return r.DoRequestContext(context.Background(), startOffset, endOffset)
+}
+
+// DoRequestContext is DoRequest with a context cancelling the HTTP request.
+func (r *Requester) DoRequestContext(ctx context.Context, startOffset int64, endOffset int64) ([]byte, error) {
+	data, err := r.DoRequestsContext(ctx, []*syncpb.MissingBlockSpan{{StartOffset: startOffset, EndOffset: endOffset}})
+	if err != nil {
+		return nil, err
+	}
+	return data[0], nil
+}
+
+// DoRequests returns the bytes of every range, with a single HTTP request.
+func (r *Requester) DoRequests(ranges []*syncpb.MissingBlockSpan) ([][]byte, error) {
+	return r.DoRequestsContext(context.Background(), ranges)
+}
+
+// DoRequestsContext is DoRequests with a context cancelling the HTTP request.
+func (r *Requester) DoRequestsContext(ctx context.Context, ranges []*syncpb.MissingBlockSpan) ([][]byte, error) {
+	specs := make([]string, len(ranges))
+	for i, rng := range ranges {
+		specs[i] = fmt.Sprintf("%d-%d", rng.StartOffset, rng.EndOffset)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	rangeHeader := "bytes=" + strings.Join(specs, ",")
+	req.Header.Set("Range", rangeHeader)
+
+	resp, err := r.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("Unexpected response status for %s: %s", rangeHeader, resp.Status)
+	}
+
+	parts, err := readParts(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([][]byte, len(ranges))
+	for i, rng := range ranges {
+		if data[i] = findRange(parts, rng.StartOffset, rng.EndOffset); data[i] == nil {
+			return nil, fmt.Errorf("Range %s missing from the response", specs[i])
+		}
+	}
+
+	return data, nil
+}
+
+// Size returns the size of the file, from the response to a HEAD request or,
+// when it has no length, from the Content-Range of a single byte request.
+func (r *Requester) Size() (int64, error) {
+	resp, err := r.client.Head(r.url)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("Unexpected response status for the size: %s", resp.Status)
+	}
+	if resp.ContentLength >= 0 {
+		return resp.ContentLength, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, r.url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Range", "bytes=0-0")
+
+	resp, err = r.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// An empty file has no byte to return, but its size is still reported.
+	if resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		return 0, fmt.Errorf("Unexpected response status for the size: %s", resp.Status)
+	}
+
+	_, _, size, err := parseContentRange(resp.Header.Get("Content-Range"))
+	return size, err
+}
+
+// Signature returns the signature of the file, as served by a Handler.
+func (r *Requester) Signature() (*syncpb.ChunkChecksums, error) {
+	u, err := url.Parse(r.url)
+	if err != nil {
+		return nil, err
+	}
+	query := u.Query()
+	query.Set(SignatureQuery, "")
+	u.RawQuery = query.Encode()
+
+	resp, err := r.client.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Unexpected response status for the signature: %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	checksums := &syncpb.ChunkChecksums{}
+	if err := proto.Unmarshal(body, checksums); err != nil {
+		return nil, fmt.Errorf("Could not decode signature: %v", err)
+	}
+	return checksums, nil
+}
+
+// part is a range of the file received in a response.
+type part struct {
+	start int64
+	data  []byte
+}
+
+// readParts returns the ranges of a partial content response, either single or multipart.
+func readParts(resp *http.Response) ([]part, error) {
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/byteranges" {
+		start, _, _, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return []part{{start: start, data: data}}, nil
+	}
+
+	var parts []part
+	reader := multipart.NewReader(resp.Body, params["boundary"])
+	for {
+		p, err := reader.NextPart()
+		if err == io.EOF {
+			return parts, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Could not read multipart response: %v", err)
+		}
+
+		start, _, _, err := parseContentRange(p.Header.Get("Content-Range"))
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := io.ReadAll(p)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read multipart response: %v", err)
+		}
+		parts = append(parts, part{start: start, data: data})
+	}
+}
+
+// findRange returns the bytes from start to end, inclusive, of the part containing them.
+func findRange(parts []part, start, end int64) []byte {
+	for _, p := range parts {
+		if start >= p.start && end < p.start+int64(len(p.data)) {
+			return p.data[start-p.start : end-p.start+1]
+		}
+	}
+	return nil
+}
+
+// parseContentRange parses a header such as "bytes 0-99/1000".
+func parseContentRange(header string) (start, end, size int64, err error) {
+	invalid := fmt.Errorf("Invalid Content-Range %q", header)
+
+	if !strings.HasPrefix(header, "bytes ") {
+		return 0, 0, 0, invalid
+	}
+
+	rng := strings.SplitN(strings.TrimPrefix(header, "bytes "), "/", 2)
+	if len(rng) != 2 {
+		return 0, 0, 0, invalid
+	}
+
+	if size, err = strconv.ParseInt(rng[1], 10, 64); err != nil {
+		return 0, 0, 0, invalid
+	}
+
+	if rng[0] == "*" {
+		return 0, -1, size, nil
+	}
+
+	bounds := strings.SplitN(rng[0], "-", 2)
+	if len(bounds) != 2 {
+		return 0, 0, 0, invalid
+	}
+
+	if start, err = strconv.ParseInt(bounds[0], 10, 64); err != nil {
+		return 0, 0, 0, invalid
+	}
+	if end, err = strconv.ParseInt(bounds[1], 10, 64); err != nil {
+		return 0, 0, 0, invalid
+	}
+
+	return start, end, size, nil
+}
@@ -0,0 +1,190 @@
+package httprequester
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rkcloudchain/gosync"
+	"github.com/rkcloudchain/gosync/syncpb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	_ gosync.ContextBlockRequester      = (*Requester)(nil)
+	_ gosync.ContextBatchBlockRequester = (*Requester)(nil)
+)
+
+// rangeRecorder records the Range headers received by a handler.
+type rangeRecorder struct {
+	handler http.Handler
+	mu      sync.Mutex
+	ranges  []string
+}
+
+func (r *rangeRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	if rng := req.Header.Get("Range"); rng != "" {
+		r.ranges = append(r.ranges, rng)
+	}
+	r.mu.Unlock()
+	r.handler.ServeHTTP(w, req)
+}
+
+func newTestServer(t *testing.T, content []byte, signature *syncpb.ChunkChecksums) (*httptest.Server, *rangeRecorder) {
+	handler, err := NewHandler("file", bytes.NewReader(content), int64(len(content)), time.Time{}, signature)
+	require.NoError(t, err)
+
+	recorder := &rangeRecorder{handler: handler}
+	return httptest.NewServer(recorder), recorder
+}
+
+func TestDoRequest(t *testing.T) {
+	content := []byte("The quick brown fox jumped over the lazy dog")
+	server, recorder := newTestServer(t, content, nil)
+	defer server.Close()
+
+	r := New(server.URL, nil)
+	data, err := r.DoRequest(4, 8)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("quick"), data)
+	assert.Equal(t, []string{"bytes=4-8"}, recorder.ranges)
+
+	_, err = r.DoRequest(40, 50)
+	assert.EqualError(t, err, "Range 40-50 missing from the response")
+
+	_, err = r.DoRequest(100, 110)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "416")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = r.DoRequestContext(ctx, 0, 3)
+	assert.Error(t, err)
+}
+
+func TestDoRequests(t *testing.T) {
+	content := []byte("The quick brown fox jumped over the lazy dog")
+	server, recorder := newTestServer(t, content, nil)
+	defer server.Close()
+
+	data, err := New(server.URL, nil).DoRequests([]*syncpb.MissingBlockSpan{
+		{StartOffset: 0, EndOffset: 2},
+		{StartOffset: 10, EndOffset: 14},
+		{StartOffset: 41, EndOffset: 43},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("The"), []byte("brown"), []byte("dog")}, data)
+	assert.Equal(t, []string{"bytes=0-2,10-14,41-43"}, recorder.ranges)
+}
+
+func TestSize(t *testing.T) {
+	content := []byte("The quick brown fox jumped over the lazy dog")
+	server, _ := newTestServer(t, content, nil)
+	defer server.Close()
+
+	size, err := New(server.URL, nil).Size()
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), size)
+
+	// A server that does not report the length of HEAD responses.
+	handler, err := NewHandler("file", bytes.NewReader(content), int64(len(content)), time.Time{}, nil)
+	require.NoError(t, err)
+	chunked := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodHead {
+			w.Header().Set("Transfer-Encoding", "chunked")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		handler.ServeHTTP(w, req)
+	}))
+	defer chunked.Close()
+
+	size, err = New(chunked.URL, nil).Size()
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), size)
+
+	empty, _ := newTestServer(t, nil, nil)
+	defer empty.Close()
+
+	size, err = New(empty.URL, nil).Size()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), size)
+}
+
+func TestSignature(t *testing.T) {
+	content := []byte("The quick brown fox jumped over the lazy dog")
+	g, err := gosync.New(&gosync.Config{BlockSize: 4})
+	require.NoError(t, err)
+
+	signature, err := g.Sign(bytes.NewReader(content))
+	require.NoError(t, err)
+
+	server, _ := newTestServer(t, content, signature)
+	defer server.Close()
+
+	checksums, err := New(server.URL, nil).Signature()
+	require.NoError(t, err)
+	assert.Equal(t, signature, checksums)
+
+	unsigned, _ := newTestServer(t, content, nil)
+	defer unsigned.Close()
+
+	_, err = New(unsigned.URL, nil).Signature()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "404")
+}
+
+func TestRangesNotSupported(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("The quick brown fox"))
+	}))
+	defer server.Close()
+
+	_, err := New(server.URL, nil).DoRequest(0, 3)
+	assert.EqualError(t, err, "Unexpected response status for bytes=0-3: 200 OK")
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	server, _ := newTestServer(t, []byte("hello"), nil)
+	defer server.Close()
+
+	resp, err := http.Post(server.URL, "text/plain", strings.NewReader("hello"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestSyncOverHTTP(t *testing.T) {
+	local := []byte("The qwik brown fox jumped 0v3r the lazy")
+	reference := []byte("The quick brown fox jumped over the lazy dog")
+
+	server, recorder := newTestServer(t, reference, nil)
+	defer server.Close()
+
+	requester := New(server.URL, nil)
+	g, err := gosync.New(&gosync.Config{
+		BlockSize:   4,
+		CoalesceGap: 8,
+		Requester:   requester,
+		SizeFunc:    requester.Size,
+	})
+	require.NoError(t, err)
+
+	checksums, err := g.Sign(bytes.NewReader(local))
+	require.NoError(t, err)
+
+	patcher, err := g.Delta(bytes.NewReader(reference), checksums)
+	require.NoError(t, err)
+
+	output := bytes.NewBuffer(nil)
+	require.NoError(t, g.Patch(bytes.NewReader(local), patcher, output))
+	assert.Equal(t, reference, output.Bytes())
+	assert.Len(t, recorder.ranges, 1)
+}
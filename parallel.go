@@ -0,0 +1,366 @@
+package gosync
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/rkcloudchain/gosync/syncpb"
+)
+
+// minSegmentBlocks is the smallest segment, in blocks, scanned by a goroutine of a parallel Delta.
+const minSegmentBlocks = 16
+
+// maxSegmentSize bounds the larger segments, whose data is held until it is emitted.
+const maxSegmentSize = 4 * 1024 * 1024
+
+// errStopScan stops a scan from one of its callbacks.
+var errStopScan = errors.New("Scan stopped")
+
+// segmentMatch holds the matches found by scanning the source from start,
+// reporting only the windows starting before end. Data holds the source from
+// start up to the end of the last of these windows.
+type segmentMatch struct {
+	start   int64
+	end     int64
+	data    []byte
+	matches []blockMatchResult
+	err     error
+	done    chan struct{}
+}
+
+// visited reports whether the scan of the segment evaluated the window at offset,
+// that is whether offset is in the segment but not inside one of its matches.
+func (s *segmentMatch) visited(offset int64) bool {
+	if offset < s.start || offset >= s.end {
+		return false
+	}
+
+	i := sort.Search(len(s.matches), func(i int) bool {
+		return s.matches[i].ComparisonOffset+s.matches[i].Size > offset
+	})
+	return i == len(s.matches) || s.matches[i].ComparisonOffset >= offset
+}
+
+// from returns the matches of the segment starting at offset or after.
+func (s *segmentMatch) from(offset int64) []blockMatchResult {
+	i := sort.Search(len(s.matches), func(i int) bool {
+		return s.matches[i].ComparisonOffset >= offset
+	})
+	return s.matches[i:]
+}
+
+// segmentSize returns the size of the segments of size bytes scanned concurrently.
+func (r *rsync) segmentSize(size, blockSize int64) int64 {
+	segmentSize := (size + int64(r.concurrency) - 1) / int64(r.concurrency)
+	if segmentSize > maxSegmentSize {
+		segmentSize = maxSegmentSize
+	}
+	if min := minSegmentBlocks * blockSize; segmentSize < min {
+		segmentSize = min
+	}
+	return segmentSize
+}
+
+// parallelScan is scan over size bytes of the source, scanning its segments concurrently.
+// The source is read once: the data of every stitched segment is written to tee, then
+// its matches and literals are reported in source order.
+func (r *rsync) parallelScan(ctx context.Context, source io.ReaderAt, size int64, checksums *syncpb.ChunkChecksums, tee io.Writer, onMatch func(blockMatchResult) error, onLiteral func(byte) error) (int64, error) {
+	segmentSize := r.segmentSize(size, checksums.ConfigBlockSize)
+
+	err := r.stitchSegments(ctx, source, size, segmentSize, checksums, func(segment *segmentMatch, from, to int64, matches []blockMatchResult) error {
+		if _, err := tee.Write(segment.data[from-segment.start : to-segment.start]); err != nil {
+			return err
+		}
+
+		literal := func(offset, end int64) error {
+			for ; offset < end; offset++ {
+				if err := onLiteral(segment.data[offset-segment.start]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		offset := from
+		for _, m := range matches {
+			if err := literal(offset, m.ComparisonOffset); err != nil {
+				return err
+			}
+			if err := onMatch(m); err != nil {
+				return err
+			}
+			offset = m.ComparisonOffset + m.Size
+		}
+		return literal(offset, to)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return size, nil
+}
+
+// matchSegments returns the same matches as match over size bytes, scanning segments of segmentSize bytes concurrently.
+func (r *rsync) matchSegments(ctx context.Context, source io.ReaderAt, size, segmentSize int64, checksums *syncpb.ChunkChecksums) ([]blockMatchResult, error) {
+	matchResult := make([]blockMatchResult, 0)
+
+	err := r.stitchSegments(ctx, source, size, segmentSize, checksums, func(segment *segmentMatch, from, to int64, matches []blockMatchResult) error {
+		matchResult = append(matchResult, matches...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return matchResult, nil
+}
+
+// stitchSegments scans the segments of the source independently, then stitches their
+// matches together. A segment scan starts at the segment offset, where the sequential
+// scan may be in the middle of a match. It is then rescanned from where the sequential
+// scan resumes, until both scans evaluate the same window and agree from there on.
+// Stitch receives, in source order, each segment with the range [from, to) of the source
+// it completes and the matches in that range.
+func (r *rsync) stitchSegments(ctx context.Context, source io.ReaderAt, size, segmentSize int64, checksums *syncpb.ChunkChecksums, stitch func(segment *segmentMatch, from, to int64, matches []blockMatchResult) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	index := makeChecksumIndex(checksums.Checksums)
+	offset := int64(0)
+
+	for segment := range r.scanSegments(ctx, source, size, segmentSize, checksums, index) {
+		<-segment.done
+		if segment.err != nil {
+			return segment.err
+		}
+
+		if offset >= segment.end {
+			continue
+		}
+
+		from := offset
+		matches := make([]blockMatchResult, 0)
+		if !segment.visited(offset) {
+			resume, err := r.scanUntil(ctx, bytes.NewReader(segment.data[offset-segment.start:]), offset, checksums, index, func(m blockMatchResult) {
+				matches = append(matches, m)
+			}, func(offset int64) bool {
+				return offset >= segment.end || segment.visited(offset)
+			})
+			if err != nil {
+				return err
+			}
+
+			offset = resume
+			if !segment.visited(resume) {
+				if err := stitch(segment, from, offset, matches); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
+		resume := offset
+		offset = segment.end
+		for _, m := range segment.from(resume) {
+			matches = append(matches, m)
+			if end := m.ComparisonOffset + m.Size; end > offset {
+				offset = end
+			}
+		}
+
+		if err := stitch(segment, from, offset, matches); err != nil {
+			return err
+		}
+	}
+
+	return ctx.Err()
+}
+
+// scanSegments scans the segments of the source with up to r.concurrency goroutines and
+// sends them in source order, before they are scanned. The receiver waits for done.
+// At most about twice r.concurrency segments, with their data, are held at a time.
+func (r *rsync) scanSegments(ctx context.Context, source io.ReaderAt, size, segmentSize int64, checksums *syncpb.ChunkChecksums, index *checksumIndex) <-chan *segmentMatch {
+	work := make(chan *segmentMatch)
+	ordered := make(chan *segmentMatch, r.concurrency)
+
+	for i := 0; i < r.concurrency; i++ {
+		go func() {
+			for segment := range work {
+				segment.err = r.scanSegment(ctx, source, size, checksums, index, segment)
+				close(segment.done)
+			}
+		}()
+	}
+
+	go func() {
+		defer close(ordered)
+		defer close(work)
+
+		for start := int64(0); start < size; start += segmentSize {
+			end := start + segmentSize
+			if end > size {
+				end = size
+			}
+
+			segment := &segmentMatch{start: start, end: end, done: make(chan struct{})}
+			select {
+			case work <- segment:
+			case <-ctx.Done():
+				return
+			}
+
+			select {
+			case ordered <- segment:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ordered
+}
+
+// scanSegment reads the data of the segment and fills its matches. The data extends a block
+// past the end of the segment, so that the scan ends on a window it does not report.
+func (r *rsync) scanSegment(ctx context.Context, source io.ReaderAt, size int64, checksums *syncpb.ChunkChecksums, index *checksumIndex, segment *segmentMatch) error {
+	end := segment.end + checksums.ConfigBlockSize
+	if end > size {
+		end = size
+	}
+
+	segment.data = make([]byte, end-segment.start)
+	if n, err := source.ReadAt(segment.data, segment.start); n < len(segment.data) {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return fmt.Errorf("Could not read segment at offset %d: %v", segment.start, err)
+	}
+
+	_, err := r.scanUntil(ctx, bytes.NewReader(segment.data), segment.start, checksums, index, func(m blockMatchResult) {
+		segment.matches = append(segment.matches, m)
+	}, func(offset int64) bool {
+		return offset >= segment.end
+	})
+	return err
+}
+
+// scanUntil scans a source positioned at offset and stops before evaluating the first window
+// for which stop returns true. It returns the offset of that window, or of the source end.
+func (r *rsync) scanUntil(ctx context.Context, source io.Reader, offset int64, checksums *syncpb.ChunkChecksums, index *checksumIndex, onMatch func(blockMatchResult), stop func(int64) bool) (int64, error) {
+	position := offset
+
+	end, err := r.scanFrom(ctx, source, offset, checksums, index, func(m blockMatchResult) error {
+		if stop(m.ComparisonOffset) {
+			position = m.ComparisonOffset
+			return errStopScan
+		}
+
+		onMatch(m)
+		position = m.ComparisonOffset + m.Size
+		return nil
+	}, func(byte) error {
+		if stop(position) {
+			return errStopScan
+		}
+
+		position++
+		return nil
+	})
+	if err == errStopScan {
+		return position, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return end, nil
+}
+
+// signBatchBlocks is the number of consecutive blocks hashed by a goroutine of createSignAt at a time.
+const signBatchBlocks = 16
+
+// createSignAt computes the checksums of the blocks of the first size bytes of dest, in block order.
+func (r *rsync) createSignAt(ctx context.Context, dest io.ReaderAt, size int64) ([]*syncpb.ChunkChecksum, error) {
+	if size < 0 {
+		return nil, fmt.Errorf("Invalid file size %d", size)
+	}
+
+	checksums := make([]*syncpb.ChunkChecksum, (size+r.blockSize-1)/r.blockSize)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	work := make(chan int)
+	errs := make(chan error, r.concurrency)
+
+	var wg sync.WaitGroup
+	for i := 0; i < r.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			strongHasher := r.strongHasher()
+			rolling := r.weakHasher.New()
+			buffer := make([]byte, r.blockSize)
+
+			for first := range work {
+				if err := ctx.Err(); err != nil {
+					errs <- err
+					return
+				}
+
+				for i := first; i < first+signBatchBlocks && i < len(checksums); i++ {
+					offset := int64(i) * r.blockSize
+					block := buffer
+					if size-offset < r.blockSize {
+						block = buffer[:size-offset]
+					}
+
+					if n, err := dest.ReadAt(block, offset); n < len(block) {
+						if err == io.EOF {
+							err = io.ErrUnexpectedEOF
+						}
+						errs <- fmt.Errorf("Could not read block %d: %v", i, err)
+						cancel()
+						return
+					}
+
+					rolling.Reset()
+					rolling.Write(block)
+					checksums[i] = &syncpb.ChunkChecksum{
+						BlockIndex: uint32(i),
+						WeakHash:   rolling.Sum32(),
+						StrongHash: computeStrongHash(strongHasher, block),
+						BlockSize:  int64(len(block)),
+						Offset:     offset,
+					}
+				}
+			}
+		}()
+	}
+
+	for first := 0; first < len(checksums); first += signBatchBlocks {
+		select {
+		case work <- first:
+		case <-ctx.Done():
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		return nil, err
+	default:
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return checksums, nil
+}
@@ -0,0 +1,154 @@
+package gosync
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"math/rand"
+	"testing"
+
+	"github.com/rkcloudchain/gosync/syncpb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchSegmentsSameAsSequential(t *testing.T) {
+	rnd := rand.New(rand.NewSource(42))
+	reference := make([]byte, 16*1024)
+	rnd.Read(reference)
+
+	for _, blockSize := range []int64{7, 64, 100} {
+		r := &rsync{blockSize: blockSize, strongHasher: md5.New, weakHasher: Adler32, concurrency: 4}
+		checksums, err := r.SignContext(context.Background(), bytes.NewReader(reference))
+		require.NoError(t, err)
+
+		for i := 0; i < 10; i++ {
+			source := editedCopy(rnd, reference, 40)
+			size := int64(len(source))
+
+			expected, err := r.match(context.Background(), bytes.NewReader(source), checksums)
+			require.NoError(t, err)
+
+			for _, segmentSize := range []int64{1, blockSize - 1, blockSize, blockSize + 1, 3*blockSize + 5, 1000, size} {
+				if segmentSize < 1 {
+					continue
+				}
+
+				actual, err := r.matchSegments(context.Background(), bytes.NewReader(source), size, segmentSize, checksums)
+				require.NoError(t, err)
+				assert.Equal(t, expected, actual, "block size %d, segment size %d", blockSize, segmentSize)
+			}
+		}
+	}
+}
+
+func TestMatchSegmentsRepeatedData(t *testing.T) {
+	block := []byte("0123456789")
+	reference := bytes.Repeat(block, 20)
+	source := append([]byte("x"), bytes.Repeat(block, 50)...)
+
+	r := &rsync{blockSize: int64(len(block)), strongHasher: md5.New, weakHasher: Adler32, concurrency: 3}
+	checksums, err := r.SignContext(context.Background(), bytes.NewReader(reference))
+	require.NoError(t, err)
+
+	expected, err := r.match(context.Background(), bytes.NewReader(source), checksums)
+	require.NoError(t, err)
+
+	for segmentSize := int64(1); segmentSize < 40; segmentSize++ {
+		actual, err := r.matchSegments(context.Background(), bytes.NewReader(source), int64(len(source)), segmentSize, checksums)
+		require.NoError(t, err)
+		assert.Equal(t, expected, actual, "segment size %d", segmentSize)
+	}
+}
+
+func TestParallelDelta(t *testing.T) {
+	rnd := rand.New(rand.NewSource(7))
+	reference := make([]byte, 256*1024)
+	rnd.Read(reference)
+	source := editedCopy(rnd, reference, 100)
+
+	delta := func(concurrency int) *syncpb.PatcherBlockSpan {
+		r, err := New(&Config{
+			BlockSize:   256,
+			Concurrency: concurrency,
+			SizeFunc:    func() (int64, error) { return int64(len(source)), nil },
+		})
+		require.NoError(t, err)
+
+		checksums, err := r.Sign(bytes.NewReader(reference))
+		require.NoError(t, err)
+
+		patcher, err := r.Delta(bytes.NewReader(source), checksums)
+		require.NoError(t, err)
+		return patcher
+	}
+
+	expected := delta(1)
+	for _, concurrency := range []int{2, 3, 8} {
+		assert.Equal(t, expected, delta(concurrency), "concurrency %d", concurrency)
+	}
+}
+
+func TestParallelMatchCancelled(t *testing.T) {
+	reference := make([]byte, 64*1024)
+	r := &rsync{blockSize: 16, strongHasher: md5.New, weakHasher: Adler32, concurrency: 4}
+	checksums, err := r.SignContext(context.Background(), bytes.NewReader(reference))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	source := make([]byte, 1024*1024)
+	_, err = r.matchSegments(ctx, bytes.NewReader(source), int64(len(source)), 128*1024, checksums)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestInvalidConcurrency(t *testing.T) {
+	_, err := New(&Config{Concurrency: -1})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Invalid concurrency")
+}
+
+func TestSignAtSameAsSign(t *testing.T) {
+	rnd := rand.New(rand.NewSource(3))
+	reference := make([]byte, 100*1024+17)
+	rnd.Read(reference)
+
+	for _, concurrency := range []int{1, 4} {
+		r, err := New(&Config{BlockSize: 512, Concurrency: concurrency, WeakHasher: Rollsum})
+		require.NoError(t, err)
+
+		for _, size := range []int{0, 1, 512, 513, len(reference)} {
+			expected, err := r.Sign(bytes.NewReader(reference[:size]))
+			require.NoError(t, err)
+
+			checksums, err := r.SignAt(bytes.NewReader(reference), int64(size))
+			require.NoError(t, err)
+			assert.Equal(t, expected, checksums, "size %d", size)
+		}
+	}
+}
+
+func TestSignAtShortFile(t *testing.T) {
+	r, err := New(&Config{BlockSize: 16, Concurrency: 2})
+	require.NoError(t, err)
+
+	_, err = r.SignAt(bytes.NewReader(make([]byte, 100)), 1000)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unexpected EOF")
+
+	_, err = r.SignAt(bytes.NewReader(nil), -1)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Invalid file size")
+}
+
+func TestSignAtCancelled(t *testing.T) {
+	r, err := New(&Config{BlockSize: 16, Concurrency: 2})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = r.SignAtContext(ctx, bytes.NewReader(make([]byte, 4096)), 4096)
+	assert.Equal(t, context.Canceled, err)
+}
@@ -3,39 +3,11 @@ package gosync
 import (
 	"bytes"
 	"crypto/sha256"
-	"io"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
-// NewReadSeekerRequester ...
-func NewReadSeekerRequester(r io.ReadSeeker) BlockRequester {
-	return &ReadSeekerRequester{rs: r}
-}
-
-// ReadSeekerRequester ...
-type ReadSeekerRequester struct {
-	rs io.ReadSeeker
-}
-
-// DoRequest ...
-func (r *ReadSeekerRequester) DoRequest(startOffset int64, endOffset int64) (data []byte, err error) {
-	length := endOffset - startOffset + 1
-	buffer := make([]byte, length)
-
-	if _, err = r.rs.Seek(startOffset, io.SeekStart); err != nil {
-		return
-	}
-
-	n, err := io.ReadFull(r.rs, buffer)
-	if err != nil && err != io.ErrUnexpectedEOF {
-		return
-	}
-
-	return buffer[:n], nil
-}
-
 func TestPatch(t *testing.T) {
 	dst := bytes.NewReader([]byte("hello world"))
 	src := []byte("Hello world: xqlun")
@@ -45,13 +17,15 @@ func TestPatch(t *testing.T) {
 
 	r := &rsync{
 		blockSize:        2,
-		strongHasher:     sha256.New(),
+		strongHasher:     sha256.New,
+		weakHasher:       Adler32,
 		requestBlockSize: 4,
 		sizeFunc:         func() (int64, error) { return int64(len(src)), nil },
-		reference:        NewReadSeekerRequester(reader),
+		reference:        NewReaderAtRequester(reader, reader.Size()),
 	}
 
-	checksums := r.Sign(dst)
+	checksums, err := r.Sign(dst)
+	assert.NoError(t, err)
 	assert.Len(t, checksums.Checksums, 6)
 
 	patcher, err := r.Delta(reader, checksums)
@@ -67,10 +41,11 @@ func TestPatchWithLocalNil(t *testing.T) {
 	reference := []byte("Raft is a consensus algorithm that is designed to be easy to understand. It's equivalent to Paxos in fault-tolerance and performance.")
 	reader := bytes.NewReader(reference)
 
-	r, err := New(&Config{BlockSize: 4, StrongHasher: sha256.New(), MaxRequestBlockSize: 128, Requester: NewReadSeekerRequester(reader), SizeFunc: func() (int64, error) { return int64(len(reference)), nil }})
+	r, err := New(&Config{BlockSize: 4, StrongHasher: sha256.New, MaxRequestBlockSize: 128, Requester: NewReaderAtRequester(reader, reader.Size()), SizeFunc: func() (int64, error) { return int64(len(reference)), nil }})
 	assert.NoError(t, err)
 
-	checksums := r.Sign(local)
+	checksums, err := r.Sign(local)
+	assert.NoError(t, err)
 	assert.Len(t, checksums.Checksums, 0)
 
 	patcher, err := r.Delta(reader, checksums)
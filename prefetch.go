@@ -0,0 +1,151 @@
+package gosync
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rkcloudchain/gosync/syncpb"
+)
+
+type prefetchResult struct {
+	data []byte
+	err  error
+}
+
+// prefetcher requests the missing spans of a plan in parallel, ahead of the
+// output, and hands their data over in plan order. The data requested but not
+// yet handed over is bounded by a memory budget.
+type prefetcher struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	blocks  []*syncpb.MissingBlockSpan
+	results []chan prefetchResult
+	next    int
+	wg      sync.WaitGroup
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	used   int64
+	budget int64
+	closed bool
+}
+
+// prefetch starts requesting blocks, with up to r.prefetchRequests requests in flight.
+// Blocks are requested in batches when the requester supports it.
+func (r *rsync) prefetch(ctx context.Context, blocks []*syncpb.MissingBlockSpan, algorithm syncpb.StrongHashAlgorithm) *prefetcher {
+	ctx, cancel := context.WithCancel(ctx)
+
+	p := &prefetcher{
+		ctx:     ctx,
+		cancel:  cancel,
+		blocks:  blocks,
+		results: make([]chan prefetchResult, len(blocks)),
+		budget:  r.prefetchMemory,
+	}
+	p.cond = sync.NewCond(&p.mu)
+	for i := range p.results {
+		p.results[i] = make(chan prefetchResult, 1)
+	}
+
+	p.wg.Add(1)
+	go p.run(r, algorithm)
+	return p
+}
+
+func (p *prefetcher) run(r *rsync, algorithm syncpb.StrongHashAlgorithm) {
+	defer p.wg.Done()
+
+	requests := r.prefetchRequests
+	if requests < 1 {
+		requests = 1
+	}
+
+	slots := make(chan struct{}, requests)
+	for _, batch := range r.batches(p.blocks) {
+		var length int64
+		for _, block := range p.blocks[batch.start:batch.end] {
+			length += spanLength(block)
+		}
+
+		if !p.acquire(length) {
+			return
+		}
+
+		select {
+		case slots <- struct{}{}:
+		case <-p.ctx.Done():
+			return
+		}
+
+		p.wg.Add(1)
+		go func(batch spanBatch) {
+			defer p.wg.Done()
+			data, err := r.requestBatch(p.ctx, p.blocks[batch.start:batch.end], algorithm)
+			<-slots
+			for i := batch.start; i < batch.end; i++ {
+				if err != nil {
+					p.results[i] <- prefetchResult{err: err}
+				} else {
+					p.results[i] <- prefetchResult{data: data[i-batch.start]}
+				}
+			}
+		}(batch)
+	}
+}
+
+// Next returns the data of the next missing span of the plan. The data returned
+// by the previous call is no longer accounted for, as it has been written.
+func (p *prefetcher) Next() ([]byte, error) {
+	if p.next > 0 {
+		p.release(spanLength(p.blocks[p.next-1]))
+	}
+
+	var result prefetchResult
+	select {
+	case result = <-p.results[p.next]:
+	case <-p.ctx.Done():
+		return nil, p.ctx.Err()
+	}
+
+	p.next++
+	return result.data, result.err
+}
+
+// Close stops the pending requests and waits for them.
+func (p *prefetcher) Close() {
+	p.cancel()
+
+	p.mu.Lock()
+	p.closed = true
+	p.cond.Broadcast()
+	p.mu.Unlock()
+
+	p.wg.Wait()
+}
+
+// acquire waits until n bytes fit in the budget, or nothing else is held.
+func (p *prefetcher) acquire(n int64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for !p.closed && p.used > 0 && p.used+n > p.budget {
+		p.cond.Wait()
+	}
+	if p.closed {
+		return false
+	}
+
+	p.used += n
+	return true
+}
+
+func (p *prefetcher) release(n int64) {
+	p.mu.Lock()
+	p.used -= n
+	p.cond.Broadcast()
+	p.mu.Unlock()
+}
+
+func spanLength(block *syncpb.MissingBlockSpan) int64 {
+	return block.EndOffset - block.StartOffset + 1
+}
@@ -0,0 +1,73 @@
+package gosync
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPatchPrefetch(t *testing.T) {
+	local, reference, patcher := newTestPlan(t)
+
+	requester := &fakeRequester{BytesRequester: reference, delay: time.Millisecond}
+	r, err := New(&Config{BlockSize: 256, PrefetchRequests: 4, Requester: singleRequests(requester)})
+	require.NoError(t, err)
+
+	output := bytes.NewBuffer(nil)
+	require.NoError(t, r.Patch(bytes.NewReader(local), patcher, output))
+	assert.Equal(t, reference, output.Bytes())
+	assert.True(t, requester.maxInFlight > 1)
+	assert.True(t, requester.maxInFlight <= 4)
+}
+
+func TestPatchPrefetchMemoryBudget(t *testing.T) {
+	local, reference, patcher := newTestPlan(t)
+
+	requester := &fakeRequester{BytesRequester: reference, missing: patcher.Missing, delay: time.Millisecond}
+	r, err := New(&Config{BlockSize: 256, PrefetchRequests: 8, PrefetchMemory: 2048, Requester: singleRequests(requester)})
+	require.NoError(t, err)
+
+	require.NoError(t, r.Patch(bytes.NewReader(local), patcher, requester))
+	assert.Equal(t, int64(len(reference)), requester.written)
+	assert.True(t, requester.maxAhead <= 2048, "%d bytes ahead", requester.maxAhead)
+	assert.True(t, requester.maxInFlight > 1)
+
+	requester = &fakeRequester{BytesRequester: reference}
+	r, err = New(&Config{BlockSize: 256, PrefetchRequests: 8, PrefetchMemory: 1, Requester: singleRequests(requester)})
+	require.NoError(t, err)
+
+	require.NoError(t, r.Patch(bytes.NewReader(local), patcher, requester))
+	assert.Equal(t, int64(len(reference)), requester.written)
+	assert.Equal(t, 1, requester.maxInFlight)
+}
+
+func TestPatchPrefetchError(t *testing.T) {
+	local, reference, patcher := newTestPlan(t)
+
+	failed := patcher.Missing[len(patcher.Missing)/2]
+	requester := &fakeRequester{BytesRequester: reference, offsets: []int64{failed.StartOffset}, failures: -1}
+	r, err := New(&Config{BlockSize: 256, PrefetchRequests: 4, Requester: singleRequests(requester)})
+	require.NoError(t, err)
+
+	err = r.Patch(bytes.NewReader(local), patcher, bytes.NewBuffer(nil))
+	assert.EqualError(t, err, "Failed to read from reference file: connection reset")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = r.PatchContext(ctx, bytes.NewReader(local), patcher, bytes.NewBuffer(nil))
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestInvalidPrefetch(t *testing.T) {
+	_, err := New(&Config{PrefetchRequests: -1})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Invalid prefetch requests")
+
+	_, err = New(&Config{PrefetchMemory: -1})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Invalid prefetch memory")
+}
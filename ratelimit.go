@@ -0,0 +1,212 @@
+package gosync
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rkcloudchain/gosync/syncpb"
+)
+
+// Limiter bounds the bandwidth and the request rate of the requesters sharing it, with
+// token buckets holding up to one second of each rate. Its rates can be changed at any time.
+// A rate of 0 means no limit.
+type Limiter struct {
+	mu       sync.Mutex
+	bytes    bucket
+	requests bucket
+}
+
+// bucket is a token bucket whose tokens may be borrowed: a reservation larger than the
+// available tokens leaves a debt, which later reservations wait for.
+type bucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter returns a Limiter of bytesPerSecond and requestsPerSecond, 0 meaning no limit.
+func NewLimiter(bytesPerSecond, requestsPerSecond float64) (*Limiter, error) {
+	l := &Limiter{}
+	if err := l.SetBytesPerSecond(bytesPerSecond); err != nil {
+		return nil, err
+	}
+	if err := l.SetRequestsPerSecond(requestsPerSecond); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// SetBytesPerSecond changes the bandwidth limit. Requests already waiting keep their delay.
+func (l *Limiter) SetBytesPerSecond(rate float64) error {
+	if rate < 0 {
+		return fmt.Errorf("Invalid bytes rate %v", rate)
+	}
+
+	l.mu.Lock()
+	l.bytes.setRate(rate, time.Now())
+	l.mu.Unlock()
+	return nil
+}
+
+// SetRequestsPerSecond changes the request rate limit. Requests already waiting keep their delay.
+func (l *Limiter) SetRequestsPerSecond(rate float64) error {
+	if rate < 0 {
+		return fmt.Errorf("Invalid requests rate %v", rate)
+	}
+
+	l.mu.Lock()
+	l.requests.setRate(rate, time.Now())
+	l.mu.Unlock()
+	return nil
+}
+
+// Wait blocks until a request of n bytes is allowed, or ctx is done.
+func (l *Limiter) Wait(ctx context.Context, n int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	l.mu.Lock()
+	delay := l.bytes.reserve(float64(n), now)
+	if d := l.requests.reserve(1, now); d > delay {
+		delay = d
+	}
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		l.bytes.cancel(float64(n))
+		l.requests.cancel(1)
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// advance adds the tokens earned since the last update, up to one second of the rate.
+func (b *bucket) advance(now time.Time) {
+	if b.rate == 0 {
+		return
+	}
+
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * b.rate
+		if b.tokens > b.rate {
+			b.tokens = b.rate
+		}
+	}
+	b.last = now
+}
+
+func (b *bucket) setRate(rate float64, now time.Time) {
+	b.advance(now)
+
+	if b.rate == 0 {
+		// A bucket becoming limited starts full.
+		b.tokens = rate
+		b.last = now
+	} else if b.tokens > rate {
+		b.tokens = rate
+	}
+	b.rate = rate
+}
+
+// reserve takes n tokens and returns how long to wait for them.
+func (b *bucket) reserve(n float64, now time.Time) time.Duration {
+	if b.rate == 0 {
+		return 0
+	}
+
+	b.advance(now)
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// cancel gives back the tokens of a reservation that is not used.
+func (b *bucket) cancel(n float64) {
+	if b.rate == 0 {
+		return
+	}
+
+	if b.tokens += n; b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+}
+
+// RateLimitedRequester is a BlockRequester waiting for a Limiter before every request
+// of another requester. Batches of ranges count as a single request of their total length
+// when the other requester is a BatchBlockRequester.
+type RateLimitedRequester struct {
+	requester BlockRequester
+	limiter   *Limiter
+}
+
+// NewRateLimitedRequester returns a RateLimitedRequester around requester. The limiter may
+// be shared with other requesters, to bound them together.
+func NewRateLimitedRequester(requester BlockRequester, limiter *Limiter) *RateLimitedRequester {
+	return &RateLimitedRequester{requester: requester, limiter: limiter}
+}
+
+// DoRequest requests a range once the limiter allows it.
+func (r *RateLimitedRequester) DoRequest(startOffset int64, endOffset int64) ([]byte, error) {
+	return r.DoRequestContext(context.Background(), startOffset, endOffset)
+}
+
+// DoRequestContext requests a range once the limiter allows it, or fails when ctx is done first.
+func (r *RateLimitedRequester) DoRequestContext(ctx context.Context, startOffset int64, endOffset int64) ([]byte, error) {
+	if err := r.limiter.Wait(ctx, endOffset-startOffset+1); err != nil {
+		return nil, err
+	}
+	return doRequest(ctx, r.requester, startOffset, endOffset)
+}
+
+// DoRequests requests a batch of ranges once the limiter allows it.
+func (r *RateLimitedRequester) DoRequests(ranges []*syncpb.MissingBlockSpan) ([][]byte, error) {
+	return r.DoRequestsContext(context.Background(), ranges)
+}
+
+// DoRequestsContext requests a batch of ranges once the limiter allows it, or fails when ctx
+// is done first. Without batch support in the other requester, every range waits on its own.
+func (r *RateLimitedRequester) DoRequestsContext(ctx context.Context, ranges []*syncpb.MissingBlockSpan) ([][]byte, error) {
+	requester, ok := r.requester.(BatchBlockRequester)
+	if !ok {
+		data := make([][]byte, len(ranges))
+		for i, rng := range ranges {
+			var err error
+			if data[i], err = r.DoRequestContext(ctx, rng.StartOffset, rng.EndOffset); err != nil {
+				return nil, err
+			}
+		}
+		return data, nil
+	}
+
+	var length int64
+	for _, rng := range ranges {
+		length += rng.EndOffset - rng.StartOffset + 1
+	}
+	if err := r.limiter.Wait(ctx, length); err != nil {
+		return nil, err
+	}
+	return doRequests(ctx, requester, ranges)
+}
+
+// batching reports whether batches are requested as such from the other requester.
+func (r *RateLimitedRequester) batching() bool {
+	return supportsBatches(r.requester)
+}
@@ -0,0 +1,173 @@
+package gosync
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rkcloudchain/gosync/syncpb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	_ ContextBlockRequester      = (*RateLimitedRequester)(nil)
+	_ ContextBatchBlockRequester = (*RateLimitedRequester)(nil)
+)
+
+func TestBucket(t *testing.T) {
+	now := time.Now()
+	b := &bucket{}
+
+	assert.Equal(t, time.Duration(0), b.reserve(1000, now))
+
+	b.setRate(100, now)
+	assert.Equal(t, time.Duration(0), b.reserve(60, now))
+	assert.Equal(t, time.Duration(0), b.reserve(40, now))
+	assert.Equal(t, 500*time.Millisecond, b.reserve(50, now))
+	assert.Equal(t, time.Second, b.reserve(50, now))
+
+	// Tokens are earned back over time, up to one second of the rate.
+	assert.Equal(t, time.Duration(0), b.reserve(0, now.Add(time.Second)))
+	assert.Equal(t, time.Duration(0), b.reserve(100, now.Add(10*time.Second)))
+	assert.Equal(t, 100*time.Millisecond, b.reserve(10, now.Add(10*time.Second)))
+
+	b.cancel(10)
+	assert.Equal(t, time.Duration(0), b.reserve(0, now.Add(10*time.Second)))
+
+	// A lower rate caps the tokens.
+	b.setRate(10, now.Add(20*time.Second))
+	assert.Equal(t, time.Second, b.reserve(20, now.Add(20*time.Second)))
+}
+
+func TestRateLimitedRequesterBytes(t *testing.T) {
+	limiter, err := NewLimiter(100000, 0)
+	require.NoError(t, err)
+	r := NewRateLimitedRequester(BytesRequester(make([]byte, 200000)), limiter)
+
+	start := time.Now()
+	for i := int64(0); i < 3; i++ {
+		data, err := r.DoRequest(i*50000, i*50000+49999)
+		require.NoError(t, err)
+		assert.Len(t, data, 50000)
+	}
+	assert.True(t, time.Since(start) >= 450*time.Millisecond, "%v elapsed", time.Since(start))
+}
+
+func TestRateLimitedRequesterRequests(t *testing.T) {
+	limiter, err := NewLimiter(0, 20)
+	require.NoError(t, err)
+	r := NewRateLimitedRequester(BytesRequester(make([]byte, 16)), limiter)
+
+	start := time.Now()
+	for i := 0; i < 30; i++ {
+		_, err := r.DoRequest(0, 15)
+		require.NoError(t, err)
+	}
+	assert.True(t, time.Since(start) >= 450*time.Millisecond, "%v elapsed", time.Since(start))
+}
+
+func TestRateLimitedRequesterBatches(t *testing.T) {
+	limiter, err := NewLimiter(1000000, 0)
+	require.NoError(t, err)
+
+	fake := &fakeRequester{BytesRequester: make([]byte, 1500000)}
+	r := NewRateLimitedRequester(fake, limiter)
+	assert.True(t, supportsBatches(r))
+	assert.False(t, supportsBatches(NewRateLimitedRequester(BytesRequester(nil), limiter)))
+
+	// The batch is charged for its total length.
+	start := time.Now()
+	data, err := r.DoRequests([]*syncpb.MissingBlockSpan{
+		{StartOffset: 0, EndOffset: 499999},
+		{StartOffset: 500000, EndOffset: 999999},
+		{StartOffset: 1000000, EndOffset: 1499999},
+	})
+	require.NoError(t, err)
+	assert.Len(t, data, 3)
+	assert.True(t, time.Since(start) >= 450*time.Millisecond, "%v elapsed", time.Since(start))
+	assert.Len(t, fake.batches, 1)
+	assert.Empty(t, fake.ranges)
+}
+
+func TestSharedLimiter(t *testing.T) {
+	limiter, err := NewLimiter(100000, 0)
+	require.NoError(t, err)
+
+	content := make([]byte, 100000)
+	requesters := []*RateLimitedRequester{
+		NewRateLimitedRequester(BytesRequester(content), limiter),
+		NewRateLimitedRequester(BytesRequester(content), limiter),
+	}
+
+	// Together the requesters get 150000 bytes, which take at least half a second.
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, r := range requesters {
+		wg.Add(1)
+		go func(r *RateLimitedRequester) {
+			defer wg.Done()
+			for i := int64(0); i < 3; i++ {
+				_, err := r.DoRequest(i*25000, i*25000+24999)
+				assert.NoError(t, err)
+			}
+		}(r)
+	}
+	wg.Wait()
+	assert.True(t, time.Since(start) >= 450*time.Millisecond, "%v elapsed", time.Since(start))
+}
+
+func TestLimiterAdjust(t *testing.T) {
+	limiter, err := NewLimiter(0, 0)
+	require.NoError(t, err)
+	r := NewRateLimitedRequester(BytesRequester(make([]byte, 1000)), limiter)
+
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		_, err := r.DoRequest(0, 999)
+		require.NoError(t, err)
+	}
+	assert.True(t, time.Since(start) < 100*time.Millisecond)
+
+	require.NoError(t, limiter.SetBytesPerSecond(1000))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = r.DoRequestContext(ctx, 0, 999)
+	require.NoError(t, err)
+	_, err = r.DoRequestContext(ctx, 0, 999)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// The cancelled request gave its tokens back, and no limit applies anymore.
+	require.NoError(t, limiter.SetBytesPerSecond(0))
+	_, err = r.DoRequest(0, 999)
+	require.NoError(t, err)
+
+	assert.Error(t, limiter.SetBytesPerSecond(-1))
+	assert.Error(t, limiter.SetRequestsPerSecond(-1))
+	_, err = NewLimiter(-1, 0)
+	assert.EqualError(t, err, "Invalid bytes rate -1")
+}
+
+func TestPatchRateLimited(t *testing.T) {
+	local, reference, patcher := newTestPlan(t)
+
+	var missing int64
+	for _, block := range patcher.Missing {
+		missing += spanLength(block)
+	}
+
+	// The missing data takes about two seconds at this rate, one of which is the initial burst.
+	limiter, err := NewLimiter(float64(missing)/2, 0)
+	require.NoError(t, err)
+
+	r, err := New(&Config{BlockSize: 256, PrefetchRequests: 4, Requester: NewRateLimitedRequester(BytesRequester(reference), limiter)})
+	require.NoError(t, err)
+
+	start := time.Now()
+	output := bytes.NewBuffer(nil)
+	require.NoError(t, r.Patch(bytes.NewReader(local), patcher, output))
+	assert.Equal(t, reference, output.Bytes())
+	assert.True(t, time.Since(start) >= 900*time.Millisecond, "%v elapsed", time.Since(start))
+}
@@ -0,0 +1,89 @@
+package gosync
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// ReaderAtRequester is a block requester reading ranges of an io.ReaderAt.
+// It is safe for concurrent use when the reader is.
+type ReaderAtRequester struct {
+	reader io.ReaderAt
+	size   int64
+}
+
+// NewReaderAtRequester returns a requester of the first size bytes of reader.
+func NewReaderAtRequester(reader io.ReaderAt, size int64) *ReaderAtRequester {
+	return &ReaderAtRequester{reader: reader, size: size}
+}
+
+// DoRequest returns the bytes from startOffset to endOffset, inclusive.
+func (r *ReaderAtRequester) DoRequest(startOffset int64, endOffset int64) ([]byte, error) {
+	if err := checkRange(startOffset, endOffset, r.size); err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, endOffset-startOffset+1)
+	if n, err := r.reader.ReadAt(data, startOffset); n < len(data) {
+		return nil, fmt.Errorf("Could not read range %d-%d: %v", startOffset, endOffset, err)
+	}
+	return data, nil
+}
+
+// Size returns the size of the content, it can be used as the SizeFunc of a Config.
+func (r *ReaderAtRequester) Size() (int64, error) {
+	return r.size, nil
+}
+
+// FileRequester is a block requester reading ranges of a local file.
+// It is safe for concurrent use.
+type FileRequester struct {
+	ReaderAtRequester
+	file *os.File
+}
+
+// NewFileRequester opens the named file, whose size is the one at the time it is opened.
+func NewFileRequester(name string) (*FileRequester, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &FileRequester{ReaderAtRequester: ReaderAtRequester{reader: file, size: info.Size()}, file: file}, nil
+}
+
+// Close closes the file.
+func (f *FileRequester) Close() error {
+	return f.file.Close()
+}
+
+// BytesRequester is a block requester reading ranges of a byte slice.
+// It is safe for concurrent use as long as the slice is not modified.
+type BytesRequester []byte
+
+// DoRequest returns a copy of the bytes from startOffset to endOffset, inclusive.
+func (b BytesRequester) DoRequest(startOffset int64, endOffset int64) ([]byte, error) {
+	if err := checkRange(startOffset, endOffset, int64(len(b))); err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), b[startOffset:endOffset+1]...), nil
+}
+
+// Size returns the length of the slice, it can be used as the SizeFunc of a Config.
+func (b BytesRequester) Size() (int64, error) {
+	return int64(len(b)), nil
+}
+
+func checkRange(startOffset, endOffset, size int64) error {
+	if startOffset < 0 || endOffset < startOffset || endOffset >= size {
+		return fmt.Errorf("Invalid range %d-%d of %d bytes", startOffset, endOffset, size)
+	}
+	return nil
+}
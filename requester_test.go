@@ -0,0 +1,117 @@
+package gosync
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	_ BlockRequester = (*ReaderAtRequester)(nil)
+	_ BlockRequester = (*FileRequester)(nil)
+	_ BlockRequester = BytesRequester(nil)
+)
+
+func TestReaderAtRequester(t *testing.T) {
+	content := []byte("The quick brown fox jumped over the lazy dog")
+	r := NewReaderAtRequester(bytes.NewReader(content), int64(len(content)))
+
+	data, err := r.DoRequest(4, 8)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("quick"), data)
+
+	size, err := r.Size()
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), size)
+
+	_, err = r.DoRequest(40, 50)
+	assert.EqualError(t, err, "Invalid range 40-50 of 44 bytes")
+
+	_, err = r.DoRequest(8, 4)
+	assert.Error(t, err)
+
+	// The size may claim more than the reader holds.
+	_, err = NewReaderAtRequester(bytes.NewReader(content), 100).DoRequest(40, 50)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Could not read range 40-50")
+}
+
+func TestBytesRequester(t *testing.T) {
+	content := []byte("The quick brown fox jumped over the lazy dog")
+	r := BytesRequester(content)
+
+	data, err := r.DoRequest(41, 43)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("dog"), data)
+
+	data[0] = 'h'
+	assert.Equal(t, content[41], byte('d'))
+
+	_, err = r.DoRequest(-1, 2)
+	assert.Error(t, err)
+}
+
+func TestFileRequester(t *testing.T) {
+	local := []byte("The qwik brown fox jumped 0v3r the lazy")
+	reference := []byte("The quick brown fox jumped over the lazy dog")
+
+	dir, err := os.MkdirTemp("", "gosync")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "reference")
+	require.NoError(t, os.WriteFile(name, reference, 0644))
+
+	requester, err := NewFileRequester(name)
+	require.NoError(t, err)
+	defer requester.Close()
+
+	r, err := New(&Config{BlockSize: 4, PrefetchRequests: 4, Requester: requester, SizeFunc: requester.Size})
+	require.NoError(t, err)
+
+	checksums, err := r.Sign(bytes.NewReader(local))
+	require.NoError(t, err)
+
+	patcher, err := r.Delta(bytes.NewReader(reference), checksums)
+	require.NoError(t, err)
+
+	output := bytes.NewBuffer(nil)
+	require.NoError(t, r.Patch(bytes.NewReader(local), patcher, output))
+	assert.Equal(t, reference, output.Bytes())
+
+	_, err = NewFileRequester(filepath.Join(dir, "missing"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRequestersConcurrent(t *testing.T) {
+	content := make([]byte, 4096)
+	for i := range content {
+		content[i] = byte(i)
+	}
+
+	requesters := []BlockRequester{
+		NewReaderAtRequester(bytes.NewReader(content), int64(len(content))),
+		BytesRequester(content),
+	}
+
+	for _, requester := range requesters {
+		var wg sync.WaitGroup
+		for i := 0; i < 16; i++ {
+			wg.Add(1)
+			go func(start int64) {
+				defer wg.Done()
+				for offset := start; offset+64 <= int64(len(content)); offset += 256 {
+					data, err := requester.DoRequest(offset, offset+63)
+					assert.NoError(t, err)
+					assert.Equal(t, content[offset:offset+64], data)
+				}
+			}(int64(i) * 16)
+		}
+		wg.Wait()
+	}
+}
@@ -0,0 +1,218 @@
+package gosync
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/rkcloudchain/gosync/logging"
+	"github.com/rkcloudchain/gosync/syncpb"
+)
+
+const (
+	defaultRetryAttempts       = 3
+	defaultRetryInitialBackoff = 100 * time.Millisecond
+	defaultRetryMaxBackoff     = 10 * time.Second
+)
+
+// RetryConfig contains the parameters of a RetryRequester.
+type RetryConfig struct {
+	// Attempts is the maximum number of requests of a range, 3 by default.
+	Attempts int
+
+	// InitialBackoff is the delay before the first retry, 100ms by default.
+	// It doubles after every failed attempt.
+	InitialBackoff time.Duration
+
+	// MaxBackoff bounds the delay between two attempts, 10s by default.
+	MaxBackoff time.Duration
+
+	// Jitter is the fraction of every delay that is randomized, between 0 and 1.
+	Jitter float64
+
+	// Timeout bounds the duration of every attempt, 0 means no limit.
+	Timeout time.Duration
+
+	// Retryable reports whether a request failing with err may be attempted again.
+	// All errors are retried when it is nil.
+	Retryable func(err error) bool
+}
+
+func (c *RetryConfig) validate() error {
+	if c.Attempts < 0 {
+		return fmt.Errorf("Invalid retry attempts %d", c.Attempts)
+	}
+
+	if c.Attempts == 0 {
+		c.Attempts = defaultRetryAttempts
+	}
+
+	if c.InitialBackoff < 0 || c.MaxBackoff < 0 {
+		return fmt.Errorf("Invalid retry backoff %v-%v", c.InitialBackoff, c.MaxBackoff)
+	}
+
+	if c.InitialBackoff == 0 {
+		c.InitialBackoff = defaultRetryInitialBackoff
+	}
+
+	if c.MaxBackoff == 0 {
+		c.MaxBackoff = defaultRetryMaxBackoff
+	}
+
+	if c.Jitter < 0 || c.Jitter > 1 {
+		return fmt.Errorf("Invalid retry jitter %v", c.Jitter)
+	}
+
+	if c.Timeout < 0 {
+		return fmt.Errorf("Invalid retry timeout %v", c.Timeout)
+	}
+
+	return nil
+}
+
+// RetryRequester is a BlockRequester requesting ranges again from another
+// requester when it fails, waiting longer after every failure. It retries whole
+// batches when the other requester is a BatchBlockRequester.
+type RetryRequester struct {
+	requester BlockRequester
+	config    RetryConfig
+}
+
+// NewRetryRequester returns a RetryRequester around requester given configuration.
+func NewRetryRequester(requester BlockRequester, c *RetryConfig) (*RetryRequester, error) {
+	config := *c
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	return &RetryRequester{requester: requester, config: config}, nil
+}
+
+// DoRequest requests a range until it succeeds or the attempts are exhausted.
+func (r *RetryRequester) DoRequest(startOffset int64, endOffset int64) ([]byte, error) {
+	return r.DoRequestContext(context.Background(), startOffset, endOffset)
+}
+
+// DoRequestContext requests a range until it succeeds, the attempts are exhausted or ctx is done.
+func (r *RetryRequester) DoRequestContext(ctx context.Context, startOffset int64, endOffset int64) ([]byte, error) {
+	_, cancellable := r.requester.(ContextBlockRequester)
+	data, err := r.retry(ctx, fmt.Sprintf("range %d-%d", startOffset, endOffset), cancellable, func(ctx context.Context) (interface{}, error) {
+		return doRequest(ctx, r.requester, startOffset, endOffset)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data.([]byte), nil
+}
+
+// DoRequests requests a batch of ranges until it succeeds or the attempts are exhausted.
+func (r *RetryRequester) DoRequests(ranges []*syncpb.MissingBlockSpan) ([][]byte, error) {
+	return r.DoRequestsContext(context.Background(), ranges)
+}
+
+// DoRequestsContext requests a batch of ranges until it succeeds, the attempts are exhausted
+// or ctx is done. Without batch support in the other requester, every range is retried on its own.
+func (r *RetryRequester) DoRequestsContext(ctx context.Context, ranges []*syncpb.MissingBlockSpan) ([][]byte, error) {
+	requester, ok := r.requester.(BatchBlockRequester)
+	if !ok {
+		data := make([][]byte, len(ranges))
+		for i, rng := range ranges {
+			var err error
+			if data[i], err = r.DoRequestContext(ctx, rng.StartOffset, rng.EndOffset); err != nil {
+				return nil, err
+			}
+		}
+		return data, nil
+	}
+
+	_, cancellable := r.requester.(ContextBatchBlockRequester)
+	data, err := r.retry(ctx, fmt.Sprintf("batch of %d ranges", len(ranges)), cancellable, func(ctx context.Context) (interface{}, error) {
+		return doRequests(ctx, requester, ranges)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data.([][]byte), nil
+}
+
+// batching reports whether batches are requested as such from the other requester.
+func (r *RetryRequester) batching() bool {
+	return supportsBatches(r.requester)
+}
+
+// retry makes a request until it succeeds, the attempts are exhausted or ctx is done,
+// waiting longer after every failure.
+func (r *RetryRequester) retry(ctx context.Context, what string, cancellable bool, request func(context.Context) (interface{}, error)) (interface{}, error) {
+	backoff := r.config.InitialBackoff
+	if backoff > r.config.MaxBackoff {
+		backoff = r.config.MaxBackoff
+	}
+
+	for attempt := 1; ; attempt++ {
+		data, err := r.attempt(ctx, cancellable, request)
+		if err == nil {
+			return data, nil
+		}
+
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+
+		if r.config.Retryable != nil && !r.config.Retryable(err) {
+			return nil, err
+		}
+
+		if attempt >= r.config.Attempts {
+			return nil, fmt.Errorf("Request of %s failed after %d attempts: %v", what, attempt, err)
+		}
+
+		delay := backoff - time.Duration(r.config.Jitter*rand.Float64()*float64(backoff))
+		logging.Warningf("Request of %s failed, retrying in %v: %v", what, delay, err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+
+		if backoff *= 2; backoff > r.config.MaxBackoff {
+			backoff = r.config.MaxBackoff
+		}
+	}
+}
+
+// attempt makes a request once, within the attempt timeout. A request that cannot be
+// cancelled is left running in the background when the timeout expires.
+func (r *RetryRequester) attempt(ctx context.Context, cancellable bool, request func(context.Context) (interface{}, error)) (interface{}, error) {
+	if r.config.Timeout == 0 {
+		return request(ctx)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.config.Timeout)
+	defer cancel()
+
+	if cancellable {
+		return request(ctx)
+	}
+
+	type result struct {
+		data interface{}
+		err  error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		data, err := request(context.Background())
+		done <- result{data, err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.data, res.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,154 @@
+package gosync
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rkcloudchain/gosync/syncpb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryRequester(t *testing.T) {
+	fake := &fakeRequester{BytesRequester: []byte("hello world"), failures: 2}
+	r, err := NewRetryRequester(fake, &RetryConfig{InitialBackoff: time.Millisecond, Jitter: 0.5})
+	require.NoError(t, err)
+
+	data, err := r.DoRequest(0, 4)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("hello"), data)
+	assert.Equal(t, 3, len(fake.ranges))
+
+	fake = &fakeRequester{BytesRequester: []byte("hello world"), failures: 3}
+	r, err = NewRetryRequester(fake, &RetryConfig{InitialBackoff: time.Millisecond})
+	require.NoError(t, err)
+
+	_, err = r.DoRequest(6, 10)
+	assert.EqualError(t, err, "Request of range 6-10 failed after 3 attempts: connection reset")
+	assert.Equal(t, 3, len(fake.ranges))
+}
+
+func TestRetryRequesterNotRetryable(t *testing.T) {
+	fake := &fakeRequester{BytesRequester: []byte("hello world"), failures: 1}
+	r, err := NewRetryRequester(fake, &RetryConfig{
+		InitialBackoff: time.Millisecond,
+		Retryable:      func(err error) bool { return err != errInjected },
+	})
+	require.NoError(t, err)
+
+	_, err = r.DoRequest(0, 4)
+	assert.Equal(t, errInjected, err)
+	assert.Equal(t, 1, len(fake.ranges))
+}
+
+func TestRetryRequesterTimeout(t *testing.T) {
+	fake := &fakeRequester{BytesRequester: []byte("hello world"), hangs: 1}
+	r, err := NewRetryRequester(fake, &RetryConfig{InitialBackoff: time.Millisecond, Timeout: 10 * time.Millisecond})
+	require.NoError(t, err)
+
+	start := time.Now()
+	data, err := r.DoRequest(0, 4)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("hello"), data)
+	assert.True(t, time.Since(start) < time.Second)
+
+	fake = &fakeRequester{BytesRequester: []byte("hello world"), hangs: 1}
+	r, err = NewRetryRequester(withoutContext(fake), &RetryConfig{InitialBackoff: time.Millisecond, Timeout: 10 * time.Millisecond})
+	require.NoError(t, err)
+
+	start = time.Now()
+	data, err = r.DoRequest(0, 4)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("hello"), data)
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestRetryRequesterBackoff(t *testing.T) {
+	fake := &fakeRequester{BytesRequester: []byte("hello world"), failures: 3}
+	r, err := NewRetryRequester(fake, &RetryConfig{Attempts: 4, InitialBackoff: 20 * time.Millisecond, MaxBackoff: 30 * time.Millisecond})
+	require.NoError(t, err)
+
+	start := time.Now()
+	_, err = r.DoRequest(0, 4)
+	require.NoError(t, err)
+	assert.True(t, time.Since(start) >= 80*time.Millisecond)
+}
+
+func TestRetryRequesterCancelled(t *testing.T) {
+	fake := &fakeRequester{BytesRequester: []byte("hello world"), failures: 10}
+	r, err := NewRetryRequester(fake, &RetryConfig{Attempts: 10, InitialBackoff: time.Hour})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = r.DoRequestContext(ctx, 0, 4)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, 1, len(fake.ranges))
+}
+
+func TestRetryRequesterPatch(t *testing.T) {
+	local := []byte("The qwik brown fox jumped 0v3r the lazy")
+	reference := []byte("The quick brown fox jumped over the lazy dog")
+
+	requester, err := NewRetryRequester(singleRequests(&fakeRequester{BytesRequester: reference, failures: 2}), &RetryConfig{InitialBackoff: time.Millisecond})
+	require.NoError(t, err)
+
+	r, err := New(&Config{
+		BlockSize: 4,
+		Requester: requester,
+		SizeFunc:  func() (int64, error) { return int64(len(reference)), nil },
+	})
+	require.NoError(t, err)
+
+	checksums, err := r.Sign(bytes.NewReader(local))
+	require.NoError(t, err)
+	patcher, err := r.Delta(bytes.NewReader(reference), checksums)
+	require.NoError(t, err)
+
+	output := bytes.NewBuffer(nil)
+	require.NoError(t, r.Patch(bytes.NewReader(local), patcher, output))
+	assert.Equal(t, reference, output.Bytes())
+}
+
+func TestRetryRequesterBatches(t *testing.T) {
+	ranges := []*syncpb.MissingBlockSpan{{StartOffset: 0, EndOffset: 4}, {StartOffset: 6, EndOffset: 10}}
+
+	fake := &fakeRequester{BytesRequester: []byte("hello world"), failures: 2}
+	r, err := NewRetryRequester(fake, &RetryConfig{InitialBackoff: time.Millisecond})
+	require.NoError(t, err)
+	assert.True(t, supportsBatches(r))
+
+	data, err := r.DoRequests(ranges)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("hello"), []byte("world")}, data)
+	assert.Len(t, fake.batches, 3)
+	assert.Empty(t, fake.ranges)
+
+	fake = &fakeRequester{BytesRequester: []byte("hello world"), failures: 3}
+	r, err = NewRetryRequester(fake, &RetryConfig{InitialBackoff: time.Millisecond})
+	require.NoError(t, err)
+
+	_, err = r.DoRequests(ranges)
+	assert.EqualError(t, err, "Request of batch of 2 ranges failed after 3 attempts: connection reset")
+
+	// Ranges of other requesters are retried one by one.
+	single := &fakeRequester{BytesRequester: []byte("hello world"), failures: 1}
+	r, err = NewRetryRequester(singleRequests(single), &RetryConfig{InitialBackoff: time.Millisecond})
+	require.NoError(t, err)
+	assert.False(t, supportsBatches(r))
+
+	data, err = r.DoRequests(ranges)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("hello"), []byte("world")}, data)
+	assert.Equal(t, 3, len(single.ranges))
+}
+
+func TestInvalidRetryConfig(t *testing.T) {
+	for _, c := range []*RetryConfig{{Attempts: -1}, {InitialBackoff: -1}, {Jitter: 2}, {Timeout: -1}} {
+		_, err := NewRetryRequester(BytesRequester(nil), c)
+		assert.Error(t, err)
+	}
+}
@@ -1,73 +1,348 @@
 package gosync
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"hash"
-	"hash/adler32"
 	"io"
+	"math"
 
 	"github.com/rkcloudchain/gosync/logging"
 	"github.com/rkcloudchain/gosync/syncpb"
 )
 
-// consts...
-const (
-	ReadNextByte = iota
-	ReadNextBlock
-	ReadNone
-)
-
 type blockMatchResult struct {
 	Index            uint32
 	Size             int64
 	ComparisonOffset int64
+	LocalOffset      int64
 }
 
+// formatVersion is the version of the signatures and patch plans produced by this library.
+const formatVersion = 2
+
+// offsetsVersion is the first format version recording the local offset of every block and found span.
+// Older ones only locate them by their index in blocks of the signature block size.
+const offsetsVersion = 2
+
 func newRSync(c *Config) *rsync {
+	algorithm := strongHashAlgorithm(c.StrongHasher())
 	return &rsync{
 		blockSize:        c.BlockSize,
+		autoBlockSize:    c.AutoBlockSize,
 		strongHasher:     c.StrongHasher,
+		strongAlgorithm:  algorithm,
+		strongProbe:      customHashProbe(c.StrongHasher(), algorithm),
+		strongLength:     c.StrongHashLength,
+		weakHasher:       c.WeakHasher,
 		requestBlockSize: c.MaxRequestBlockSize,
+		embedLiterals:    c.EmbedLiterals,
+		spanDigests:      c.SpanDigests,
+		requestRetries:   c.MaxRequestRetries,
+		prefetchRequests: c.PrefetchRequests,
+		prefetchMemory:   c.PrefetchMemory,
+		batchSpans:       c.MaxBatchSpans,
+		coalesceGap:      c.CoalesceGap,
+		cdc:              c.ContentDefinedChunking,
+		minChunkSize:     c.MinChunkSize,
+		maxChunkSize:     c.MaxChunkSize,
 		sizeFunc:         c.SizeFunc,
+		concurrency:      c.Concurrency,
 		reference:        c.Requester,
 	}
 }
 
 type rsync struct {
 	blockSize        int64
-	strongHasher     hash.Hash
+	autoBlockSize    bool
+	strongHasher     func() hash.Hash
+	strongAlgorithm  syncpb.StrongHashAlgorithm
+	strongProbe      []byte
+	strongLength     int
+	weakHasher       WeakHasher
 	requestBlockSize int64
+	embedLiterals    bool
+	spanDigests      bool
+	requestRetries   int
+	prefetchRequests int
+	prefetchMemory   int64
+	batchSpans       int
+	coalesceGap      int64
+	cdc              bool
+	minChunkSize     int64
+	maxChunkSize     int64
 	sizeFunc         func() (int64, error)
+	concurrency      int
 	reference        BlockRequester
 }
 
-func (r *rsync) Sign(dest io.Reader) *syncpb.ChunkChecksums {
-	checksums := r.createSign(dest)
+func (r *rsync) Sign(dest io.Reader) (*syncpb.ChunkChecksums, error) {
+	return r.SignContext(context.Background(), dest)
+}
+
+func (r *rsync) SignContext(ctx context.Context, dest io.Reader) (*syncpb.ChunkChecksums, error) {
+	if seeker, ok := dest.(io.Seeker); ok && r.autoBlockSize {
+		// Files such as pipes cannot seek, they are signed like other readers.
+		if size, err := remainingSize(seeker); err == nil {
+			r = r.sized(size)
+		} else {
+			logging.Debugf("Could not get file size, using block size %d: %v", r.blockSize, err)
+		}
+	}
+
+	return r.signStream(ctx, dest)
+}
+
+// signStream reads the input file sequentially, and returns its signature.
+func (r *rsync) signStream(ctx context.Context, dest io.Reader) (*syncpb.ChunkChecksums, error) {
+	var checksums []*syncpb.ChunkChecksum
+	var err error
+	if r.cdc {
+		checksums, err = r.createChunkSign(ctx, dest)
+	} else {
+		checksums, err = r.createSign(ctx, dest)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	logging.Debugf("Config block size: %d, generate %d checksums: %v", r.blockSize, len(checksums), checksums)
+	return r.signature(checksums), nil
+}
+
+func (r *rsync) SignAt(dest io.ReaderAt, size int64) (*syncpb.ChunkChecksums, error) {
+	return r.SignAtContext(context.Background(), dest, size)
+}
+
+func (r *rsync) SignAtContext(ctx context.Context, dest io.ReaderAt, size int64) (*syncpb.ChunkChecksums, error) {
+	if size >= 0 {
+		r = r.sized(size)
+	}
+
+	// Chunk boundaries depend on the preceding content, so chunks are cut sequentially.
+	if r.cdc {
+		if size < 0 {
+			return nil, fmt.Errorf("Invalid file size %d", size)
+		}
+		return r.signStream(ctx, io.NewSectionReader(dest, 0, size))
+	}
+
+	checksums, err := r.createSignAt(ctx, dest, size)
+	if err != nil {
+		return nil, err
+	}
+
 	logging.Debugf("Config block size: %d, generate %d checksums: %v", r.blockSize, len(checksums), checksums)
-	return &syncpb.ChunkChecksums{ConfigBlockSize: r.blockSize, Checksums: checksums}
+	return r.signature(checksums), nil
+}
+
+// sized returns the instance signing a file of size bytes, which has its own block size
+// when it is chosen automatically.
+func (r *rsync) sized(size int64) *rsync {
+	if !r.autoBlockSize {
+		return r
+	}
+
+	s := *r
+	s.blockSize = autoBlockSize(size)
+	s.minChunkSize = r.minChunkSize * s.blockSize / r.blockSize
+	s.maxChunkSize = r.maxChunkSize * s.blockSize / r.blockSize
+	if s.maxChunkSize > maxChunkSize {
+		s.maxChunkSize = maxChunkSize
+	}
+	return &s
+}
+
+// autoBlockSize returns the square root of size rounded down to a multiple of 8, like rsync,
+// between minAutoBlockSize and maxAutoBlockSize.
+func autoBlockSize(size int64) int64 {
+	blockSize := int64(math.Sqrt(float64(size))) &^ 7
+	if blockSize < minAutoBlockSize {
+		return minAutoBlockSize
+	}
+	if blockSize > maxAutoBlockSize {
+		return maxAutoBlockSize
+	}
+	return blockSize
+}
+
+// remainingSize returns the number of bytes after the current offset of seeker, which is left unchanged.
+func remainingSize(seeker io.Seeker) (int64, error) {
+	current, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+
+	end, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := seeker.Seek(current, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	if end < current {
+		return 0, nil
+	}
+	return end - current, nil
+}
+
+// signature describes the checksums of full-length strong hashes, and truncates them as configured.
+// Its block hashes digest is the strong hash of the concatenated block hashes, which lets Delta
+// detect a corrupted signature. It is left out of truncated signatures, whose full hashes Delta cannot know.
+func (r *rsync) signature(checksums []*syncpb.ChunkChecksum) *syncpb.ChunkChecksums {
+	strongHasher := r.strongHasher()
+
+	length := r.strongLength
+	if length == 0 {
+		length = strongHasher.Size()
+	}
+
+	var sourceLength int64
+	for _, chunk := range checksums {
+		sourceLength += chunk.BlockSize
+		strongHasher.Write(chunk.StrongHash)
+		chunk.StrongHash = chunk.StrongHash[:length]
+	}
+
+	signature := &syncpb.ChunkChecksums{
+		ConfigBlockSize:     r.blockSize,
+		Checksums:           checksums,
+		WeakHashAlgorithm:   r.weakHasher.Algorithm(),
+		FormatVersion:       formatVersion,
+		StrongHashAlgorithm: r.strongAlgorithm,
+		StrongHashLength:    uint32(length),
+		SourceLength:        sourceLength,
+		StrongHashProbe:     r.strongProbe,
+	}
+
+	if length == strongHasher.Size() {
+		signature.BlockHashesDigest = strongHasher.Sum(nil)
+	}
+
+	if r.cdc {
+		signature.ChunkingAlgorithm = syncpb.ChunkingFastCDC
+		signature.MinChunkSize = r.minChunkSize
+		signature.MaxChunkSize = r.maxChunkSize
+	}
+
+	return signature
+}
+
+// basisLength returns the length of the signed file. Signatures older than format 1
+// do not record it, it is then the total size of their blocks.
+func basisLength(checksums *syncpb.ChunkChecksums) int64 {
+	if checksums.FormatVersion > 0 {
+		return checksums.SourceLength
+	}
+
+	var length int64
+	for _, chunk := range checksums.Checksums {
+		length += chunk.BlockSize
+	}
+	return length
+}
+
+// validateSignature checks that checksums can be compared with the hashes this instance computes.
+func (r *rsync) validateSignature(checksums *syncpb.ChunkChecksums) error {
+	if checksums.FormatVersion > formatVersion {
+		return &ErrUnsupportedFormat{Version: checksums.FormatVersion}
+	}
+
+	// The block and chunk sizes size the buffers of the scan, so they are bounded.
+	if (checksums.ConfigBlockSize <= 0 && len(checksums.Checksums) > 0) || checksums.ConfigBlockSize > maxAutoBlockSize {
+		return &ErrInvalidSignature{Message: fmt.Sprintf("Invalid block length %d", checksums.ConfigBlockSize)}
+	}
+
+	switch checksums.ChunkingAlgorithm {
+	case syncpb.ChunkingFixed:
+	case syncpb.ChunkingFastCDC:
+		// Chunks can only be located by their recorded offsets.
+		if checksums.FormatVersion < offsetsVersion {
+			return &ErrInvalidSignature{Message: fmt.Sprintf("Unsupported format version %d for content-defined chunks", checksums.FormatVersion)}
+		}
+		if checksums.ConfigBlockSize < minChunkAverage || checksums.MinChunkSize <= 0 || checksums.MinChunkSize > checksums.ConfigBlockSize || checksums.ConfigBlockSize > checksums.MaxChunkSize || checksums.MaxChunkSize > maxChunkSize {
+			return &ErrInvalidSignature{Message: fmt.Sprintf("Invalid chunk sizes %d-%d-%d", checksums.MinChunkSize, checksums.ConfigBlockSize, checksums.MaxChunkSize)}
+		}
+	default:
+		return fmt.Errorf("Unknown chunking algorithm %v", checksums.ChunkingAlgorithm)
+	}
+
+	if checksums.FormatVersion == 0 {
+		return nil
+	}
+
+	if checksums.StrongHashAlgorithm != r.strongAlgorithm {
+		return &ErrSignatureMismatch{Field: "strong_hash_algorithm", Remote: checksums.StrongHashAlgorithm, Local: r.strongAlgorithm}
+	}
+
+	// Signatures of custom algorithms made before the probe was recorded cannot be told apart.
+	if len(checksums.StrongHashProbe) > 0 && !bytes.Equal(checksums.StrongHashProbe, r.strongProbe) {
+		return &ErrSignatureMismatch{Field: "strong_hash_probe", Remote: checksums.StrongHashProbe, Local: r.strongProbe}
+	}
+
+	strongHasher := r.strongHasher()
+	if size := strongHasher.Size(); checksums.StrongHashLength == 0 || int(checksums.StrongHashLength) > size {
+		return &ErrSignatureMismatch{Field: "strong_hash_length", Remote: checksums.StrongHashLength, Local: size}
+	}
+
+	var sourceLength int64
+	for _, chunk := range checksums.Checksums {
+		if len(chunk.StrongHash) != int(checksums.StrongHashLength) {
+			return &ErrSignatureMismatch{Field: "strong_hash_length", Remote: len(chunk.StrongHash), Local: checksums.StrongHashLength}
+		}
+		sourceLength += chunk.BlockSize
+		strongHasher.Write(chunk.StrongHash)
+	}
+
+	if sourceLength != checksums.SourceLength {
+		return &ErrSignatureMismatch{Field: "source_length", Remote: checksums.SourceLength, Local: sourceLength}
+	}
+
+	// The digest covers full-length block hashes, so it can only be checked on untruncated signatures.
+	if int(checksums.StrongHashLength) == strongHasher.Size() {
+		if digest := strongHasher.Sum(nil); !bytes.Equal(digest, checksums.BlockHashesDigest) {
+			return &ErrSignatureMismatch{Field: "block_hashes_digest", Remote: checksums.BlockHashesDigest, Local: digest}
+		}
+	}
+
+	return nil
 }
 
 // Sign reads each block of the input file, and returns the checksums for each block.
-func (r *rsync) createSign(dest io.Reader) []*syncpb.ChunkChecksum {
-	defer r.strongHasher.Reset()
+func (r *rsync) createSign(ctx context.Context, dest io.Reader) ([]*syncpb.ChunkChecksum, error) {
+	strongHasher := r.strongHasher()
 
 	buffer := make([]byte, r.blockSize)
 	checksums := make([]*syncpb.ChunkChecksum, 0)
+	rolling := r.weakHasher.New()
 
 	var index uint32
 
 	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		n, err := io.ReadFull(dest, buffer)
-		block := buffer[:n]
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("Could not read block %d: %v", index, err)
+		}
 
+		block := buffer[:n]
 		if n == 0 {
 			break
 		}
 
-		weak := ComputeWeakHash(block)
-		strong := r.computeStrongHash(block)
+		rolling.Reset()
+		rolling.Write(block)
+		weak := rolling.Sum32()
+		strong := computeStrongHash(strongHasher, block)
 
-		checksums = append(checksums, &syncpb.ChunkChecksum{BlockIndex: index, WeakHash: weak, StrongHash: strong, BlockSize: int64(n)})
+		checksums = append(checksums, &syncpb.ChunkChecksum{BlockIndex: index, WeakHash: weak, StrongHash: strong, BlockSize: int64(n), Offset: int64(index) * r.blockSize})
 
 		if n != len(buffer) || err == io.EOF {
 			break
@@ -76,25 +351,45 @@ func (r *rsync) createSign(dest io.Reader) []*syncpb.ChunkChecksum {
 		index++
 	}
 
-	return checksums
+	return checksums, nil
 }
 
 func (r *rsync) Patch(localFile io.ReadSeeker, patcher *syncpb.PatcherBlockSpan, output io.Writer) error {
+	return r.PatchContext(context.Background(), localFile, patcher, output)
+}
+
+func (r *rsync) PatchContext(ctx context.Context, localFile io.ReadSeeker, patcher *syncpb.PatcherBlockSpan, output io.Writer) error {
+	if err := r.validatePatcher(localFile, patcher); err != nil {
+		return err
+	}
 
 	currentOffset := int64(0)
+	blockSize := r.planBlockSize(patcher)
 	localBlocks := patcher.Found[:]
 	remoteBlocks := patcher.Missing[:]
+	verifier := r.newOutputVerifier(output)
+
+	var prefetcher *prefetcher
+	if supportsBatches(r.reference) || r.prefetchRequests > 1 {
+		prefetcher = r.prefetch(ctx, patcher.Missing, patcher.DigestAlgorithm)
+		defer prefetcher.Close()
+	}
 
 	for len(localBlocks) > 0 || len(remoteBlocks) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		if r.findInLocalBlocks(currentOffset, localBlocks) {
 			logging.Debugf("Found local block %d", currentOffset)
 			firstMatched := localBlocks[0]
 
-			matchOffset := r.blockSize * int64(firstMatched.StartIndex)
-			localFile.Seek(matchOffset, io.SeekStart)
-
-			if _, err := io.Copy(output, io.LimitReader(localFile, firstMatched.BlockSize)); err != nil {
-				return fmt.Errorf("Could not copy %d bytes to output: %v", firstMatched.BlockSize, err)
+			verifier.StartSpan()
+			if err := r.copyLocalBlock(ctx, localFile, firstMatched, localOffset(firstMatched, patcher.FormatVersion, blockSize), verifier); err != nil {
+				return err
+			}
+			if err := verifier.EndSpan(patcher.DigestAlgorithm, firstMatched.Digest); err != nil {
+				return err
 			}
 
 			currentOffset += firstMatched.BlockSize
@@ -103,16 +398,24 @@ func (r *rsync) Patch(localFile io.ReadSeeker, patcher *syncpb.PatcherBlockSpan,
 			logging.Debugf("Found remote block: %d", currentOffset)
 
 			firstMissing := remoteBlocks[0]
-			data, err := r.reference.DoRequest(firstMissing.StartOffset, firstMissing.EndOffset)
+
+			var data []byte
+			var err error
+			if prefetcher != nil {
+				data, err = prefetcher.Next()
+			} else {
+				data, err = r.requestMissingBlock(ctx, firstMissing, patcher.DigestAlgorithm)
+			}
 			if err != nil {
-				return fmt.Errorf("Failed to read from reference file: %v", err)
+				return err
 			}
 
-			if _, err := output.Write(data); err != nil {
-				return fmt.Errorf("Could not write data to output: %v", err)
+			n, err := writeBlock(verifier, data)
+			if err != nil {
+				return err
 			}
 
-			currentOffset += int64(len(data))
+			currentOffset += n
 			remoteBlocks = remoteBlocks[1:]
 
 		} else {
@@ -121,159 +424,338 @@ func (r *rsync) Patch(localFile io.ReadSeeker, patcher *syncpb.PatcherBlockSpan,
 		}
 	}
 
+	return verifier.Close(patcher.DigestAlgorithm, patcher.SourceDigest)
+}
+
+// planBlockSize returns the block size of the signature a plan was computed from,
+// or the configured one for plans that do not record it.
+func (r *rsync) planBlockSize(patcher *syncpb.PatcherBlockSpan) int64 {
+	if patcher.ConfigBlockSize > 0 {
+		return patcher.ConfigBlockSize
+	}
+	return r.blockSize
+}
+
+// localOffset returns the offset of a found span in the local file. The spans of plans older
+// than offsetsVersion are located by their index in blocks of blockSize bytes, whatever their LocalOffset.
+func localOffset(block *syncpb.FoundBlockSpan, version uint32, blockSize int64) int64 {
+	if version >= offsetsVersion {
+		return block.LocalOffset
+	}
+	return blockSize * int64(block.StartIndex)
+}
+
+// chunkOffset returns the offset of a block in the signed file, for signatures older
+// than offsetsVersion too.
+func chunkOffset(checksums *syncpb.ChunkChecksums, chunk *syncpb.ChunkChecksum) int64 {
+	if checksums.FormatVersion >= offsetsVersion {
+		return chunk.Offset
+	}
+	return int64(chunk.BlockIndex) * checksums.ConfigBlockSize
+}
+
+// copyLocalBlock writes a span of blocks at matchOffset in the local file to the output.
+func (r *rsync) copyLocalBlock(ctx context.Context, localFile io.ReadSeeker, block *syncpb.FoundBlockSpan, matchOffset int64, output io.Writer) error {
+	if _, err := localFile.Seek(matchOffset, io.SeekStart); err != nil {
+		return fmt.Errorf("Could not seek local file to %d: %v", matchOffset, err)
+	}
+
+	if _, err := io.Copy(&contextWriter{ctx: ctx, writer: output}, io.LimitReader(localFile, block.BlockSize)); err != nil {
+		return fmt.Errorf("Could not copy %d bytes to output: %v", block.BlockSize, err)
+	}
+
 	return nil
 }
 
-func (r *rsync) Delta(source io.ReaderAt, checksums *syncpb.ChunkChecksums) (*syncpb.PatcherBlockSpan, error) {
-	matches, err := r.match(source, checksums.ConfigBlockSize, checksums.Checksums)
+// writeMissingBlock writes the verified data of a missing span to the output and returns its length.
+func (r *rsync) writeMissingBlock(ctx context.Context, block *syncpb.MissingBlockSpan, algorithm syncpb.StrongHashAlgorithm, output io.Writer) (int64, error) {
+	data, err := r.requestMissingBlock(ctx, block, algorithm)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	logging.Debugf("Found %d match blocks: %v", len(matches), matches)
 
-	merger := newMerger()
-	merger.MergeResult(matches, checksums.ConfigBlockSize)
+	return writeBlock(output, data)
+}
 
-	mergedBlocks := merger.GetMergedBlocks()
-	missing, err := r.fetchMissingBlocks(mergedBlocks, checksums.ConfigBlockSize)
-	if err != nil {
-		return nil, err
+// writeBlock writes data to the output and returns its length.
+func writeBlock(output io.Writer, data []byte) (int64, error) {
+	if _, err := output.Write(data); err != nil {
+		return 0, fmt.Errorf("Could not write data to output: %v", err)
 	}
-	logging.Debugf("Found %d missing blocks: %v", len(missing), missing)
 
-	patcher := &syncpb.PatcherBlockSpan{Found: r.patchFoundSpan(mergedBlocks), Missing: r.splitMissingBlocks(missing)}
-	return patcher, nil
+	return int64(len(data)), nil
 }
 
-func (r *rsync) fetchMissingBlocks(sl blockSpanList, blockSize int64) ([]*syncpb.MissingBlockSpan, error) {
-	sorted := make([]*syncpb.MissingBlockSpan, 0)
-	size, err := r.sizeFunc()
+// validatePatcher checks that the plan was computed against the local file.
+func (r *rsync) validatePatcher(localFile io.Seeker, patcher *syncpb.PatcherBlockSpan) error {
+	if patcher.FormatVersion > formatVersion {
+		return &ErrUnsupportedFormat{Version: patcher.FormatVersion}
+	}
+
+	// Missing spans are requested ahead of the output, before Patch gets to check their offsets.
+	if err := validateMissingSpans(patcher.Missing); err != nil {
+		return err
+	}
+
+	if patcher.FormatVersion == 0 {
+		return nil
+	}
+
+	size, err := localFile.Seek(0, io.SeekEnd)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("Could not determine local file size: %v", err)
+	}
+
+	if size != patcher.BasisLength {
+		return &ErrSignatureMismatch{Field: "basis_length", Remote: patcher.BasisLength, Local: size}
+	}
+
+	if len(patcher.DigestProbe) > 0 && !bytes.Equal(patcher.DigestProbe, r.strongProbe) {
+		return &ErrSignatureMismatch{Field: "digest_probe", Remote: patcher.DigestProbe, Local: r.strongProbe}
 	}
 
-	offset := int64(0)
-	for _, blockSpan := range sl {
-		if blockSpan.ComparisonOffset > offset {
-			sorted = append(sorted, &syncpb.MissingBlockSpan{StartOffset: offset, EndOffset: blockSpan.ComparisonOffset - 1})
+	return nil
+}
+
+// validateMissingSpans checks that missing spans are in order and do not overlap.
+func validateMissingSpans(blocks []*syncpb.MissingBlockSpan) error {
+	next := int64(0)
+	for _, block := range blocks {
+		if block.StartOffset < next || block.EndOffset < block.StartOffset {
+			return fmt.Errorf("Invalid missing span %d-%d", block.StartOffset, block.EndOffset)
 		}
+		next = block.EndOffset + 1
+	}
+	return nil
+}
 
-		offset = blockSpan.ComparisonOffset + blockSpan.Size
+// requestMissingBlock returns the data of a missing span, from the plan itself when it was embedded.
+// A response of the wrong length or digest is requested again up to requestRetries times.
+func (r *rsync) requestMissingBlock(ctx context.Context, block *syncpb.MissingBlockSpan, algorithm syncpb.StrongHashAlgorithm) ([]byte, error) {
+	if len(block.Data) > 0 {
+		if err := r.checkMissingBlock(block, algorithm, block.Data); err != nil {
+			return nil, err
+		}
+		return block.Data, nil
 	}
 
-	if offset < size-1 {
-		sorted = append(sorted, &syncpb.MissingBlockSpan{StartOffset: offset, EndOffset: size - 1})
+	if r.reference == nil {
+		return nil, errors.New("Block requester must be specified")
 	}
 
-	return sorted, nil
+	for attempt := 0; ; attempt++ {
+		data, err := doRequest(ctx, r.reference, block.StartOffset, block.EndOffset)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read from reference file: %v", err)
+		}
+
+		err = r.checkMissingBlock(block, algorithm, data)
+		if err == nil {
+			return data, nil
+		}
+
+		if _, ok := err.(*ErrSignatureMismatch); ok || attempt >= r.requestRetries {
+			return nil, err
+		}
+		logging.Warningf("Requesting range %d-%d again: %v", block.StartOffset, block.EndOffset, err)
+	}
 }
 
-func (r *rsync) match(source io.ReaderAt, blockSize int64, checksums []*syncpb.ChunkChecksum) ([]blockMatchResult, error) {
-	defer r.strongHasher.Reset()
+// checkMissingBlock checks that data has the length of the span and matches its digest, if any.
+func (r *rsync) checkMissingBlock(block *syncpb.MissingBlockSpan, algorithm syncpb.StrongHashAlgorithm, data []byte) error {
+	length := block.EndOffset - block.StartOffset + 1
+	if int64(len(data)) != length {
+		return fmt.Errorf("Invalid response for range %d-%d: got %d bytes, expected %d", block.StartOffset, block.EndOffset, len(data), length)
+	}
 
-	index := makeChecksumIndex(checksums)
-	matchResult := make([]blockMatchResult, 0)
+	if len(block.Digest) == 0 {
+		return nil
+	}
+
+	if algorithm != r.strongAlgorithm {
+		return &ErrSignatureMismatch{Field: "digest_algorithm", Remote: algorithm, Local: r.strongAlgorithm}
+	}
+
+	if digest := computeStrongHash(r.strongHasher(), data); !bytes.Equal(digest, block.Digest) {
+		return &ErrChecksumMismatch{Offset: block.StartOffset, Length: length, Expected: block.Digest, Actual: digest}
+	}
+
+	return nil
+}
 
-	buffer := make([]byte, blockSize)
-	next := ReadNextByte
-	offset := int64(0)
+func (r *rsync) Delta(source io.ReaderAt, checksums *syncpb.ChunkChecksums) (*syncpb.PatcherBlockSpan, error) {
+	return r.DeltaContext(context.Background(), source, checksums)
+}
 
-	n, err := source.ReadAt(buffer, 0)
-	if err != nil && n == 0 {
+func (r *rsync) DeltaContext(ctx context.Context, source io.ReaderAt, checksums *syncpb.ChunkChecksums) (*syncpb.PatcherBlockSpan, error) {
+	if err := r.validateSignature(checksums); err != nil {
 		return nil, err
 	}
 
-	block := buffer[:n]
-	weak := adler32.Checksum(block)
+	if r.sizeFunc == nil {
+		return nil, errors.New("File size function must be specified")
+	}
 
-	for {
-		if weakMatchList := index.FindWeakChecksum(weak); weakMatchList != nil {
-			strong := r.computeStrongHash(block)
-			chunk := index.FindStrongChecksum(weakMatchList, strong)
+	size, err := r.sizeFunc()
+	if err != nil {
+		return nil, err
+	}
 
-			if chunk != nil {
-				matchResult = append(matchResult, blockMatchResult{
-					Index:            chunk.BlockIndex,
-					Size:             chunk.BlockSize,
-					ComparisonOffset: offset,
-				})
+	scan := func(tee io.Writer, onMatch func(blockMatchResult) error, onLiteral func(byte) error) (int64, error) {
+		return r.scan(ctx, io.TeeReader(io.NewSectionReader(source, 0, size), tee), checksums, onMatch, onLiteral)
+	}
 
-				if next == ReadNone {
-					break
-				}
-				next = ReadNextBlock
-			}
+	// Segments are scanned concurrently, then stitched and emitted along the source.
+	if r.concurrency > 1 && checksums.ChunkingAlgorithm == syncpb.ChunkingFixed {
+		scan = func(tee io.Writer, onMatch func(blockMatchResult) error, onLiteral func(byte) error) (int64, error) {
+			return r.parallelScan(ctx, source, size, checksums, tee, onMatch, onLiteral)
 		}
+	}
 
-		switch next {
-		case ReadNextBlock:
-			offset += int64(n)
-			n, err = source.ReadAt(buffer, offset)
-			next = ReadNextByte
+	plan := &planCollector{}
+	if err := r.emitDelta(checksums, plan, scan); err != nil {
+		return nil, err
+	}
+	logging.Debugf("Found %d found and %d missing blocks", len(plan.patcher.Found), len(plan.patcher.Missing))
 
-		case ReadNextByte:
-			offset++
-			n, err = source.ReadAt(buffer, offset)
-		}
+	return plan.patcher, nil
+}
 
-		if n > 0 {
-			block = buffer[:n]
-			weak = adler32.Checksum(block)
-		}
+// planCollector is a DeltaWriter assembling the plan returned by Delta.
+type planCollector struct {
+	patcher *syncpb.PatcherBlockSpan
+}
 
-		if next != ReadNone && err == io.EOF && n == 0 {
-			next = ReadNone
-		}
+func (c *planCollector) WriteHeader(header *syncpb.PatcherBlockSpan) error {
+	c.patcher = header
+	return nil
+}
 
-		if next == ReadNone {
-			break
-		}
+func (c *planCollector) WriteFound(found *syncpb.FoundBlockSpan) error {
+	c.patcher.Found = append(c.patcher.Found, found)
+	return nil
+}
+
+func (c *planCollector) WriteMissing(missing *syncpb.MissingBlockSpan) error {
+	c.patcher.Missing = append(c.patcher.Missing, missing)
+	return nil
+}
+
+func (c *planCollector) WriteTrailer(trailer *syncpb.PatchTrailer) error {
+	c.patcher.SourceDigest = trailer.SourceDigest
+	return nil
+}
+
+func (r *rsync) match(ctx context.Context, source io.ReaderAt, checksums *syncpb.ChunkChecksums) ([]blockMatchResult, error) {
+	matchResult := make([]blockMatchResult, 0)
+
+	_, err := r.scan(ctx, io.NewSectionReader(source, 0, math.MaxInt64), checksums, func(m blockMatchResult) error {
+		matchResult = append(matchResult, m)
+		return nil
+	}, nil)
+	if err != nil {
+		return nil, err
 	}
 
 	return matchResult, nil
 }
 
-func (r *rsync) splitMissingBlocks(blocks []*syncpb.MissingBlockSpan) []*syncpb.MissingBlockSpan {
-	if r.requestBlockSize == 0 {
-		return blocks
+// scan reads the source once, calling onMatch for every block found in the checksums
+// and onLiteral, when not nil, for every byte between them. It returns the source length.
+func (r *rsync) scan(ctx context.Context, source io.Reader, checksums *syncpb.ChunkChecksums, onMatch func(blockMatchResult) error, onLiteral func(byte) error) (int64, error) {
+	if checksums.ChunkingAlgorithm == syncpb.ChunkingFastCDC {
+		return r.scanChunks(ctx, source, checksums, onMatch, onLiteral)
 	}
+	return r.scanFrom(ctx, source, 0, checksums, makeChecksumIndex(checksums.Checksums), onMatch, onLiteral)
+}
 
-	sorted := make([]*syncpb.MissingBlockSpan, 0)
-	for _, block := range blocks {
-		size := block.EndOffset - block.StartOffset + 1
-		if size <= r.requestBlockSize {
-			sorted = append(sorted, block)
-		} else {
-			start := block.StartOffset
-			for size > r.requestBlockSize {
-				b := &syncpb.MissingBlockSpan{StartOffset: start, EndOffset: start + r.requestBlockSize - 1}
-				sorted = append(sorted, b)
-				start = b.EndOffset + 1
-				size = block.EndOffset - start + 1
-			}
+// scanFrom is scan over a source positioned at offset, looking blocks up in a prebuilt index.
+// It returns the offset of the end of the source.
+func (r *rsync) scanFrom(ctx context.Context, source io.Reader, offset int64, checksums *syncpb.ChunkChecksums, index *checksumIndex, onMatch func(blockMatchResult) error, onLiteral func(byte) error) (int64, error) {
+	weakHasher, err := r.weakHasherFor(checksums.WeakHashAlgorithm)
+	if err != nil {
+		return 0, err
+	}
 
-			sorted = append(sorted, &syncpb.MissingBlockSpan{StartOffset: start, EndOffset: block.EndOffset})
-		}
+	strongHasher := r.strongHasher()
+	blockSize := checksums.ConfigBlockSize
+	strongLength := int(checksums.StrongHashLength)
+	if strongLength == 0 {
+		strongLength = strongHasher.Size()
 	}
 
-	return sorted
-}
+	window := newSlidingWindow(source, blockSize)
+	window.offset = offset
+	if err := window.Advance(0); err != nil {
+		return 0, err
+	}
 
-func (r *rsync) computeStrongHash(v []byte) []byte {
-	r.strongHasher.Reset()
-	r.strongHasher.Write(v)
-	return r.strongHasher.Sum(nil)
-}
+	rolling := weakHasher.New()
+	block := window.Bytes()
+	rolling.Write(block)
+	nextCheck := offset + contextCheckInterval
+
+	for len(block) > 0 {
+		if window.Offset() >= nextCheck {
+			if err := ctx.Err(); err != nil {
+				return 0, err
+			}
+			nextCheck = window.Offset() + contextCheckInterval
+		}
+
+		if weakMatchList := index.FindWeakChecksum(rolling.Sum32()); weakMatchList != nil {
+			strong := computeStrongHash(strongHasher, block)
+			chunk := index.FindStrongChecksum(weakMatchList, strong[:strongLength])
+
+			if chunk != nil {
+				err := onMatch(blockMatchResult{
+					Index:            chunk.BlockIndex,
+					Size:             chunk.BlockSize,
+					ComparisonOffset: window.Offset(),
+					LocalOffset:      chunkOffset(checksums, chunk),
+				})
+				if err != nil {
+					return 0, err
+				}
+
+				if err := window.Advance(len(block)); err != nil {
+					return 0, err
+				}
 
-func (r *rsync) patchFoundSpan(sl blockSpanList) []*syncpb.FoundBlockSpan {
-	sorted := make([]*syncpb.FoundBlockSpan, len(sl))
+				block = window.Bytes()
+				rolling.Reset()
+				rolling.Write(block)
+				continue
+			}
+		}
 
-	for i, v := range sl {
-		s := &syncpb.FoundBlockSpan{ComparisonOffset: v.ComparisonOffset, BlockSize: v.Size, StartIndex: v.Start, EndIndex: v.End}
-		sorted[i] = s
+		out := block[0]
+		if onLiteral != nil {
+			if err := onLiteral(out); err != nil {
+				return 0, err
+			}
+		}
+
+		if err := window.Advance(1); err != nil {
+			return 0, err
+		}
+
+		next := window.Bytes()
+		if len(next) == len(block) {
+			rolling.Roll(out, next[len(next)-1])
+		} else {
+			rolling.RollOut(out)
+		}
+		block = next
 	}
 
-	return sorted
+	return window.Offset(), nil
+}
+
+func computeStrongHash(h hash.Hash, v []byte) []byte {
+	h.Reset()
+	h.Write(v)
+	return h.Sum(nil)
 }
 
 func (r *rsync) findInLocalBlocks(currentOffset int64, localBlocks []*syncpb.FoundBlockSpan) bool {
@@ -2,18 +2,28 @@ package gosync
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
 	"crypto/rand"
 	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash/adler32"
+	"io"
+	mrand "math/rand"
+	"os"
 	"testing"
+	"testing/iotest"
 
+	"github.com/rkcloudchain/gosync/syncpb"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func TestEmptyReaders(t *testing.T) {
-	r := &rsync{blockSize: 64 * 1024, strongHasher: md5.New()}
-	checksums := r.Sign(bytes.NewReader(nil))
+	r := &rsync{blockSize: 64 * 1024, strongHasher: md5.New, weakHasher: Adler32}
+	checksums, err := r.Sign(bytes.NewReader(nil))
+	require.NoError(t, err)
 	assert.Len(t, checksums.Checksums, 0)
 }
 
@@ -23,8 +33,9 @@ func TestGenerateChecksums(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, 4*1024*1024, n)
 
-	r := &rsync{blockSize: 512 * 1024, strongHasher: md5.New()}
-	checksums := r.Sign(bytes.NewReader(data))
+	r := &rsync{blockSize: 512 * 1024, strongHasher: md5.New, weakHasher: Adler32}
+	checksums, err := r.Sign(bytes.NewReader(data))
+	require.NoError(t, err)
 	assert.Len(t, checksums.Checksums, 8)
 }
 
@@ -34,28 +45,82 @@ func TestGenerateChecksums2(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, 8520959, n)
 
-	r := &rsync{blockSize: 512 * 1024, strongHasher: sha256.New()}
-	checksums := r.Sign(bytes.NewReader(data))
+	r := &rsync{blockSize: 512 * 1024, strongHasher: sha256.New, weakHasher: Adler32}
+	checksums, err := r.Sign(bytes.NewReader(data))
+	require.NoError(t, err)
 	checksum := checksums.Checksums[len(checksums.Checksums)-1]
 	assert.NotEqual(t, 512*1024, checksum.Size())
 }
 
 func TestGenerateChecksums3(t *testing.T) {
-	r := &rsync{blockSize: 2, strongHasher: md5.New()}
-	checksums := r.Sign(bytes.NewReader([]byte("hello world")))
+	r := &rsync{blockSize: 2, strongHasher: md5.New, weakHasher: Adler32}
+	checksums, err := r.Sign(bytes.NewReader([]byte("hello world")))
+	require.NoError(t, err)
 	assert.Len(t, checksums.Checksums, 6)
 	assert.Equal(t, int64(1), checksums.Checksums[5].BlockSize)
 }
 
+// failingReader returns the data of its reader, then err instead of io.EOF.
+type failingReader struct {
+	io.Reader
+	err error
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	n, err := f.Reader.Read(p)
+	if err == io.EOF {
+		err = f.err
+	}
+	return n, err
+}
+
+func TestSignReadError(t *testing.T) {
+	r := &rsync{blockSize: 4, strongHasher: md5.New, weakHasher: Adler32}
+
+	_, err := r.Sign(iotest.TimeoutReader(bytes.NewReader([]byte("hello world"))))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), iotest.ErrTimeout.Error())
+
+	_, err = r.Sign(&failingReader{Reader: bytes.NewReader([]byte("hello world")), err: errors.New("disk failure")})
+	assert.EqualError(t, err, "Could not read block 2: disk failure")
+
+	_, err = r.Sign(&failingReader{Reader: bytes.NewReader([]byte("hello world!")), err: errors.New("disk failure")})
+	assert.EqualError(t, err, "Could not read block 3: disk failure")
+
+	_, err = r.Sign(iotest.DataErrReader(bytes.NewReader([]byte("hello world"))))
+	assert.NoError(t, err)
+}
+
+func TestSignAtReadError(t *testing.T) {
+	r := &rsync{blockSize: 4, strongHasher: md5.New, weakHasher: Adler32, concurrency: 2}
+
+	_, err := r.SignAt(&failingReaderAt{bytes.NewReader([]byte("hello world")), 8}, 11)
+	assert.EqualError(t, err, "Could not read block 2: disk failure")
+}
+
+// failingReaderAt fails reads past limit.
+type failingReaderAt struct {
+	io.ReaderAt
+	limit int64
+}
+
+func (f *failingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off+int64(len(p)) > f.limit {
+		return 0, errors.New("disk failure")
+	}
+	return f.ReaderAt.ReadAt(p, off)
+}
+
 func TestMatch(t *testing.T) {
 	reader := bytes.NewReader([]byte("123abcdefg"))
-	r := &rsync{blockSize: 3, strongHasher: md5.New()}
+	r := &rsync{blockSize: 3, strongHasher: md5.New, weakHasher: Adler32}
 
-	checksums := r.Sign(reader)
+	checksums, err := r.Sign(reader)
+	require.NoError(t, err)
 	assert.Len(t, checksums.Checksums, 4)
 
 	source := bytes.NewReader([]byte("123xxabc def"))
-	results, err := r.match(source, r.blockSize, checksums.Checksums)
+	results, err := r.match(context.Background(), source, checksums)
 	assert.NoError(t, err)
 	assert.Len(t, results, 3)
 
@@ -66,13 +131,14 @@ func TestMatch(t *testing.T) {
 
 func TestMatch2(t *testing.T) {
 	reader := bytes.NewReader([]byte("hello"))
-	r := &rsync{blockSize: 2, strongHasher: sha256.New(), sizeFunc: func() (int64, error) { return int64(2), nil }}
+	r := &rsync{blockSize: 2, strongHasher: sha256.New, weakHasher: Adler32, sizeFunc: func() (int64, error) { return int64(2), nil }}
 
-	checksums := r.Sign(reader)
+	checksums, err := r.Sign(reader)
+	require.NoError(t, err)
 	assert.Len(t, checksums.Checksums, 3)
 
 	source := bytes.NewReader([]byte("helllo"))
-	results, err := r.match(source, 2, checksums.Checksums)
+	results, err := r.match(context.Background(), source, checksums)
 	assert.NoError(t, err)
 	assert.Len(t, results, 3)
 
@@ -87,8 +153,9 @@ func TestDelta(t *testing.T) {
 	bs := []byte("123aabb456ccdd789ee321ff21gg")
 	src := bytes.NewReader(bs)
 
-	r := &rsync{blockSize: 4, strongHasher: md5.New(), sizeFunc: func() (int64, error) { return int64(len(bs)), nil }}
-	checksums := r.Sign(dst)
+	r := &rsync{blockSize: 4, strongHasher: md5.New, weakHasher: Adler32, sizeFunc: func() (int64, error) { return int64(len(bs)), nil }}
+	checksums, err := r.Sign(dst)
+	require.NoError(t, err)
 	assert.Len(t, checksums.Checksums, 4)
 
 	patcher, err := r.Delta(src, checksums)
@@ -111,13 +178,35 @@ func TestDelta(t *testing.T) {
 	assert.Equal(t, int64(25), patcher.Missing[2].EndOffset)
 }
 
+func TestDeltaLastByteMissing(t *testing.T) {
+	local := []byte("aabbccdd")
+	reference := []byte("aabbccdd!")
+
+	r, err := New(&Config{BlockSize: 4, Requester: BytesRequester(reference), SizeFunc: BytesRequester(reference).Size})
+	require.NoError(t, err)
+
+	checksums, err := r.Sign(bytes.NewReader(local))
+	require.NoError(t, err)
+
+	patcher, err := r.Delta(bytes.NewReader(reference), checksums)
+	require.NoError(t, err)
+	require.Len(t, patcher.Missing, 1)
+	assert.Equal(t, int64(8), patcher.Missing[0].StartOffset)
+	assert.Equal(t, int64(8), patcher.Missing[0].EndOffset)
+
+	output := bytes.NewBuffer(nil)
+	require.NoError(t, r.Patch(bytes.NewReader(local), patcher, output))
+	assert.Equal(t, reference, output.Bytes())
+}
+
 func TestEmptyData(t *testing.T) {
 	dst := bytes.NewReader(nil)
 	src := []byte("abcdefghijklmn")
 	reader := bytes.NewReader(src)
 
-	r := &rsync{blockSize: 4, strongHasher: md5.New(), sizeFunc: func() (int64, error) { return int64(len(src)), nil }}
-	checksums := r.Sign(dst)
+	r := &rsync{blockSize: 4, strongHasher: md5.New, weakHasher: Adler32, sizeFunc: func() (int64, error) { return int64(len(src)), nil }}
+	checksums, err := r.Sign(dst)
+	require.NoError(t, err)
 	assert.Len(t, checksums.Checksums, 0)
 
 	patcher, err := r.Delta(reader, checksums)
@@ -133,8 +222,9 @@ func TestSplitMissingBlocks(t *testing.T) {
 	src := []byte("he1234567890llo")
 	reader := bytes.NewReader(src)
 
-	r := &rsync{blockSize: 2, strongHasher: md5.New(), sizeFunc: func() (int64, error) { return int64(len(src)), nil }, requestBlockSize: 2}
-	checksums := r.Sign(dst)
+	r := &rsync{blockSize: 2, strongHasher: md5.New, weakHasher: Adler32, sizeFunc: func() (int64, error) { return int64(len(src)), nil }, requestBlockSize: 2}
+	checksums, err := r.Sign(dst)
+	require.NoError(t, err)
 	assert.Len(t, checksums.Checksums, 3)
 
 	patcher, err := r.Delta(reader, checksums)
@@ -142,3 +232,185 @@ func TestSplitMissingBlocks(t *testing.T) {
 	assert.Len(t, patcher.Found, 2)
 	assert.Len(t, patcher.Missing, 5)
 }
+
+func TestMatchRandomEdits(t *testing.T) {
+	rnd := mrand.New(mrand.NewSource(7))
+	local := make([]byte, 64*1024)
+	rnd.Read(local)
+
+	source := make([]byte, 0, len(local)+1024)
+	for i := 0; i < len(local); i += 1000 {
+		end := i + 1000
+		if end > len(local) {
+			end = len(local)
+		}
+		source = append(source, local[i:end]...)
+		junk := make([]byte, rnd.Intn(17))
+		rnd.Read(junk)
+		source = append(source, junk...)
+	}
+
+	for _, blockSize := range []int64{1, 3, 64, 700, 4096} {
+		r := &rsync{blockSize: blockSize, strongHasher: md5.New, weakHasher: Adler32}
+		checksums, err := r.Sign(bytes.NewReader(local))
+		require.NoError(t, err)
+
+		results, err := r.match(context.Background(), bytes.NewReader(source), checksums)
+		require.NoError(t, err)
+
+		expected, err := naiveMatch(r, bytes.NewReader(source), blockSize, checksums.Checksums)
+		require.NoError(t, err)
+		assert.Equal(t, expected, results, "block size %d", blockSize)
+	}
+}
+
+func TestAutoBlockSize(t *testing.T) {
+	assert.Equal(t, int64(512), autoBlockSize(0))
+	assert.Equal(t, int64(512), autoBlockSize(4096))
+	assert.Equal(t, int64(1000), autoBlockSize(1000*1000))
+	assert.Equal(t, int64(1768), autoBlockSize(3*1024*1024))
+	assert.Equal(t, int64(128*1024), autoBlockSize(16*1024*1024*1024))
+	assert.Equal(t, int64(1024*1024), autoBlockSize(1<<44))
+}
+
+func TestSignAutoBlockSize(t *testing.T) {
+	data := make([]byte, 4*1024*1024)
+	mrand.New(mrand.NewSource(7)).Read(data)
+
+	r, err := New(&Config{AutoBlockSize: true})
+	require.NoError(t, err)
+
+	checksums, err := r.Sign(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2048), checksums.ConfigBlockSize)
+	assert.Len(t, checksums.Checksums, 2048)
+
+	at, err := r.SignAt(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	assert.Equal(t, checksums, at)
+
+	// Only the rest of a reader is signed.
+	reader := bytes.NewReader(data)
+	_, err = reader.Seek(1024*1024, io.SeekStart)
+	require.NoError(t, err)
+	checksums, err = r.Sign(reader)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1768), checksums.ConfigBlockSize)
+
+	// The size of other readers is unknown.
+	checksums, err = r.Sign(struct{ io.Reader }{bytes.NewReader(data)})
+	require.NoError(t, err)
+	assert.Equal(t, int64(defaultBlockSize), checksums.ConfigBlockSize)
+
+	checksums, err = r.Sign(bytes.NewReader(data[:3000]))
+	require.NoError(t, err)
+	assert.Equal(t, int64(512), checksums.ConfigBlockSize)
+
+	// Neither are those of files that cannot seek.
+	pr, pw, err := os.Pipe()
+	require.NoError(t, err)
+	defer pr.Close()
+	go func() {
+		pw.Write(data)
+		pw.Close()
+	}()
+
+	checksums, err = r.Sign(pr)
+	require.NoError(t, err)
+	assert.Equal(t, int64(defaultBlockSize), checksums.ConfigBlockSize)
+	assert.Equal(t, int64(len(data)), checksums.SourceLength)
+}
+
+func TestAutoBlockSizeRoundTrip(t *testing.T) {
+	local := make([]byte, 1024*1024)
+	mrand.New(mrand.NewSource(8)).Read(local)
+	reference := editedCopy(mrand.New(mrand.NewSource(9)), local, 20)
+
+	for _, cdc := range []bool{false, true} {
+		signer, err := New(&Config{AutoBlockSize: true, ContentDefinedChunking: cdc})
+		require.NoError(t, err)
+
+		checksums, err := signer.Sign(bytes.NewReader(local))
+		require.NoError(t, err)
+		assert.Equal(t, int64(1024), checksums.ConfigBlockSize)
+		if cdc {
+			assert.Equal(t, int64(256), checksums.MinChunkSize)
+			assert.Equal(t, int64(4096), checksums.MaxChunkSize)
+		}
+
+		r, err := New(&Config{Requester: BytesRequester(reference), SizeFunc: BytesRequester(reference).Size})
+		require.NoError(t, err)
+
+		patcher, err := r.Delta(bytes.NewReader(reference), checksums)
+		require.NoError(t, err)
+		assert.NotEmpty(t, patcher.Found)
+
+		output := bytes.NewBuffer(nil)
+		require.NoError(t, r.Patch(bytes.NewReader(local), patcher, output))
+		assert.Equal(t, reference, output.Bytes())
+	}
+}
+
+func BenchmarkMatch(b *testing.B) {
+	const blockSize = 2048
+
+	local := make([]byte, 64*1024)
+	rand.Read(local)
+
+	r := &rsync{blockSize: blockSize, strongHasher: md5.New, weakHasher: Adler32}
+	checksums, err := r.Sign(bytes.NewReader(local))
+	require.NoError(b, err)
+
+	for _, size := range []int{128 * 1024, 256 * 1024, 512 * 1024} {
+		source := make([]byte, size)
+		rand.Read(source)
+
+		b.Run(fmt.Sprintf("rolling/%d", size), func(b *testing.B) {
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				if _, err := r.match(context.Background(), bytes.NewReader(source), checksums); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("naive/%d", size), func(b *testing.B) {
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				if _, err := naiveMatch(r, bytes.NewReader(source), blockSize, checksums.Checksums); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// naiveMatch is the reference implementation that rehashes a whole block at every offset.
+func naiveMatch(r *rsync, source io.ReaderAt, blockSize int64, checksums []*syncpb.ChunkChecksum) ([]blockMatchResult, error) {
+	index := makeChecksumIndex(checksums)
+	matchResult := make([]blockMatchResult, 0)
+
+	buffer := make([]byte, blockSize)
+	offset := int64(0)
+
+	for {
+		n, err := source.ReadAt(buffer, offset)
+		if n == 0 {
+			if err == io.EOF {
+				return matchResult, nil
+			}
+			return nil, err
+		}
+
+		block := buffer[:n]
+		if weakMatchList := index.FindWeakChecksum(adler32.Checksum(block)); weakMatchList != nil {
+			if chunk := index.FindStrongChecksum(weakMatchList, computeStrongHash(r.strongHasher(), block)); chunk != nil {
+				matchResult = append(matchResult, blockMatchResult{Index: chunk.BlockIndex, Size: chunk.BlockSize, ComparisonOffset: offset, LocalOffset: chunk.Offset})
+				offset += int64(n)
+				continue
+			}
+		}
+
+		offset++
+	}
+}
@@ -0,0 +1,414 @@
+package gosync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	protoio "github.com/gogo/protobuf/io"
+	"github.com/rkcloudchain/gosync/logging"
+	"github.com/rkcloudchain/gosync/syncpb"
+)
+
+// maxDelimitedSpanSize bounds the size of a single span read from a delimited stream.
+const maxDelimitedSpanSize = 64 * 1024 * 1024
+
+// DeltaWriter receives a patch plan as it is computed by DeltaStream.
+// The header is written first, then the spans in output order, then the trailer.
+type DeltaWriter interface {
+	// WriteHeader receives the plan-level fields, without any span.
+	WriteHeader(*syncpb.PatcherBlockSpan) error
+
+	// WriteFound receives a span of blocks to copy from the local file.
+	WriteFound(*syncpb.FoundBlockSpan) error
+
+	// WriteMissing receives a span of data to obtain from the source.
+	WriteMissing(*syncpb.MissingBlockSpan) error
+
+	// WriteTrailer receives the digest of the source, once it has been read entirely.
+	WriteTrailer(*syncpb.PatchTrailer) error
+}
+
+// SpanReader iterates over the spans of a patch plan in output order.
+// An optional header comes first and an optional trailer last.
+// ReadSpan returns io.EOF after the last span.
+type SpanReader interface {
+	ReadSpan() (*syncpb.BlockSpan, error)
+}
+
+func (r *rsync) DeltaStream(source io.Reader, checksums *syncpb.ChunkChecksums, output DeltaWriter) error {
+	return r.DeltaStreamContext(context.Background(), source, checksums, output)
+}
+
+func (r *rsync) DeltaStreamContext(ctx context.Context, source io.Reader, checksums *syncpb.ChunkChecksums, output DeltaWriter) error {
+	if err := r.validateSignature(checksums); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return r.emitDelta(checksums, output, func(tee io.Writer, onMatch func(blockMatchResult) error, onLiteral func(byte) error) (int64, error) {
+		return r.scan(ctx, io.TeeReader(source, tee), checksums, onMatch, onLiteral)
+	})
+}
+
+// emitDelta writes the plan of the matches reported by scan to output. Scan reads the source
+// once and writes it to its tee ahead of the matches and literals it reports, so that the
+// spans and the whole source are digested as they go by.
+func (r *rsync) emitDelta(checksums *syncpb.ChunkChecksums, output DeltaWriter, scan func(io.Writer, func(blockMatchResult) error, func(byte) error) (int64, error)) error {
+	err := output.WriteHeader(&syncpb.PatcherBlockSpan{
+		FormatVersion:   formatVersion,
+		BasisLength:     basisLength(checksums),
+		DigestAlgorithm: r.strongAlgorithm,
+		DigestProbe:     r.strongProbe,
+		ConfigBlockSize: checksums.ConfigBlockSize,
+	})
+	if err != nil {
+		return err
+	}
+
+	emitter := &deltaEmitter{
+		output:           output,
+		requestBlockSize: r.requestBlockSize,
+		embedLiterals:    r.embedLiterals,
+		digest:           r.strongHasher(),
+	}
+
+	digest := r.strongHasher()
+	tee := io.Writer(digest)
+	if r.spanDigests {
+		emitter.tap = &sourceTap{}
+		emitter.foundDigest = r.strongHasher()
+		tee = io.MultiWriter(digest, emitter.tap)
+	}
+
+	size, err := scan(tee, emitter.Match, emitter.Literal)
+	if err != nil {
+		return err
+	}
+
+	if err := emitter.Close(size); err != nil {
+		return err
+	}
+
+	return output.WriteTrailer(&syncpb.PatchTrailer{SourceDigest: digest.Sum(nil)})
+}
+
+// deltaEmitter turns the matches of a forward scan into merged found spans
+// and missing spans no larger than requestBlockSize, along with their digest.
+// The found spans are digested too when a tap provides the source data.
+type deltaEmitter struct {
+	output           DeltaWriter
+	requestBlockSize int64
+	embedLiterals    bool
+	digest           hash.Hash
+	tap              *sourceTap
+	foundDigest      hash.Hash
+
+	found        *syncpb.FoundBlockSpan
+	literalStart int64
+	literal      []byte
+}
+
+func (e *deltaEmitter) Match(m blockMatchResult) error {
+	if m.ComparisonOffset > e.literalStart {
+		if err := e.flushMissing(m.ComparisonOffset); err != nil {
+			return err
+		}
+	}
+
+	if e.found != nil && e.found.EndIndex+1 == m.Index && e.found.ComparisonOffset+e.found.BlockSize == m.ComparisonOffset && e.found.LocalOffset+e.found.BlockSize == m.LocalOffset {
+		e.found.EndIndex = m.Index
+		e.found.BlockSize += m.Size
+	} else {
+		if err := e.flushFound(); err != nil {
+			return err
+		}
+		e.found = &syncpb.FoundBlockSpan{ComparisonOffset: m.ComparisonOffset, StartIndex: m.Index, EndIndex: m.Index, BlockSize: m.Size, LocalOffset: m.LocalOffset}
+		if e.foundDigest != nil {
+			e.foundDigest.Reset()
+		}
+	}
+
+	if e.tap != nil {
+		e.tap.Take(m.ComparisonOffset, m.ComparisonOffset+m.Size, e.foundDigest)
+	}
+
+	e.literalStart = m.ComparisonOffset + m.Size
+	return nil
+}
+
+// Literal buffers the data of missing spans, which are emitted as soon as they reach the request size.
+func (e *deltaEmitter) Literal(c byte) error {
+	e.literal = append(e.literal, c)
+
+	if e.requestBlockSize > 0 && int64(len(e.literal)) >= e.requestBlockSize {
+		return e.flushMissing(e.literalStart + int64(len(e.literal)))
+	}
+
+	return nil
+}
+
+// Close emits the pending spans, given the total length of the source.
+func (e *deltaEmitter) Close(size int64) error {
+	if size > e.literalStart {
+		if err := e.flushMissing(size); err != nil {
+			return err
+		}
+	}
+
+	return e.flushFound()
+}
+
+func (e *deltaEmitter) flushFound() error {
+	if e.found == nil {
+		return nil
+	}
+
+	found := e.found
+	e.found = nil
+	if e.foundDigest != nil {
+		found.Digest = e.foundDigest.Sum(nil)
+	}
+	return e.output.WriteFound(found)
+}
+
+// flushMissing emits the missing data from literalStart up to end, exclusive.
+func (e *deltaEmitter) flushMissing(end int64) error {
+	if err := e.flushFound(); err != nil {
+		return err
+	}
+
+	for e.literalStart < end {
+		length := end - e.literalStart
+		if e.requestBlockSize > 0 && length > e.requestBlockSize {
+			length = e.requestBlockSize
+		}
+
+		block := &syncpb.MissingBlockSpan{
+			StartOffset: e.literalStart,
+			EndOffset:   e.literalStart + length - 1,
+			Digest:      computeStrongHash(e.digest, e.literal[:length]),
+		}
+		if e.embedLiterals {
+			block.Data = e.literal[:length]
+		}
+		e.literal = e.literal[length:]
+
+		if err := e.output.WriteMissing(block); err != nil {
+			return err
+		}
+		e.literalStart += length
+	}
+
+	e.literal = nil
+	if e.tap != nil {
+		e.tap.Take(end, end, nil)
+	}
+	return nil
+}
+
+func (r *rsync) PatchStream(localFile io.ReadSeeker, spans SpanReader, output io.Writer) error {
+	return r.PatchStreamContext(context.Background(), localFile, spans, output)
+}
+
+func (r *rsync) PatchStreamContext(ctx context.Context, localFile io.ReadSeeker, spans SpanReader, output io.Writer) error {
+	currentOffset := int64(0)
+	first := true
+	trailer := false
+	algorithm := syncpb.StrongHashCustom
+	blockSize := r.blockSize
+	version := uint32(0)
+	verifier := r.newOutputVerifier(output)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		span, err := spans.ReadSpan()
+		if err == io.EOF {
+			// A stream cut short must not pass for the whole source.
+			if version > 0 && !trailer {
+				return errors.New("Missing trailer at the end of the spans")
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Could not read span: %v", err)
+		}
+
+		if trailer {
+			return errors.New("Unexpected span after the trailer")
+		}
+
+		switch s := span.Span.(type) {
+		case *syncpb.BlockSpan_Header:
+			if !first {
+				return errors.New("Unexpected header after the first span")
+			}
+			if err := r.validatePatcher(localFile, s.Header); err != nil {
+				return err
+			}
+			algorithm = s.Header.DigestAlgorithm
+			blockSize = r.planBlockSize(s.Header)
+			version = s.Header.FormatVersion
+
+		case *syncpb.BlockSpan_Found:
+			if !r.findInLocalBlocks(currentOffset, []*syncpb.FoundBlockSpan{s.Found}) {
+				logging.Errorf("Can't find local block with offset: %d", currentOffset)
+				return fmt.Errorf("Could not find block offset in missing or matched list: %d", currentOffset)
+			}
+
+			logging.Debugf("Found local block %d", currentOffset)
+			verifier.StartSpan()
+			if err := r.copyLocalBlock(ctx, localFile, s.Found, localOffset(s.Found, version, blockSize), verifier); err != nil {
+				return err
+			}
+			if err := verifier.EndSpan(algorithm, s.Found.Digest); err != nil {
+				return err
+			}
+			currentOffset += s.Found.BlockSize
+
+		case *syncpb.BlockSpan_Missing:
+			if !r.findInRemoteBlocks(currentOffset, []*syncpb.MissingBlockSpan{s.Missing}) {
+				logging.Errorf("Can't find remote block with offset: %d", currentOffset)
+				return fmt.Errorf("Could not find block offset in missing or matched list: %d", currentOffset)
+			}
+
+			logging.Debugf("Found remote block: %d", currentOffset)
+			n, err := r.writeMissingBlock(ctx, s.Missing, algorithm, verifier)
+			if err != nil {
+				return err
+			}
+			currentOffset += n
+
+		case *syncpb.BlockSpan_Trailer:
+			if err := verifier.Close(algorithm, s.Trailer.SourceDigest); err != nil {
+				return err
+			}
+			trailer = true
+
+		default:
+			return fmt.Errorf("Unknown span type %T", span.Span)
+		}
+
+		first = false
+	}
+}
+
+// NewChanSpanReader returns a SpanReader receiving spans from ch until it is closed.
+func NewChanSpanReader(ch <-chan *syncpb.BlockSpan) SpanReader {
+	return NewChanSpanReaderContext(context.Background(), ch)
+}
+
+// NewChanSpanReaderContext returns a SpanReader receiving spans from ch until it is closed,
+// or failing with the error of ctx once it is done.
+func NewChanSpanReaderContext(ctx context.Context, ch <-chan *syncpb.BlockSpan) SpanReader {
+	return &chanSpanReader{ctx: ctx, ch: ch}
+}
+
+type chanSpanReader struct {
+	ctx context.Context
+	ch  <-chan *syncpb.BlockSpan
+}
+
+func (c *chanSpanReader) ReadSpan() (*syncpb.BlockSpan, error) {
+	select {
+	case span, ok := <-c.ch:
+		if !ok {
+			return nil, io.EOF
+		}
+		return span, nil
+	case <-c.ctx.Done():
+		return nil, c.ctx.Err()
+	}
+}
+
+// NewChanDeltaWriter returns a DeltaWriter sending spans to ch. The caller closes ch
+// once DeltaStream returns.
+func NewChanDeltaWriter(ch chan<- *syncpb.BlockSpan) DeltaWriter {
+	return NewChanDeltaWriterContext(context.Background(), ch)
+}
+
+// NewChanDeltaWriterContext returns a DeltaWriter sending spans to ch, whose sends fail
+// with the error of ctx once it is done, so that a producer never outlives its consumer.
+func NewChanDeltaWriterContext(ctx context.Context, ch chan<- *syncpb.BlockSpan) DeltaWriter {
+	return &chanDeltaWriter{ctx: ctx, ch: ch}
+}
+
+type chanDeltaWriter struct {
+	ctx context.Context
+	ch  chan<- *syncpb.BlockSpan
+}
+
+func (c *chanDeltaWriter) send(span *syncpb.BlockSpan) error {
+	select {
+	case c.ch <- span:
+		return nil
+	case <-c.ctx.Done():
+		return c.ctx.Err()
+	}
+}
+
+func (c *chanDeltaWriter) WriteHeader(header *syncpb.PatcherBlockSpan) error {
+	return c.send(&syncpb.BlockSpan{Span: &syncpb.BlockSpan_Header{Header: header}})
+}
+
+func (c *chanDeltaWriter) WriteFound(found *syncpb.FoundBlockSpan) error {
+	return c.send(&syncpb.BlockSpan{Span: &syncpb.BlockSpan_Found{Found: found}})
+}
+
+func (c *chanDeltaWriter) WriteMissing(missing *syncpb.MissingBlockSpan) error {
+	return c.send(&syncpb.BlockSpan{Span: &syncpb.BlockSpan_Missing{Missing: missing}})
+}
+
+func (c *chanDeltaWriter) WriteTrailer(trailer *syncpb.PatchTrailer) error {
+	return c.send(&syncpb.BlockSpan{Span: &syncpb.BlockSpan_Trailer{Trailer: trailer}})
+}
+
+// NewDelimitedSpanReader returns a SpanReader decoding varint length-delimited BlockSpan messages.
+func NewDelimitedSpanReader(r io.Reader) SpanReader {
+	return &delimitedSpanReader{reader: protoio.NewDelimitedReader(r, maxDelimitedSpanSize)}
+}
+
+type delimitedSpanReader struct {
+	reader protoio.Reader
+}
+
+func (d *delimitedSpanReader) ReadSpan() (*syncpb.BlockSpan, error) {
+	span := &syncpb.BlockSpan{}
+	if err := d.reader.ReadMsg(span); err != nil {
+		return nil, err
+	}
+	return span, nil
+}
+
+// NewDelimitedDeltaWriter returns a DeltaWriter encoding spans as varint length-delimited BlockSpan messages.
+func NewDelimitedDeltaWriter(w io.Writer) DeltaWriter {
+	return &delimitedDeltaWriter{writer: protoio.NewDelimitedWriter(w)}
+}
+
+type delimitedDeltaWriter struct {
+	writer protoio.Writer
+}
+
+func (d *delimitedDeltaWriter) WriteHeader(header *syncpb.PatcherBlockSpan) error {
+	return d.writer.WriteMsg(&syncpb.BlockSpan{Span: &syncpb.BlockSpan_Header{Header: header}})
+}
+
+func (d *delimitedDeltaWriter) WriteFound(found *syncpb.FoundBlockSpan) error {
+	return d.writer.WriteMsg(&syncpb.BlockSpan{Span: &syncpb.BlockSpan_Found{Found: found}})
+}
+
+func (d *delimitedDeltaWriter) WriteMissing(missing *syncpb.MissingBlockSpan) error {
+	return d.writer.WriteMsg(&syncpb.BlockSpan{Span: &syncpb.BlockSpan_Missing{Missing: missing}})
+}
+
+func (d *delimitedDeltaWriter) WriteTrailer(trailer *syncpb.PatchTrailer) error {
+	return d.writer.WriteMsg(&syncpb.BlockSpan{Span: &syncpb.BlockSpan_Trailer{Trailer: trailer}})
+}
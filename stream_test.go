@@ -0,0 +1,240 @@
+package gosync
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
+	"math/rand"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/rkcloudchain/gosync/syncpb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// planWriter collects a streamed delta into a patch plan.
+type planWriter struct {
+	plan *syncpb.PatcherBlockSpan
+}
+
+func (w *planWriter) WriteHeader(header *syncpb.PatcherBlockSpan) error {
+	w.plan = header
+	return nil
+}
+
+func (w *planWriter) WriteFound(found *syncpb.FoundBlockSpan) error {
+	w.plan.Found = append(w.plan.Found, found)
+	return nil
+}
+
+func (w *planWriter) WriteMissing(missing *syncpb.MissingBlockSpan) error {
+	w.plan.Missing = append(w.plan.Missing, missing)
+	return nil
+}
+
+func (w *planWriter) WriteTrailer(trailer *syncpb.PatchTrailer) error {
+	w.plan.SourceDigest = trailer.SourceDigest
+	return nil
+}
+
+func TestDeltaStream(t *testing.T) {
+	dst := []byte("aabbccddeeffgg")
+	src := []byte("123aabb456ccdd789ee321ff21gg")
+
+	r := &rsync{blockSize: 4, strongHasher: md5.New, weakHasher: Adler32, requestBlockSize: 2}
+	checksums, err := r.Sign(bytes.NewReader(dst))
+	require.NoError(t, err)
+
+	w := &planWriter{}
+	require.NoError(t, r.DeltaStream(iotest.OneByteReader(bytes.NewReader(src)), checksums, w))
+	assert.Equal(t, uint32(formatVersion), w.plan.FormatVersion)
+	assert.Equal(t, int64(len(dst)), w.plan.BasisLength)
+
+	require.Len(t, w.plan.Found, 3)
+	assert.Equal(t, int64(3), w.plan.Found[0].ComparisonOffset)
+	assert.Equal(t, uint32(0), w.plan.Found[0].StartIndex)
+	assert.Equal(t, uint32(0), w.plan.Found[0].EndIndex)
+	assert.Equal(t, int64(4), w.plan.Found[0].BlockSize)
+
+	var missing int64
+	for _, block := range w.plan.Missing {
+		assert.True(t, block.EndOffset-block.StartOffset+1 <= 2)
+		assert.Nil(t, block.Data)
+		digest := md5.Sum(src[block.StartOffset : block.EndOffset+1])
+		assert.Equal(t, digest[:], block.Digest)
+		missing += block.EndOffset - block.StartOffset + 1
+	}
+	assert.Equal(t, int64(len(src)-10), missing)
+
+	r.reference = BytesRequester(src)
+	output := bytes.NewBuffer(nil)
+	require.NoError(t, r.Patch(bytes.NewReader(dst), w.plan, output))
+	assert.Equal(t, src, output.Bytes())
+}
+
+func TestDeltaStreamEmbedded(t *testing.T) {
+	rnd := rand.New(rand.NewSource(5))
+	dst := make([]byte, 10000)
+	rnd.Read(dst)
+
+	src := append([]byte(nil), dst[:3000]...)
+	src = append(src, make([]byte, 1500)...)
+	src = append(src, dst[3100:]...)
+	src = append(src, []byte("trailer")...)
+
+	r := &rsync{blockSize: 64, strongHasher: md5.New, weakHasher: Rollsum, requestBlockSize: 512, embedLiterals: true}
+	checksums, err := r.Sign(bytes.NewReader(dst))
+	require.NoError(t, err)
+
+	w := &planWriter{}
+	require.NoError(t, r.DeltaStream(bytes.NewReader(src), checksums, w))
+	for _, block := range w.plan.Missing {
+		assert.Equal(t, src[block.StartOffset:block.EndOffset+1], block.Data)
+		assert.True(t, len(block.Data) <= 512)
+	}
+
+	output := bytes.NewBuffer(nil)
+	require.NoError(t, r.Patch(bytes.NewReader(dst), w.plan, output))
+	assert.Equal(t, src, output.Bytes())
+}
+
+func TestDeltaStreamEmptyChecksums(t *testing.T) {
+	src := []byte("abcdefghijklmn")
+	r := &rsync{blockSize: 4, strongHasher: md5.New, weakHasher: Adler32}
+
+	checksums, err := r.Sign(bytes.NewReader(nil))
+	require.NoError(t, err)
+
+	w := &planWriter{}
+	require.NoError(t, r.DeltaStream(bytes.NewReader(src), checksums, w))
+	assert.Len(t, w.plan.Found, 0)
+	require.Len(t, w.plan.Missing, 1)
+	assert.Equal(t, int64(0), w.plan.Missing[0].StartOffset)
+	assert.Equal(t, int64(len(src)-1), w.plan.Missing[0].EndOffset)
+}
+
+type failingDeltaWriter struct {
+	planWriter
+}
+
+func (w *failingDeltaWriter) WriteMissing(*syncpb.MissingBlockSpan) error {
+	return errors.New("closed")
+}
+
+func TestDeltaStreamWriterError(t *testing.T) {
+	r := &rsync{blockSize: 4, strongHasher: md5.New, weakHasher: Adler32}
+	checksums, err := r.Sign(bytes.NewReader([]byte("aabbccdd")))
+	require.NoError(t, err)
+
+	err = r.DeltaStream(bytes.NewReader([]byte("xaabbccdd")), checksums, &failingDeltaWriter{})
+	assert.EqualError(t, err, "closed")
+
+	err = r.DeltaStream(iotest.TimeoutReader(bytes.NewReader(make([]byte, 64))), checksums, &planWriter{})
+	assert.Equal(t, iotest.ErrTimeout, err)
+}
+
+func TestPatchStreamFromChannel(t *testing.T) {
+	rnd := rand.New(rand.NewSource(9))
+	dst := make([]byte, 20000)
+	rnd.Read(dst)
+
+	src := append([]byte("header"), dst[:8000]...)
+	src = append(src, dst[12000:]...)
+
+	r := &rsync{blockSize: 128, strongHasher: md5.New, weakHasher: Adler32, requestBlockSize: 1024, reference: BytesRequester(src)}
+	checksums, err := r.Sign(bytes.NewReader(dst))
+	require.NoError(t, err)
+
+	ch := make(chan *syncpb.BlockSpan)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(ch)
+		signer := &rsync{blockSize: 128, strongHasher: md5.New, weakHasher: Adler32, requestBlockSize: 1024}
+		errc <- signer.DeltaStream(bytes.NewReader(src), checksums, NewChanDeltaWriter(ch))
+	}()
+
+	output := bytes.NewBuffer(nil)
+	require.NoError(t, r.PatchStream(bytes.NewReader(dst), NewChanSpanReader(ch), output))
+	require.NoError(t, <-errc)
+	assert.Equal(t, src, output.Bytes())
+}
+
+func TestStreamContextCancelled(t *testing.T) {
+	dst := []byte("The qwik brown fox jumped 0v3r the lazy")
+	src := []byte("The quick brown fox jumped over the lazy dog")
+
+	r := &rsync{blockSize: 4, strongHasher: md5.New, weakHasher: Adler32, requestBlockSize: 8, reference: BytesRequester(src)}
+	checksums, err := r.Sign(bytes.NewReader(dst))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// Nobody reads the spans, the producer gives up once ctx is done.
+	ch := make(chan *syncpb.BlockSpan)
+	err = r.DeltaStreamContext(ctx, bytes.NewReader(src), checksums, NewChanDeltaWriterContext(ctx, ch))
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// Nobody sends the spans, the consumer gives up too.
+	err = r.PatchStreamContext(ctx, bytes.NewReader(dst), NewChanSpanReaderContext(ctx, ch), bytes.NewBuffer(nil))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), context.DeadlineExceeded.Error())
+
+	err = r.DeltaStreamContext(ctx, bytes.NewReader(src), checksums, &planWriter{})
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestPatchStreamDelimited(t *testing.T) {
+	dst := []byte("The qwik brown fox jumped 0v3r the lazy")
+	src := []byte("The quick brown fox jumped over the lazy dog")
+
+	r := &rsync{blockSize: 4, strongHasher: md5.New, weakHasher: Adler32, requestBlockSize: 8, embedLiterals: true}
+
+	checksums, err := r.Sign(bytes.NewReader(dst))
+	require.NoError(t, err)
+
+	buffer := bytes.NewBuffer(nil)
+	require.NoError(t, r.DeltaStream(bytes.NewReader(src), checksums, NewDelimitedDeltaWriter(buffer)))
+
+	output := bytes.NewBuffer(nil)
+	require.NoError(t, r.PatchStream(bytes.NewReader(dst), NewDelimitedSpanReader(buffer), output))
+	assert.Equal(t, src, output.Bytes())
+}
+
+func TestPatchStreamOrdering(t *testing.T) {
+	r := &rsync{blockSize: 4, strongHasher: md5.New, weakHasher: Adler32, reference: BytesRequester([]byte("0123456789"))}
+	local := bytes.NewReader([]byte("abcdefgh"))
+
+	spans := func(s ...*syncpb.BlockSpan) SpanReader {
+		ch := make(chan *syncpb.BlockSpan, len(s))
+		for _, span := range s {
+			ch <- span
+		}
+		close(ch)
+		return NewChanSpanReader(ch)
+	}
+	found := &syncpb.BlockSpan{Span: &syncpb.BlockSpan_Found{Found: &syncpb.FoundBlockSpan{ComparisonOffset: 0, BlockSize: 4}}}
+	missing := &syncpb.BlockSpan{Span: &syncpb.BlockSpan_Missing{Missing: &syncpb.MissingBlockSpan{StartOffset: 4, EndOffset: 5}}}
+	header := &syncpb.BlockSpan{Span: &syncpb.BlockSpan_Header{Header: &syncpb.PatcherBlockSpan{FormatVersion: formatVersion, BasisLength: 8}}}
+
+	trailer := &syncpb.BlockSpan{Span: &syncpb.BlockSpan_Trailer{Trailer: &syncpb.PatchTrailer{}}}
+
+	output := bytes.NewBuffer(nil)
+	require.NoError(t, r.PatchStream(local, spans(header, found, missing, trailer), output))
+	assert.Equal(t, []byte("abcd45"), output.Bytes())
+
+	err := r.PatchStream(local, spans(header, found, missing), bytes.NewBuffer(nil))
+	assert.EqualError(t, err, "Missing trailer at the end of the spans")
+
+	err = r.PatchStream(local, spans(missing, found), bytes.NewBuffer(nil))
+	assert.EqualError(t, err, "Could not find block offset in missing or matched list: 0")
+
+	err = r.PatchStream(local, spans(found, header), bytes.NewBuffer(nil))
+	assert.EqualError(t, err, "Unexpected header after the first span")
+
+	err = r.PatchStream(local, spans(&syncpb.BlockSpan{}), bytes.NewBuffer(nil))
+	assert.Error(t, err)
+}
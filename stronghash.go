@@ -0,0 +1,43 @@
+package gosync
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+
+	"github.com/rkcloudchain/gosync/syncpb"
+)
+
+var strongHashProbe = []byte("gosync")
+
+var strongHashDigests = map[syncpb.StrongHashAlgorithm][]byte{
+	syncpb.StrongHashMD5:    computeStrongHash(md5.New(), strongHashProbe),
+	syncpb.StrongHashSHA1:   computeStrongHash(sha1.New(), strongHashProbe),
+	syncpb.StrongHashSHA256: computeStrongHash(sha256.New(), strongHashProbe),
+	syncpb.StrongHashSHA512: computeStrongHash(sha512.New(), strongHashProbe),
+}
+
+// strongHashAlgorithm identifies a well-known hash function by its output on a probe,
+// since hash.Hash does not expose its algorithm.
+func strongHashAlgorithm(h hash.Hash) syncpb.StrongHashAlgorithm {
+	sum := computeStrongHash(h, strongHashProbe)
+	for alg, digest := range strongHashDigests {
+		if bytes.Equal(sum, digest) {
+			return alg
+		}
+	}
+
+	return syncpb.StrongHashCustom
+}
+
+// customHashProbe returns the output of a custom hash function on the probe, which tells
+// custom functions apart. Well-known functions are identified by their algorithm alone.
+func customHashProbe(h hash.Hash, algorithm syncpb.StrongHashAlgorithm) []byte {
+	if algorithm != syncpb.StrongHashCustom {
+		return nil
+	}
+	return computeStrongHash(h, strongHashProbe)
+}
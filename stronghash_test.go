@@ -0,0 +1,22 @@
+package gosync
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash/crc32"
+	"testing"
+
+	"github.com/rkcloudchain/gosync/syncpb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStrongHashAlgorithm(t *testing.T) {
+	assert.Equal(t, syncpb.StrongHashMD5, strongHashAlgorithm(md5.New()))
+	assert.Equal(t, syncpb.StrongHashSHA1, strongHashAlgorithm(sha1.New()))
+	assert.Equal(t, syncpb.StrongHashSHA256, strongHashAlgorithm(sha256.New()))
+	assert.Equal(t, syncpb.StrongHashSHA512, strongHashAlgorithm(sha512.New()))
+	assert.Equal(t, syncpb.StrongHashCustom, strongHashAlgorithm(sha512.New384()))
+	assert.Equal(t, syncpb.StrongHashCustom, strongHashAlgorithm(crc32.NewIEEE()))
+}
@@ -4,9 +4,11 @@
 package syncpb
 
 import (
+	context "context"
 	fmt "fmt"
 	_ "github.com/gogo/protobuf/gogoproto"
 	proto "github.com/golang/protobuf/proto"
+	grpc "google.golang.org/grpc"
 	io "io"
 	math "math"
 )
@@ -22,12 +24,115 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
 
+type WeakHashAlgorithm int32
+
+const (
+	WeakHashAdler32   WeakHashAlgorithm = 0
+	WeakHashRollsum   WeakHashAlgorithm = 1
+	WeakHashRabinKarp WeakHashAlgorithm = 2
+	WeakHashBuzhash   WeakHashAlgorithm = 3
+)
+
+var WeakHashAlgorithm_name = map[int32]string{
+	0: "WEAK_HASH_ADLER32",
+	1: "WEAK_HASH_ROLLSUM",
+	2: "WEAK_HASH_RABIN_KARP",
+	3: "WEAK_HASH_BUZHASH",
+}
+
+var WeakHashAlgorithm_value = map[string]int32{
+	"WEAK_HASH_ADLER32":    0,
+	"WEAK_HASH_ROLLSUM":    1,
+	"WEAK_HASH_RABIN_KARP": 2,
+	"WEAK_HASH_BUZHASH":    3,
+}
+
+func (x WeakHashAlgorithm) String() string {
+	return proto.EnumName(WeakHashAlgorithm_name, int32(x))
+}
+
+func (WeakHashAlgorithm) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_80ada1672304bdc6, []int{0}
+}
+
+type StrongHashAlgorithm int32
+
+const (
+	StrongHashCustom StrongHashAlgorithm = 0
+	StrongHashMD5    StrongHashAlgorithm = 1
+	StrongHashSHA1   StrongHashAlgorithm = 2
+	StrongHashSHA256 StrongHashAlgorithm = 3
+	StrongHashSHA512 StrongHashAlgorithm = 4
+)
+
+var StrongHashAlgorithm_name = map[int32]string{
+	0: "STRONG_HASH_CUSTOM",
+	1: "STRONG_HASH_MD5",
+	2: "STRONG_HASH_SHA1",
+	3: "STRONG_HASH_SHA256",
+	4: "STRONG_HASH_SHA512",
+}
+
+var StrongHashAlgorithm_value = map[string]int32{
+	"STRONG_HASH_CUSTOM": 0,
+	"STRONG_HASH_MD5":    1,
+	"STRONG_HASH_SHA1":   2,
+	"STRONG_HASH_SHA256": 3,
+	"STRONG_HASH_SHA512": 4,
+}
+
+func (x StrongHashAlgorithm) String() string {
+	return proto.EnumName(StrongHashAlgorithm_name, int32(x))
+}
+
+func (StrongHashAlgorithm) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_80ada1672304bdc6, []int{1}
+}
+
+type ChunkingAlgorithm int32
+
+const (
+	ChunkingFixed   ChunkingAlgorithm = 0
+	ChunkingFastCDC ChunkingAlgorithm = 1
+)
+
+var ChunkingAlgorithm_name = map[int32]string{
+	0: "CHUNKING_FIXED",
+	1: "CHUNKING_FASTCDC",
+}
+
+var ChunkingAlgorithm_value = map[string]int32{
+	"CHUNKING_FIXED":   0,
+	"CHUNKING_FASTCDC": 1,
+}
+
+func (x ChunkingAlgorithm) String() string {
+	return proto.EnumName(ChunkingAlgorithm_name, int32(x))
+}
+
+func (ChunkingAlgorithm) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_80ada1672304bdc6, []int{2}
+}
+
 type ChunkChecksums struct {
-	ConfigBlockSize      int64            `protobuf:"varint,1,opt,name=config_block_size,json=configBlockSize,proto3" json:"config_block_size,omitempty"`
-	Checksums            []*ChunkChecksum `protobuf:"bytes,2,rep,name=checksums,proto3" json:"checksums,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}         `json:"-"`
-	XXX_unrecognized     []byte           `json:"-"`
-	XXX_sizecache        int32            `json:"-"`
+	ConfigBlockSize     int64               `protobuf:"varint,1,opt,name=config_block_size,json=configBlockSize,proto3" json:"config_block_size,omitempty"`
+	Checksums           []*ChunkChecksum    `protobuf:"bytes,2,rep,name=checksums,proto3" json:"checksums,omitempty"`
+	WeakHashAlgorithm   WeakHashAlgorithm   `protobuf:"varint,3,opt,name=weak_hash_algorithm,json=weakHashAlgorithm,proto3,enum=syncpb.WeakHashAlgorithm" json:"weak_hash_algorithm,omitempty"`
+	FormatVersion       uint32              `protobuf:"varint,4,opt,name=format_version,json=formatVersion,proto3" json:"format_version,omitempty"`
+	StrongHashAlgorithm StrongHashAlgorithm `protobuf:"varint,5,opt,name=strong_hash_algorithm,json=strongHashAlgorithm,proto3,enum=syncpb.StrongHashAlgorithm" json:"strong_hash_algorithm,omitempty"`
+	StrongHashLength    uint32              `protobuf:"varint,6,opt,name=strong_hash_length,json=strongHashLength,proto3" json:"strong_hash_length,omitempty"`
+	SourceLength        int64               `protobuf:"varint,7,opt,name=source_length,json=sourceLength,proto3" json:"source_length,omitempty"`
+	// block_hashes_digest is the strong hash of the concatenated full-length strong
+	// hashes of the blocks. It is omitted when the hashes are truncated.
+	BlockHashesDigest []byte            `protobuf:"bytes,8,opt,name=block_hashes_digest,json=blockHashesDigest,proto3" json:"block_hashes_digest,omitempty"`
+	ChunkingAlgorithm ChunkingAlgorithm `protobuf:"varint,9,opt,name=chunking_algorithm,json=chunkingAlgorithm,proto3,enum=syncpb.ChunkingAlgorithm" json:"chunking_algorithm,omitempty"`
+	MinChunkSize      int64             `protobuf:"varint,10,opt,name=min_chunk_size,json=minChunkSize,proto3" json:"min_chunk_size,omitempty"`
+	MaxChunkSize      int64             `protobuf:"varint,11,opt,name=max_chunk_size,json=maxChunkSize,proto3" json:"max_chunk_size,omitempty"`
+	// strong_hash_probe tells custom strong hash algorithms apart.
+	StrongHashProbe      []byte   `protobuf:"bytes,12,opt,name=strong_hash_probe,json=strongHashProbe,proto3" json:"strong_hash_probe,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
 func (m *ChunkChecksums) Reset()         { *m = ChunkChecksums{} }
@@ -68,6 +173,7 @@ type ChunkChecksum struct {
 	WeakHash             uint32   `protobuf:"varint,2,opt,name=weak_hash,json=weakHash,proto3" json:"weak_hash,omitempty"`
 	StrongHash           []byte   `protobuf:"bytes,3,opt,name=strong_hash,json=strongHash,proto3" json:"strong_hash,omitempty"`
 	BlockSize            int64    `protobuf:"varint,4,opt,name=block_size,json=blockSize,proto3" json:"block_size,omitempty"`
+	Offset               int64    `protobuf:"varint,5,opt,name=offset,proto3" json:"offset,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -109,6 +215,12 @@ var xxx_messageInfo_ChunkChecksum proto.InternalMessageInfo
 type PatcherBlockSpan struct {
 	Found                []*FoundBlockSpan   `protobuf:"bytes,1,rep,name=found,proto3" json:"found,omitempty"`
 	Missing              []*MissingBlockSpan `protobuf:"bytes,2,rep,name=missing,proto3" json:"missing,omitempty"`
+	FormatVersion        uint32              `protobuf:"varint,3,opt,name=format_version,json=formatVersion,proto3" json:"format_version,omitempty"`
+	BasisLength          int64               `protobuf:"varint,4,opt,name=basis_length,json=basisLength,proto3" json:"basis_length,omitempty"`
+	SourceDigest         []byte              `protobuf:"bytes,5,opt,name=source_digest,json=sourceDigest,proto3" json:"source_digest,omitempty"`
+	DigestAlgorithm      StrongHashAlgorithm `protobuf:"varint,6,opt,name=digest_algorithm,json=digestAlgorithm,proto3,enum=syncpb.StrongHashAlgorithm" json:"digest_algorithm,omitempty"`
+	ConfigBlockSize      int64               `protobuf:"varint,7,opt,name=config_block_size,json=configBlockSize,proto3" json:"config_block_size,omitempty"`
+	DigestProbe          []byte              `protobuf:"bytes,8,opt,name=digest_probe,json=digestProbe,proto3" json:"digest_probe,omitempty"`
 	XXX_NoUnkeyedLiteral struct{}            `json:"-"`
 	XXX_unrecognized     []byte              `json:"-"`
 	XXX_sizecache        int32               `json:"-"`
@@ -152,6 +264,8 @@ type FoundBlockSpan struct {
 	StartIndex           uint32   `protobuf:"varint,2,opt,name=start_index,json=startIndex,proto3" json:"start_index,omitempty"`
 	EndIndex             uint32   `protobuf:"varint,3,opt,name=end_index,json=endIndex,proto3" json:"end_index,omitempty"`
 	BlockSize            int64    `protobuf:"varint,4,opt,name=block_size,json=blockSize,proto3" json:"block_size,omitempty"`
+	Digest               []byte   `protobuf:"bytes,5,opt,name=digest,proto3" json:"digest,omitempty"`
+	LocalOffset          int64    `protobuf:"varint,6,opt,name=local_offset,json=localOffset,proto3" json:"local_offset,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -193,6 +307,8 @@ var xxx_messageInfo_FoundBlockSpan proto.InternalMessageInfo
 type MissingBlockSpan struct {
 	StartOffset          int64    `protobuf:"varint,1,opt,name=start_offset,json=startOffset,proto3" json:"start_offset,omitempty"`
 	EndOffset            int64    `protobuf:"varint,2,opt,name=end_offset,json=endOffset,proto3" json:"end_offset,omitempty"`
+	Data                 []byte   `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+	Digest               []byte   `protobuf:"bytes,4,opt,name=digest,proto3" json:"digest,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -231,218 +347,655 @@ func (m *MissingBlockSpan) XXX_DiscardUnknown() {
 
 var xxx_messageInfo_MissingBlockSpan proto.InternalMessageInfo
 
-func init() {
-	proto.RegisterType((*ChunkChecksums)(nil), "syncpb.ChunkChecksums")
-	proto.RegisterType((*ChunkChecksum)(nil), "syncpb.ChunkChecksum")
-	proto.RegisterType((*PatcherBlockSpan)(nil), "syncpb.PatcherBlockSpan")
-	proto.RegisterType((*FoundBlockSpan)(nil), "syncpb.FoundBlockSpan")
-	proto.RegisterType((*MissingBlockSpan)(nil), "syncpb.MissingBlockSpan")
+type PatchTrailer struct {
+	SourceDigest         []byte   `protobuf:"bytes,1,opt,name=source_digest,json=sourceDigest,proto3" json:"source_digest,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
-func init() {
-	proto.RegisterFile("github.com/rkcloudchain/gosync/syncpb/sync.proto", fileDescriptor_80ada1672304bdc6)
+func (m *PatchTrailer) Reset()         { *m = PatchTrailer{} }
+func (m *PatchTrailer) String() string { return proto.CompactTextString(m) }
+func (*PatchTrailer) ProtoMessage()    {}
+func (*PatchTrailer) Descriptor() ([]byte, []int) {
+	return fileDescriptor_80ada1672304bdc6, []int{5}
 }
-
-var fileDescriptor_80ada1672304bdc6 = []byte{
-	// 432 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x92, 0xcd, 0x8e, 0xd3, 0x30,
-	0x14, 0x85, 0xeb, 0x16, 0x06, 0x7a, 0xe7, 0x87, 0x62, 0x01, 0x8a, 0x40, 0x13, 0x4a, 0x25, 0xa4,
-	0x0a, 0x50, 0x8b, 0x66, 0x1e, 0x00, 0x69, 0x46, 0x42, 0xb0, 0x40, 0xa0, 0xc0, 0x8a, 0x4d, 0xe5,
-	0x38, 0x4e, 0x6c, 0x65, 0x62, 0x87, 0x38, 0x11, 0x30, 0xef, 0xc0, 0x1e, 0xf1, 0x44, 0xb3, 0x9c,
-	0x47, 0x60, 0xca, 0x8b, 0x20, 0xfb, 0x26, 0x2d, 0x61, 0x03, 0x9b, 0x36, 0xfa, 0xce, 0xb1, 0xef,
-	0x3d, 0x47, 0x86, 0xe7, 0x99, 0xaa, 0x65, 0x13, 0x2f, 0xb8, 0x29, 0x96, 0x55, 0xce, 0xcf, 0x4c,
-	0x93, 0x70, 0xc9, 0x94, 0x5e, 0x66, 0xc6, 0x7e, 0xd5, 0x7c, 0xe9, 0x7e, 0xca, 0xd8, 0xff, 0x2d,
-	0xca, 0xca, 0xd4, 0x86, 0xee, 0x20, 0xba, 0x7f, 0x27, 0x33, 0x99, 0xf1, 0x68, 0xe9, 0xbe, 0x50,
-	0x9d, 0x7d, 0x82, 0x83, 0x53, 0xd9, 0xe8, 0xfc, 0x54, 0x0a, 0x9e, 0xdb, 0xa6, 0xb0, 0xf4, 0x09,
-	0xdc, 0xe6, 0x46, 0xa7, 0x2a, 0x5b, 0xc5, 0x67, 0x86, 0xe7, 0x2b, 0xab, 0xce, 0x45, 0x40, 0xa6,
-	0x64, 0x3e, 0x8a, 0x6e, 0xa1, 0x70, 0xe2, 0xf8, 0x7b, 0x75, 0x2e, 0xe8, 0x31, 0x8c, 0x79, 0x77,
-	0x30, 0x18, 0x4e, 0x47, 0xf3, 0xdd, 0xa3, 0xbb, 0x0b, 0x9c, 0xb7, 0xe8, 0x5d, 0x1b, 0x6d, 0x7d,
-	0xb3, 0x6f, 0x04, 0xf6, 0x7b, 0x22, 0x7d, 0x08, 0xbb, 0x38, 0x4b, 0xe9, 0x44, 0x7c, 0xf1, 0xc3,
-	0xf6, 0x23, 0xf0, 0xe8, 0xb5, 0x23, 0xf4, 0x01, 0x8c, 0x3f, 0x0b, 0x96, 0xaf, 0x24, 0xb3, 0x32,
-	0x18, 0x7a, 0xf9, 0xa6, 0x03, 0xaf, 0x98, 0x95, 0xee, 0xb4, 0xad, 0x2b, 0xa3, 0x33, 0x94, 0x47,
-	0x53, 0x32, 0xdf, 0x8b, 0x00, 0x91, 0x37, 0x1c, 0x02, 0xfc, 0x11, 0xe5, 0x9a, 0x8f, 0x32, 0x8e,
-	0xbb, 0x10, 0xb3, 0x1a, 0x26, 0xef, 0x58, 0xcd, 0xa5, 0xa8, 0x30, 0x58, 0xc9, 0x34, 0x7d, 0x06,
-	0xd7, 0x53, 0xd3, 0xe8, 0x24, 0x20, 0x3e, 0xd4, 0xbd, 0x2e, 0xd4, 0x4b, 0x07, 0x37, 0xb6, 0x08,
-	0x4d, 0xf4, 0x08, 0x6e, 0x14, 0xca, 0x5a, 0xa5, 0xb3, 0xb6, 0x84, 0xa0, 0xf3, 0xbf, 0x41, 0xbc,
-	0x3d, 0xd1, 0x19, 0x67, 0x3f, 0x08, 0x1c, 0xf4, 0x6f, 0xa3, 0x4f, 0x5d, 0xf3, 0x45, 0xc9, 0x2a,
-	0x65, 0x8d, 0x5e, 0x99, 0x34, 0xb5, 0xa2, 0x6e, 0x9b, 0x9f, 0x6c, 0x85, 0xb7, 0x9e, 0x63, 0x6a,
-	0x56, 0xd5, 0x6d, 0x67, 0x58, 0x0a, 0x78, 0xb4, 0xe9, 0x4c, 0xe8, 0xa4, 0x95, 0x47, 0xd8, 0x99,
-	0xd0, 0x09, 0x8a, 0xff, 0xa8, 0xe4, 0x03, 0x4c, 0xfe, 0xde, 0x9c, 0x3e, 0x82, 0x3d, 0x1c, 0xd8,
-	0x5b, 0x0c, 0x97, 0x68, 0x77, 0x3a, 0x04, 0x70, 0x23, 0x5b, 0xc3, 0x10, 0x6f, 0x15, 0x3a, 0x41,
-	0xf9, 0xe4, 0xc5, 0xc5, 0x55, 0x38, 0xb8, 0xbc, 0x0a, 0x07, 0x17, 0xeb, 0x90, 0x5c, 0xae, 0x43,
-	0xf2, 0x73, 0x1d, 0x92, 0xef, 0xbf, 0xc2, 0xc1, 0xc7, 0xc7, 0xff, 0xf5, 0xaa, 0xe3, 0x1d, 0xff,
-	0x66, 0x8f, 0x7f, 0x07, 0x00, 0x00, 0xff, 0xff, 0xb7, 0x3a, 0xbb, 0xbb, 0x05, 0x03, 0x00, 0x00,
+func (m *PatchTrailer) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
 }
-
-func (m *ChunkChecksums) Marshal() (dAtA []byte, err error) {
-	size := m.Size()
-	dAtA = make([]byte, size)
-	n, err := m.MarshalTo(dAtA)
-	if err != nil {
-		return nil, err
+func (m *PatchTrailer) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_PatchTrailer.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalTo(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
 	}
-	return dAtA[:n], nil
+}
+func (m *PatchTrailer) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PatchTrailer.Merge(m, src)
+}
+func (m *PatchTrailer) XXX_Size() int {
+	return m.Size()
+}
+func (m *PatchTrailer) XXX_DiscardUnknown() {
+	xxx_messageInfo_PatchTrailer.DiscardUnknown(m)
 }
 
-func (m *ChunkChecksums) MarshalTo(dAtA []byte) (int, error) {
-	var i int
-	_ = i
-	var l int
-	_ = l
-	if m.ConfigBlockSize != 0 {
-		dAtA[i] = 0x8
-		i++
-		i = encodeVarintSync(dAtA, i, uint64(m.ConfigBlockSize))
-	}
-	if len(m.Checksums) > 0 {
-		for _, msg := range m.Checksums {
-			dAtA[i] = 0x12
-			i++
-			i = encodeVarintSync(dAtA, i, uint64(msg.Size()))
-			n, err := msg.MarshalTo(dAtA[i:])
-			if err != nil {
-				return 0, err
-			}
-			i += n
+var xxx_messageInfo_PatchTrailer proto.InternalMessageInfo
+
+type BlockSpan struct {
+	// Types that are valid to be assigned to Span:
+	//	*BlockSpan_Header
+	//	*BlockSpan_Found
+	//	*BlockSpan_Missing
+	//	*BlockSpan_Trailer
+	Span                 isBlockSpan_Span `protobuf_oneof:"span"`
+	XXX_NoUnkeyedLiteral struct{}         `json:"-"`
+	XXX_unrecognized     []byte           `json:"-"`
+	XXX_sizecache        int32            `json:"-"`
+}
+
+func (m *BlockSpan) Reset()         { *m = BlockSpan{} }
+func (m *BlockSpan) String() string { return proto.CompactTextString(m) }
+func (*BlockSpan) ProtoMessage()    {}
+func (*BlockSpan) Descriptor() ([]byte, []int) {
+	return fileDescriptor_80ada1672304bdc6, []int{6}
+}
+func (m *BlockSpan) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *BlockSpan) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_BlockSpan.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalTo(b)
+		if err != nil {
+			return nil, err
 		}
+		return b[:n], nil
 	}
-	if m.XXX_unrecognized != nil {
-		i += copy(dAtA[i:], m.XXX_unrecognized)
-	}
-	return i, nil
+}
+func (m *BlockSpan) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BlockSpan.Merge(m, src)
+}
+func (m *BlockSpan) XXX_Size() int {
+	return m.Size()
+}
+func (m *BlockSpan) XXX_DiscardUnknown() {
+	xxx_messageInfo_BlockSpan.DiscardUnknown(m)
 }
 
-func (m *ChunkChecksum) Marshal() (dAtA []byte, err error) {
-	size := m.Size()
-	dAtA = make([]byte, size)
-	n, err := m.MarshalTo(dAtA)
-	if err != nil {
-		return nil, err
-	}
-	return dAtA[:n], nil
+var xxx_messageInfo_BlockSpan proto.InternalMessageInfo
+
+type isBlockSpan_Span interface {
+	isBlockSpan_Span()
+	MarshalTo([]byte) (int, error)
+	Size() int
 }
 
-func (m *ChunkChecksum) MarshalTo(dAtA []byte) (int, error) {
-	var i int
-	_ = i
-	var l int
-	_ = l
-	if m.BlockIndex != 0 {
-		dAtA[i] = 0x8
-		i++
-		i = encodeVarintSync(dAtA, i, uint64(m.BlockIndex))
+type BlockSpan_Header struct {
+	Header *PatcherBlockSpan `protobuf:"bytes,1,opt,name=header,proto3,oneof"`
+}
+type BlockSpan_Found struct {
+	Found *FoundBlockSpan `protobuf:"bytes,2,opt,name=found,proto3,oneof"`
+}
+type BlockSpan_Missing struct {
+	Missing *MissingBlockSpan `protobuf:"bytes,3,opt,name=missing,proto3,oneof"`
+}
+type BlockSpan_Trailer struct {
+	Trailer *PatchTrailer `protobuf:"bytes,4,opt,name=trailer,proto3,oneof"`
+}
+
+func (*BlockSpan_Header) isBlockSpan_Span()  {}
+func (*BlockSpan_Found) isBlockSpan_Span()   {}
+func (*BlockSpan_Missing) isBlockSpan_Span() {}
+func (*BlockSpan_Trailer) isBlockSpan_Span() {}
+
+func (m *BlockSpan) GetSpan() isBlockSpan_Span {
+	if m != nil {
+		return m.Span
 	}
-	if m.WeakHash != 0 {
-		dAtA[i] = 0x10
-		i++
-		i = encodeVarintSync(dAtA, i, uint64(m.WeakHash))
+	return nil
+}
+
+func (m *BlockSpan) GetHeader() *PatcherBlockSpan {
+	if x, ok := m.GetSpan().(*BlockSpan_Header); ok {
+		return x.Header
 	}
-	if len(m.StrongHash) > 0 {
-		dAtA[i] = 0x1a
-		i++
-		i = encodeVarintSync(dAtA, i, uint64(len(m.StrongHash)))
-		i += copy(dAtA[i:], m.StrongHash)
+	return nil
+}
+
+func (m *BlockSpan) GetFound() *FoundBlockSpan {
+	if x, ok := m.GetSpan().(*BlockSpan_Found); ok {
+		return x.Found
 	}
-	if m.BlockSize != 0 {
-		dAtA[i] = 0x20
-		i++
-		i = encodeVarintSync(dAtA, i, uint64(m.BlockSize))
+	return nil
+}
+
+func (m *BlockSpan) GetMissing() *MissingBlockSpan {
+	if x, ok := m.GetSpan().(*BlockSpan_Missing); ok {
+		return x.Missing
 	}
-	if m.XXX_unrecognized != nil {
-		i += copy(dAtA[i:], m.XXX_unrecognized)
+	return nil
+}
+
+func (m *BlockSpan) GetTrailer() *PatchTrailer {
+	if x, ok := m.GetSpan().(*BlockSpan_Trailer); ok {
+		return x.Trailer
 	}
-	return i, nil
+	return nil
 }
 
-func (m *PatcherBlockSpan) Marshal() (dAtA []byte, err error) {
-	size := m.Size()
-	dAtA = make([]byte, size)
-	n, err := m.MarshalTo(dAtA)
-	if err != nil {
-		return nil, err
+// XXX_OneofFuncs is for the internal use of the proto package.
+func (*BlockSpan) XXX_OneofFuncs() (func(msg proto.Message, b *proto.Buffer) error, func(msg proto.Message, tag, wire int, b *proto.Buffer) (bool, error), func(msg proto.Message) (n int), []interface{}) {
+	return _BlockSpan_OneofMarshaler, _BlockSpan_OneofUnmarshaler, _BlockSpan_OneofSizer, []interface{}{
+		(*BlockSpan_Header)(nil),
+		(*BlockSpan_Found)(nil),
+		(*BlockSpan_Missing)(nil),
+		(*BlockSpan_Trailer)(nil),
 	}
-	return dAtA[:n], nil
 }
 
-func (m *PatcherBlockSpan) MarshalTo(dAtA []byte) (int, error) {
-	var i int
-	_ = i
-	var l int
-	_ = l
-	if len(m.Found) > 0 {
-		for _, msg := range m.Found {
-			dAtA[i] = 0xa
-			i++
-			i = encodeVarintSync(dAtA, i, uint64(msg.Size()))
-			n, err := msg.MarshalTo(dAtA[i:])
-			if err != nil {
-				return 0, err
-			}
-			i += n
+func _BlockSpan_OneofMarshaler(msg proto.Message, b *proto.Buffer) error {
+	m := msg.(*BlockSpan)
+	// span
+	switch x := m.Span.(type) {
+	case *BlockSpan_Header:
+		_ = b.EncodeVarint(1<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.Header); err != nil {
+			return err
 		}
-	}
-	if len(m.Missing) > 0 {
-		for _, msg := range m.Missing {
-			dAtA[i] = 0x12
-			i++
-			i = encodeVarintSync(dAtA, i, uint64(msg.Size()))
-			n, err := msg.MarshalTo(dAtA[i:])
-			if err != nil {
-				return 0, err
-			}
-			i += n
+	case *BlockSpan_Found:
+		_ = b.EncodeVarint(2<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.Found); err != nil {
+			return err
 		}
+	case *BlockSpan_Missing:
+		_ = b.EncodeVarint(3<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.Missing); err != nil {
+			return err
+		}
+	case *BlockSpan_Trailer:
+		_ = b.EncodeVarint(4<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.Trailer); err != nil {
+			return err
+		}
+	case nil:
+	default:
+		return fmt.Errorf("BlockSpan.Span has unexpected type %T", x)
 	}
-	if m.XXX_unrecognized != nil {
-		i += copy(dAtA[i:], m.XXX_unrecognized)
-	}
-	return i, nil
+	return nil
 }
 
-func (m *FoundBlockSpan) Marshal() (dAtA []byte, err error) {
-	size := m.Size()
-	dAtA = make([]byte, size)
-	n, err := m.MarshalTo(dAtA)
-	if err != nil {
-		return nil, err
+func _BlockSpan_OneofUnmarshaler(msg proto.Message, tag, wire int, b *proto.Buffer) (bool, error) {
+	m := msg.(*BlockSpan)
+	switch tag {
+	case 1: // span.header
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(PatcherBlockSpan)
+		err := b.DecodeMessage(msg)
+		m.Span = &BlockSpan_Header{msg}
+		return true, err
+	case 2: // span.found
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(FoundBlockSpan)
+		err := b.DecodeMessage(msg)
+		m.Span = &BlockSpan_Found{msg}
+		return true, err
+	case 3: // span.missing
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(MissingBlockSpan)
+		err := b.DecodeMessage(msg)
+		m.Span = &BlockSpan_Missing{msg}
+		return true, err
+	case 4: // span.trailer
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(PatchTrailer)
+		err := b.DecodeMessage(msg)
+		m.Span = &BlockSpan_Trailer{msg}
+		return true, err
+	default:
+		return false, nil
 	}
-	return dAtA[:n], nil
 }
 
-func (m *FoundBlockSpan) MarshalTo(dAtA []byte) (int, error) {
-	var i int
-	_ = i
-	var l int
-	_ = l
-	if m.ComparisonOffset != 0 {
-		dAtA[i] = 0x8
-		i++
-		i = encodeVarintSync(dAtA, i, uint64(m.ComparisonOffset))
-	}
-	if m.StartIndex != 0 {
-		dAtA[i] = 0x10
-		i++
-		i = encodeVarintSync(dAtA, i, uint64(m.StartIndex))
-	}
-	if m.EndIndex != 0 {
-		dAtA[i] = 0x18
-		i++
-		i = encodeVarintSync(dAtA, i, uint64(m.EndIndex))
-	}
-	if m.BlockSize != 0 {
-		dAtA[i] = 0x20
-		i++
-		i = encodeVarintSync(dAtA, i, uint64(m.BlockSize))
+func _BlockSpan_OneofSizer(msg proto.Message) (n int) {
+	m := msg.(*BlockSpan)
+	// span
+	switch x := m.Span.(type) {
+	case *BlockSpan_Header:
+		s := proto.Size(x.Header)
+		n += 1 // tag and wire
+		n += proto.SizeVarint(uint64(s))
+		n += s
+	case *BlockSpan_Found:
+		s := proto.Size(x.Found)
+		n += 1 // tag and wire
+		n += proto.SizeVarint(uint64(s))
+		n += s
+	case *BlockSpan_Missing:
+		s := proto.Size(x.Missing)
+		n += 1 // tag and wire
+		n += proto.SizeVarint(uint64(s))
+		n += s
+	case *BlockSpan_Trailer:
+		s := proto.Size(x.Trailer)
+		n += 1 // tag and wire
+		n += proto.SizeVarint(uint64(s))
+		n += s
+	case nil:
+	default:
+		panic(fmt.Sprintf("proto: unexpected type %T in oneof", x))
 	}
-	if m.XXX_unrecognized != nil {
-		i += copy(dAtA[i:], m.XXX_unrecognized)
-	}
-	return i, nil
+	return n
 }
 
-func (m *MissingBlockSpan) Marshal() (dAtA []byte, err error) {
-	size := m.Size()
-	dAtA = make([]byte, size)
+type SignatureRequest struct {
+	Path                 string   `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SignatureRequest) Reset()         { *m = SignatureRequest{} }
+func (m *SignatureRequest) String() string { return proto.CompactTextString(m) }
+func (*SignatureRequest) ProtoMessage()    {}
+func (*SignatureRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_80ada1672304bdc6, []int{7}
+}
+func (m *SignatureRequest) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *SignatureRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_SignatureRequest.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalTo(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *SignatureRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SignatureRequest.Merge(m, src)
+}
+func (m *SignatureRequest) XXX_Size() int {
+	return m.Size()
+}
+func (m *SignatureRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_SignatureRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SignatureRequest proto.InternalMessageInfo
+
+type DeltaRequest struct {
+	Path                 string          `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	Checksums            *ChunkChecksums `protobuf:"bytes,2,opt,name=checksums,proto3" json:"checksums,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
+	XXX_unrecognized     []byte          `json:"-"`
+	XXX_sizecache        int32           `json:"-"`
+}
+
+func (m *DeltaRequest) Reset()         { *m = DeltaRequest{} }
+func (m *DeltaRequest) String() string { return proto.CompactTextString(m) }
+func (*DeltaRequest) ProtoMessage()    {}
+func (*DeltaRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_80ada1672304bdc6, []int{8}
+}
+func (m *DeltaRequest) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *DeltaRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_DeltaRequest.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalTo(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *DeltaRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DeltaRequest.Merge(m, src)
+}
+func (m *DeltaRequest) XXX_Size() int {
+	return m.Size()
+}
+func (m *DeltaRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_DeltaRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DeltaRequest proto.InternalMessageInfo
+
+type FetchBlocksRequest struct {
+	Path                 string              `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	Spans                []*MissingBlockSpan `protobuf:"bytes,2,rep,name=spans,proto3" json:"spans,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}            `json:"-"`
+	XXX_unrecognized     []byte              `json:"-"`
+	XXX_sizecache        int32               `json:"-"`
+}
+
+func (m *FetchBlocksRequest) Reset()         { *m = FetchBlocksRequest{} }
+func (m *FetchBlocksRequest) String() string { return proto.CompactTextString(m) }
+func (*FetchBlocksRequest) ProtoMessage()    {}
+func (*FetchBlocksRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_80ada1672304bdc6, []int{9}
+}
+func (m *FetchBlocksRequest) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *FetchBlocksRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_FetchBlocksRequest.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalTo(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *FetchBlocksRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_FetchBlocksRequest.Merge(m, src)
+}
+func (m *FetchBlocksRequest) XXX_Size() int {
+	return m.Size()
+}
+func (m *FetchBlocksRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_FetchBlocksRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_FetchBlocksRequest proto.InternalMessageInfo
+
+func init() {
+	proto.RegisterEnum("syncpb.WeakHashAlgorithm", WeakHashAlgorithm_name, WeakHashAlgorithm_value)
+	proto.RegisterEnum("syncpb.StrongHashAlgorithm", StrongHashAlgorithm_name, StrongHashAlgorithm_value)
+	proto.RegisterEnum("syncpb.ChunkingAlgorithm", ChunkingAlgorithm_name, ChunkingAlgorithm_value)
+	proto.RegisterType((*ChunkChecksums)(nil), "syncpb.ChunkChecksums")
+	proto.RegisterType((*ChunkChecksum)(nil), "syncpb.ChunkChecksum")
+	proto.RegisterType((*PatcherBlockSpan)(nil), "syncpb.PatcherBlockSpan")
+	proto.RegisterType((*FoundBlockSpan)(nil), "syncpb.FoundBlockSpan")
+	proto.RegisterType((*MissingBlockSpan)(nil), "syncpb.MissingBlockSpan")
+	proto.RegisterType((*PatchTrailer)(nil), "syncpb.PatchTrailer")
+	proto.RegisterType((*BlockSpan)(nil), "syncpb.BlockSpan")
+	proto.RegisterType((*SignatureRequest)(nil), "syncpb.SignatureRequest")
+	proto.RegisterType((*DeltaRequest)(nil), "syncpb.DeltaRequest")
+	proto.RegisterType((*FetchBlocksRequest)(nil), "syncpb.FetchBlocksRequest")
+}
+
+func init() {
+	proto.RegisterFile("github.com/rkcloudchain/gosync/syncpb/sync.proto", fileDescriptor_80ada1672304bdc6)
+}
+
+var fileDescriptor_80ada1672304bdc6 = []byte{
+	// 1244 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x56, 0x4b, 0x73, 0xda, 0xd6,
+	0x17, 0x47, 0x80, 0x71, 0x38, 0x3c, 0x2c, 0xae, 0x9d, 0x0c, 0x7f, 0x32, 0xe1, 0x4f, 0x68, 0x93,
+	0xa1, 0x6e, 0x06, 0xdb, 0x38, 0xee, 0xb2, 0x2d, 0x0f, 0xdb, 0x78, 0xfc, 0x1c, 0xc9, 0x6e, 0x3c,
+	0xd9, 0x68, 0x2e, 0xe2, 0x5a, 0xd2, 0x00, 0x12, 0x95, 0x44, 0xe2, 0x78, 0xd5, 0xb5, 0x3f, 0x41,
+	0x37, 0x5e, 0xf6, 0xbb, 0x78, 0x99, 0x4d, 0xbb, 0x6d, 0xe3, 0x7e, 0x82, 0x2e, 0xdb, 0x55, 0x47,
+	0xf7, 0xea, 0x09, 0x38, 0xee, 0x06, 0xa4, 0xdf, 0xf9, 0x9d, 0x7b, 0x1e, 0xf7, 0x77, 0xee, 0x15,
+	0xac, 0x2b, 0x9a, 0xad, 0x4e, 0x7a, 0x75, 0xd9, 0x18, 0xad, 0x99, 0x03, 0x79, 0x68, 0x4c, 0xfa,
+	0xb2, 0x8a, 0x35, 0x7d, 0x4d, 0x31, 0xac, 0x0f, 0xba, 0xbc, 0xe6, 0xfc, 0x8c, 0x7b, 0xf4, 0xaf,
+	0x3e, 0x36, 0x0d, 0xdb, 0x40, 0x29, 0x06, 0x95, 0x56, 0x14, 0x43, 0x31, 0x28, 0xb4, 0xe6, 0x3c,
+	0x31, 0x6b, 0xf5, 0xef, 0x24, 0xe4, 0xdb, 0xea, 0x44, 0x1f, 0xb4, 0x55, 0x22, 0x0f, 0xac, 0xc9,
+	0xc8, 0x42, 0xab, 0x50, 0x90, 0x0d, 0xfd, 0x42, 0x53, 0xa4, 0xde, 0xd0, 0x90, 0x07, 0x92, 0xa5,
+	0x5d, 0x91, 0x22, 0x57, 0xe1, 0x6a, 0x09, 0x61, 0x89, 0x19, 0x5a, 0x0e, 0x2e, 0x6a, 0x57, 0x04,
+	0x6d, 0x42, 0x5a, 0xf6, 0x1c, 0x8b, 0xf1, 0x4a, 0xa2, 0x96, 0x69, 0x3c, 0xae, 0xb3, 0x80, 0xf5,
+	0xc8, 0xb2, 0x42, 0xc0, 0x43, 0x7b, 0xb0, 0xfc, 0x9e, 0xe0, 0x81, 0xa4, 0x62, 0x4b, 0x95, 0xf0,
+	0x50, 0x31, 0x4c, 0xcd, 0x56, 0x47, 0xc5, 0x44, 0x85, 0xab, 0xe5, 0x1b, 0xff, 0xf3, 0xdc, 0xdf,
+	0x10, 0x3c, 0xe8, 0x62, 0x4b, 0x6d, 0x7a, 0x04, 0xa1, 0xf0, 0x7e, 0x1a, 0x42, 0x2f, 0x20, 0x7f,
+	0x61, 0x98, 0x23, 0x6c, 0x4b, 0xef, 0x88, 0x69, 0x69, 0x86, 0x5e, 0x4c, 0x56, 0xb8, 0x5a, 0x4e,
+	0xc8, 0x31, 0xf4, 0x07, 0x06, 0xa2, 0x63, 0x78, 0x6c, 0xd9, 0xa6, 0xa1, 0x2b, 0xd3, 0x31, 0x17,
+	0x68, 0xcc, 0xa7, 0x5e, 0x4c, 0x91, 0x92, 0xa2, 0x51, 0x97, 0xad, 0x59, 0x10, 0xbd, 0x02, 0x14,
+	0x5e, 0x70, 0x48, 0x74, 0xc5, 0x56, 0x8b, 0x29, 0x1a, 0x9b, 0x0f, 0x1c, 0x0e, 0x28, 0x8e, 0xbe,
+	0x80, 0x9c, 0x65, 0x4c, 0x4c, 0x99, 0x78, 0xc4, 0x45, 0xda, 0xcd, 0x2c, 0x03, 0x5d, 0x52, 0x1d,
+	0x96, 0x59, 0xbf, 0x9d, 0x15, 0x89, 0x25, 0xf5, 0x35, 0x85, 0x58, 0x76, 0xf1, 0x51, 0x85, 0xab,
+	0x65, 0x85, 0x02, 0x35, 0x75, 0xa9, 0xa5, 0x43, 0x0d, 0xa8, 0x0b, 0x48, 0x76, 0x3a, 0xac, 0xe9,
+	0x4a, 0xa8, 0xa0, 0x74, 0xb4, 0x89, 0x6d, 0x97, 0x11, 0x6a, 0xa2, 0x3c, 0x0d, 0xa1, 0x2f, 0x21,
+	0x3f, 0xd2, 0x74, 0x89, 0x1a, 0xd8, 0x6e, 0x03, 0xcb, 0x6f, 0xa4, 0xe9, 0x74, 0x01, 0xba, 0xd5,
+	0x0e, 0x0b, 0x5f, 0x86, 0x59, 0x19, 0x97, 0x85, 0x2f, 0x03, 0xd6, 0x2a, 0x14, 0xc2, 0x8d, 0x19,
+	0x9b, 0x46, 0x8f, 0x14, 0xb3, 0xb4, 0x86, 0xa5, 0xa0, 0x2f, 0x27, 0x0e, 0x5c, 0xfd, 0x85, 0x83,
+	0x5c, 0x44, 0x24, 0xe8, 0xff, 0x90, 0x61, 0x3d, 0xd0, 0xf4, 0x3e, 0xb9, 0xa4, 0xa2, 0xcb, 0x09,
+	0x40, 0xa1, 0x3d, 0x07, 0x41, 0x4f, 0x21, 0xed, 0x4b, 0xa7, 0x18, 0xa7, 0xe6, 0x47, 0x9e, 0x2a,
+	0x1c, 0xef, 0x50, 0x6c, 0xaa, 0xa7, 0xac, 0x00, 0x41, 0x54, 0xf4, 0x0c, 0x20, 0x24, 0xe9, 0x24,
+	0x4d, 0x3f, 0xdd, 0xf3, 0xc5, 0xfc, 0x04, 0x52, 0xc6, 0xc5, 0x85, 0x45, 0x6c, 0x2a, 0x8b, 0x84,
+	0xe0, 0xbe, 0x55, 0xff, 0x89, 0x03, 0x7f, 0x82, 0x6d, 0x59, 0x25, 0x26, 0x53, 0xfe, 0x18, 0xeb,
+	0xe8, 0x15, 0x2c, 0x5c, 0x18, 0x13, 0xbd, 0x5f, 0xe4, 0xa8, 0xea, 0x9f, 0x78, 0x1d, 0xdf, 0x71,
+	0x40, 0x9f, 0x26, 0x30, 0x12, 0x6a, 0xc0, 0xe2, 0x48, 0xb3, 0x2c, 0x4d, 0x57, 0xdc, 0x29, 0x29,
+	0x7a, 0xfc, 0x43, 0x06, 0x07, 0x1e, 0x1e, 0x71, 0x8e, 0xb6, 0x13, 0xf3, 0xb4, 0xfd, 0x1c, 0xb2,
+	0x3d, 0x6c, 0x69, 0x96, 0xa7, 0x2d, 0x56, 0x56, 0x86, 0x62, 0x33, 0xfa, 0x73, 0x45, 0xb5, 0x40,
+	0x5b, 0xe3, 0xea, 0xcf, 0xd5, 0xd3, 0x0e, 0xf0, 0xcc, 0x1a, 0x52, 0x53, 0xea, 0xe1, 0xf1, 0x58,
+	0x62, 0x4e, 0x3e, 0x30, 0xff, 0xf8, 0x58, 0x9c, 0x7f, 0x7c, 0x3c, 0x87, 0xac, 0x1b, 0x93, 0x09,
+	0x85, 0x89, 0x3d, 0xc3, 0x30, 0x26, 0x92, 0x5f, 0x39, 0xc8, 0x47, 0x7b, 0x8a, 0xbe, 0x76, 0x22,
+	0x8c, 0xc6, 0xd8, 0xd4, 0x2c, 0x43, 0x97, 0xdc, 0x2d, 0x63, 0x07, 0x14, 0x1f, 0x18, 0x8e, 0x29,
+	0xce, 0x44, 0x81, 0x4d, 0xdb, 0x95, 0x14, 0xd3, 0x0c, 0x50, 0xc8, 0x97, 0x14, 0xd1, 0xfb, 0xae,
+	0x99, 0x75, 0xf8, 0x11, 0xd1, 0xfb, 0xcc, 0xf8, 0xb0, 0x62, 0x22, 0x1d, 0x75, 0xdf, 0x9c, 0xba,
+	0x86, 0x86, 0x8c, 0x87, 0x5e, 0x72, 0x29, 0xb6, 0x27, 0x14, 0x63, 0x79, 0x55, 0x7f, 0xe2, 0x80,
+	0x9f, 0xde, 0x7b, 0xc7, 0x8f, 0x25, 0x1b, 0x29, 0x8a, 0x15, 0xe0, 0xd6, 0xf3, 0x0c, 0xc0, 0x49,
+	0xd7, 0x25, 0xc4, 0x59, 0x46, 0x44, 0xef, 0xbb, 0x66, 0x04, 0xc9, 0x3e, 0xb6, 0xb1, 0x2b, 0x7e,
+	0xfa, 0x1c, 0xca, 0x32, 0x19, 0xce, 0xb2, 0xba, 0x09, 0x59, 0x2a, 0xeb, 0x53, 0x13, 0x6b, 0x43,
+	0x62, 0xce, 0xca, 0x84, 0x9b, 0x95, 0x49, 0xf5, 0x77, 0x0e, 0xd2, 0x41, 0xc2, 0x0d, 0x48, 0xa9,
+	0x04, 0xf7, 0x89, 0x49, 0xb9, 0x21, 0x59, 0x4f, 0xcf, 0x4b, 0x37, 0x26, 0xb8, 0x4c, 0x54, 0xf7,
+	0x26, 0x27, 0x5e, 0xe1, 0xee, 0x9f, 0x9c, 0x6e, 0xcc, 0x9b, 0x9d, 0xd7, 0xc1, 0xec, 0x24, 0xa2,
+	0x41, 0xa6, 0xfb, 0xd7, 0x8d, 0x05, 0xd3, 0xb3, 0x0e, 0x8b, 0x36, 0xab, 0x8b, 0x56, 0x9d, 0x69,
+	0xac, 0x44, 0x52, 0x73, 0x6b, 0x76, 0x3c, 0x5c, 0x5a, 0x2b, 0x05, 0x49, 0x6b, 0x8c, 0xf5, 0xea,
+	0x4b, 0xe0, 0x45, 0x4d, 0xd1, 0xb1, 0x3d, 0x31, 0x89, 0x40, 0x7e, 0x9c, 0x38, 0x1b, 0x8a, 0x20,
+	0x39, 0xc6, 0xb6, 0x4a, 0xab, 0x4c, 0x0b, 0xf4, 0xb9, 0x7a, 0x0e, 0xd9, 0x0e, 0x19, 0xda, 0xf8,
+	0x33, 0x1c, 0xf4, 0x3a, 0x7a, 0x3f, 0x46, 0xea, 0x8d, 0x5e, 0xbb, 0xa1, 0x0b, 0xb2, 0x7a, 0x0e,
+	0x68, 0x87, 0xd8, 0xb2, 0x4a, 0x0b, 0xb3, 0x3e, 0xb7, 0x7e, 0x1d, 0x16, 0x9c, 0x9c, 0xad, 0x07,
+	0x4f, 0x15, 0x46, 0x5b, 0xbd, 0xe5, 0xa0, 0x30, 0x73, 0xb1, 0x3a, 0x23, 0xfb, 0x66, 0xbb, 0xb9,
+	0x2f, 0x75, 0x9b, 0x62, 0x57, 0x6a, 0x76, 0x0e, 0xb6, 0x85, 0xcd, 0x06, 0x1f, 0x2b, 0x2d, 0x5f,
+	0xdf, 0x54, 0x96, 0x7c, 0x76, 0x7f, 0x48, 0xcc, 0xcd, 0x46, 0x94, 0x2b, 0x1c, 0x1f, 0x1c, 0x88,
+	0x67, 0x87, 0x3c, 0x17, 0xe5, 0x0a, 0xc6, 0x70, 0xe8, 0x1c, 0xe7, 0x6b, 0xb0, 0x12, 0xe2, 0x36,
+	0x5b, 0x7b, 0x47, 0xd2, 0x7e, 0x53, 0x38, 0xe1, 0xe3, 0xa5, 0xc7, 0xd7, 0x37, 0x15, 0x3f, 0x11,
+	0x01, 0xf7, 0x34, 0x7d, 0x1f, 0x9b, 0xe3, 0xe8, 0xe2, 0xad, 0xb3, 0xb7, 0xce, 0x3f, 0x9f, 0x88,
+	0x2e, 0xde, 0x9a, 0x5c, 0x39, 0xc7, 0xfb, 0xea, 0x5f, 0x1c, 0x2c, 0x8b, 0xf3, 0xaf, 0x66, 0xf1,
+	0x54, 0x38, 0x3e, 0xda, 0x65, 0xab, 0xb4, 0xcf, 0xc4, 0xd3, 0xe3, 0x43, 0x3e, 0x56, 0x5a, 0xb9,
+	0xbe, 0xa9, 0xf0, 0x81, 0x43, 0x7b, 0x62, 0xd9, 0xc6, 0x08, 0xbd, 0x84, 0xa5, 0x30, 0xfb, 0xb0,
+	0xb3, 0xc5, 0x73, 0xa5, 0xc2, 0xf5, 0x4d, 0x25, 0x17, 0x50, 0x0f, 0x3b, 0x5b, 0xa8, 0x06, 0x7c,
+	0x98, 0x27, 0x76, 0x9b, 0x1b, 0x7c, 0xbc, 0x84, 0xae, 0x6f, 0x2a, 0xf9, 0x80, 0xe8, 0xa0, 0xd3,
+	0xf1, 0xc5, 0x6e, 0xb3, 0xb1, 0xf5, 0x0d, 0x9f, 0x98, 0x8e, 0xcf, 0xf0, 0x39, 0xec, 0xad, 0x8d,
+	0x06, 0x9f, 0x9c, 0xc3, 0xde, 0xda, 0x68, 0xac, 0x12, 0x28, 0xcc, 0xdc, 0xe8, 0xce, 0x3d, 0xd1,
+	0xee, 0x9e, 0x1d, 0xed, 0xef, 0x1d, 0xed, 0x4a, 0x3b, 0x7b, 0xe7, 0xdb, 0x1d, 0x3e, 0xc6, 0x2a,
+	0xf0, 0xa8, 0x3b, 0xda, 0x25, 0xe9, 0xa3, 0xaf, 0x80, 0x0f, 0x68, 0x4d, 0xf1, 0xb4, 0xdd, 0x69,
+	0x7b, 0xfb, 0xe6, 0x13, 0xb1, 0x65, 0xb7, 0x3b, 0xed, 0xc6, 0x6f, 0x1c, 0x64, 0xc4, 0x0f, 0xba,
+	0x2c, 0x12, 0xf3, 0x9d, 0x26, 0x13, 0xf4, 0x3d, 0x64, 0x77, 0x89, 0xed, 0x0f, 0x05, 0xf2, 0x65,
+	0x36, 0x3d, 0x27, 0xa5, 0x7b, 0xc4, 0x8d, 0xbe, 0x85, 0x6c, 0xdb, 0x18, 0x8d, 0x27, 0x36, 0xa1,
+	0x23, 0x83, 0xfc, 0x61, 0x0c, 0x4f, 0x50, 0xe9, 0xde, 0xd3, 0x03, 0x6d, 0x43, 0x26, 0x34, 0x11,
+	0xa8, 0xe4, 0x9f, 0x19, 0x33, 0x63, 0x52, 0xba, 0x77, 0x06, 0xd6, 0xb9, 0xd6, 0x77, 0xb7, 0x9f,
+	0xca, 0xb1, 0x8f, 0x9f, 0xca, 0xb1, 0xdb, 0xbb, 0x32, 0xf7, 0xf1, 0xae, 0xcc, 0xfd, 0x71, 0x57,
+	0xe6, 0x7e, 0xfe, 0xb3, 0x1c, 0x7b, 0xfb, 0xe2, 0x3f, 0x7d, 0x57, 0xf7, 0x52, 0xf4, 0xab, 0x79,
+	0xf3, 0xdf, 0x01, 0x00, 0x29, 0xb0, 0x4d, 0xce, 0x87, 0x0b, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// SyncServiceClient is the client API for SyncService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type SyncServiceClient interface {
+	GetSignature(ctx context.Context, in *SignatureRequest, opts ...grpc.CallOption) (*ChunkChecksums, error)
+	ComputeDelta(ctx context.Context, in *DeltaRequest, opts ...grpc.CallOption) (*PatcherBlockSpan, error)
+	FetchBlocks(ctx context.Context, in *FetchBlocksRequest, opts ...grpc.CallOption) (SyncService_FetchBlocksClient, error)
+}
+
+type syncServiceClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewSyncServiceClient(cc *grpc.ClientConn) SyncServiceClient {
+	return &syncServiceClient{cc}
+}
+
+func (c *syncServiceClient) GetSignature(ctx context.Context, in *SignatureRequest, opts ...grpc.CallOption) (*ChunkChecksums, error) {
+	out := new(ChunkChecksums)
+	err := c.cc.Invoke(ctx, "/syncpb.SyncService/GetSignature", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *syncServiceClient) ComputeDelta(ctx context.Context, in *DeltaRequest, opts ...grpc.CallOption) (*PatcherBlockSpan, error) {
+	out := new(PatcherBlockSpan)
+	err := c.cc.Invoke(ctx, "/syncpb.SyncService/ComputeDelta", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *syncServiceClient) FetchBlocks(ctx context.Context, in *FetchBlocksRequest, opts ...grpc.CallOption) (SyncService_FetchBlocksClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_SyncService_serviceDesc.Streams[0], "/syncpb.SyncService/FetchBlocks", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &syncServiceFetchBlocksClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type SyncService_FetchBlocksClient interface {
+	Recv() (*MissingBlockSpan, error)
+	grpc.ClientStream
+}
+
+type syncServiceFetchBlocksClient struct {
+	grpc.ClientStream
+}
+
+func (x *syncServiceFetchBlocksClient) Recv() (*MissingBlockSpan, error) {
+	m := new(MissingBlockSpan)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// SyncServiceServer is the server API for SyncService service.
+type SyncServiceServer interface {
+	GetSignature(context.Context, *SignatureRequest) (*ChunkChecksums, error)
+	ComputeDelta(context.Context, *DeltaRequest) (*PatcherBlockSpan, error)
+	FetchBlocks(*FetchBlocksRequest, SyncService_FetchBlocksServer) error
+}
+
+func RegisterSyncServiceServer(s *grpc.Server, srv SyncServiceServer) {
+	s.RegisterService(&_SyncService_serviceDesc, srv)
+}
+
+func _SyncService_GetSignature_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SignatureRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SyncServiceServer).GetSignature(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/syncpb.SyncService/GetSignature",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SyncServiceServer).GetSignature(ctx, req.(*SignatureRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SyncService_ComputeDelta_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeltaRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SyncServiceServer).ComputeDelta(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/syncpb.SyncService/ComputeDelta",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SyncServiceServer).ComputeDelta(ctx, req.(*DeltaRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SyncService_FetchBlocks_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(FetchBlocksRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SyncServiceServer).FetchBlocks(m, &syncServiceFetchBlocksServer{stream})
+}
+
+type SyncService_FetchBlocksServer interface {
+	Send(*MissingBlockSpan) error
+	grpc.ServerStream
+}
+
+type syncServiceFetchBlocksServer struct {
+	grpc.ServerStream
+}
+
+func (x *syncServiceFetchBlocksServer) Send(m *MissingBlockSpan) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+var _SyncService_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "syncpb.SyncService",
+	HandlerType: (*SyncServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetSignature",
+			Handler:    _SyncService_GetSignature_Handler,
+		},
+		{
+			MethodName: "ComputeDelta",
+			Handler:    _SyncService_ComputeDelta_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "FetchBlocks",
+			Handler:       _SyncService_FetchBlocks_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "github.com/rkcloudchain/gosync/syncpb/sync.proto",
+}
+
+func (m *ChunkChecksums) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
 	n, err := m.MarshalTo(dAtA)
 	if err != nil {
 		return nil, err
@@ -450,162 +1003,1801 @@ func (m *MissingBlockSpan) Marshal() (dAtA []byte, err error) {
 	return dAtA[:n], nil
 }
 
-func (m *MissingBlockSpan) MarshalTo(dAtA []byte) (int, error) {
+func (m *ChunkChecksums) MarshalTo(dAtA []byte) (int, error) {
 	var i int
 	_ = i
 	var l int
 	_ = l
-	if m.StartOffset != 0 {
+	if m.ConfigBlockSize != 0 {
 		dAtA[i] = 0x8
 		i++
-		i = encodeVarintSync(dAtA, i, uint64(m.StartOffset))
+		i = encodeVarintSync(dAtA, i, uint64(m.ConfigBlockSize))
 	}
-	if m.EndOffset != 0 {
-		dAtA[i] = 0x10
+	if len(m.Checksums) > 0 {
+		for _, msg := range m.Checksums {
+			dAtA[i] = 0x12
+			i++
+			i = encodeVarintSync(dAtA, i, uint64(msg.Size()))
+			n, err := msg.MarshalTo(dAtA[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+	}
+	if m.WeakHashAlgorithm != 0 {
+		dAtA[i] = 0x18
 		i++
-		i = encodeVarintSync(dAtA, i, uint64(m.EndOffset))
+		i = encodeVarintSync(dAtA, i, uint64(m.WeakHashAlgorithm))
 	}
-	if m.XXX_unrecognized != nil {
-		i += copy(dAtA[i:], m.XXX_unrecognized)
+	if m.FormatVersion != 0 {
+		dAtA[i] = 0x20
+		i++
+		i = encodeVarintSync(dAtA, i, uint64(m.FormatVersion))
 	}
-	return i, nil
-}
-
-func encodeVarintSync(dAtA []byte, offset int, v uint64) int {
-	for v >= 1<<7 {
-		dAtA[offset] = uint8(v&0x7f | 0x80)
-		v >>= 7
-		offset++
+	if m.StrongHashAlgorithm != 0 {
+		dAtA[i] = 0x28
+		i++
+		i = encodeVarintSync(dAtA, i, uint64(m.StrongHashAlgorithm))
 	}
-	dAtA[offset] = uint8(v)
-	return offset + 1
-}
-func (m *ChunkChecksums) Size() (n int) {
-	if m == nil {
-		return 0
+	if m.StrongHashLength != 0 {
+		dAtA[i] = 0x30
+		i++
+		i = encodeVarintSync(dAtA, i, uint64(m.StrongHashLength))
 	}
-	var l int
-	_ = l
-	if m.ConfigBlockSize != 0 {
-		n += 1 + sovSync(uint64(m.ConfigBlockSize))
+	if m.SourceLength != 0 {
+		dAtA[i] = 0x38
+		i++
+		i = encodeVarintSync(dAtA, i, uint64(m.SourceLength))
 	}
-	if len(m.Checksums) > 0 {
-		for _, e := range m.Checksums {
-			l = e.Size()
-			n += 1 + l + sovSync(uint64(l))
-		}
+	if len(m.BlockHashesDigest) > 0 {
+		dAtA[i] = 0x42
+		i++
+		i = encodeVarintSync(dAtA, i, uint64(len(m.BlockHashesDigest)))
+		i += copy(dAtA[i:], m.BlockHashesDigest)
+	}
+	if m.ChunkingAlgorithm != 0 {
+		dAtA[i] = 0x48
+		i++
+		i = encodeVarintSync(dAtA, i, uint64(m.ChunkingAlgorithm))
+	}
+	if m.MinChunkSize != 0 {
+		dAtA[i] = 0x50
+		i++
+		i = encodeVarintSync(dAtA, i, uint64(m.MinChunkSize))
+	}
+	if m.MaxChunkSize != 0 {
+		dAtA[i] = 0x58
+		i++
+		i = encodeVarintSync(dAtA, i, uint64(m.MaxChunkSize))
+	}
+	if len(m.StrongHashProbe) > 0 {
+		dAtA[i] = 0x62
+		i++
+		i = encodeVarintSync(dAtA, i, uint64(len(m.StrongHashProbe)))
+		i += copy(dAtA[i:], m.StrongHashProbe)
 	}
 	if m.XXX_unrecognized != nil {
-		n += len(m.XXX_unrecognized)
+		i += copy(dAtA[i:], m.XXX_unrecognized)
 	}
-	return n
+	return i, nil
 }
 
-func (m *ChunkChecksum) Size() (n int) {
-	if m == nil {
-		return 0
+func (m *ChunkChecksum) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
 	}
+	return dAtA[:n], nil
+}
+
+func (m *ChunkChecksum) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
 	var l int
 	_ = l
 	if m.BlockIndex != 0 {
-		n += 1 + sovSync(uint64(m.BlockIndex))
+		dAtA[i] = 0x8
+		i++
+		i = encodeVarintSync(dAtA, i, uint64(m.BlockIndex))
 	}
 	if m.WeakHash != 0 {
-		n += 1 + sovSync(uint64(m.WeakHash))
+		dAtA[i] = 0x10
+		i++
+		i = encodeVarintSync(dAtA, i, uint64(m.WeakHash))
 	}
-	l = len(m.StrongHash)
-	if l > 0 {
-		n += 1 + l + sovSync(uint64(l))
+	if len(m.StrongHash) > 0 {
+		dAtA[i] = 0x1a
+		i++
+		i = encodeVarintSync(dAtA, i, uint64(len(m.StrongHash)))
+		i += copy(dAtA[i:], m.StrongHash)
 	}
 	if m.BlockSize != 0 {
-		n += 1 + sovSync(uint64(m.BlockSize))
+		dAtA[i] = 0x20
+		i++
+		i = encodeVarintSync(dAtA, i, uint64(m.BlockSize))
 	}
-	if m.XXX_unrecognized != nil {
-		n += len(m.XXX_unrecognized)
+	if m.Offset != 0 {
+		dAtA[i] = 0x28
+		i++
+		i = encodeVarintSync(dAtA, i, uint64(m.Offset))
 	}
-	return n
+	if m.XXX_unrecognized != nil {
+		i += copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	return i, nil
 }
 
-func (m *PatcherBlockSpan) Size() (n int) {
-	if m == nil {
-		return 0
+func (m *PatcherBlockSpan) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
 	}
+	return dAtA[:n], nil
+}
+
+func (m *PatcherBlockSpan) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
 	var l int
 	_ = l
 	if len(m.Found) > 0 {
-		for _, e := range m.Found {
-			l = e.Size()
-			n += 1 + l + sovSync(uint64(l))
+		for _, msg := range m.Found {
+			dAtA[i] = 0xa
+			i++
+			i = encodeVarintSync(dAtA, i, uint64(msg.Size()))
+			n, err := msg.MarshalTo(dAtA[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
 		}
 	}
 	if len(m.Missing) > 0 {
-		for _, e := range m.Missing {
-			l = e.Size()
-			n += 1 + l + sovSync(uint64(l))
+		for _, msg := range m.Missing {
+			dAtA[i] = 0x12
+			i++
+			i = encodeVarintSync(dAtA, i, uint64(msg.Size()))
+			n, err := msg.MarshalTo(dAtA[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+	}
+	if m.FormatVersion != 0 {
+		dAtA[i] = 0x18
+		i++
+		i = encodeVarintSync(dAtA, i, uint64(m.FormatVersion))
+	}
+	if m.BasisLength != 0 {
+		dAtA[i] = 0x20
+		i++
+		i = encodeVarintSync(dAtA, i, uint64(m.BasisLength))
+	}
+	if len(m.SourceDigest) > 0 {
+		dAtA[i] = 0x2a
+		i++
+		i = encodeVarintSync(dAtA, i, uint64(len(m.SourceDigest)))
+		i += copy(dAtA[i:], m.SourceDigest)
+	}
+	if m.DigestAlgorithm != 0 {
+		dAtA[i] = 0x30
+		i++
+		i = encodeVarintSync(dAtA, i, uint64(m.DigestAlgorithm))
+	}
+	if m.ConfigBlockSize != 0 {
+		dAtA[i] = 0x38
+		i++
+		i = encodeVarintSync(dAtA, i, uint64(m.ConfigBlockSize))
+	}
+	if len(m.DigestProbe) > 0 {
+		dAtA[i] = 0x42
+		i++
+		i = encodeVarintSync(dAtA, i, uint64(len(m.DigestProbe)))
+		i += copy(dAtA[i:], m.DigestProbe)
+	}
+	if m.XXX_unrecognized != nil {
+		i += copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	return i, nil
+}
+
+func (m *FoundBlockSpan) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *FoundBlockSpan) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if m.ComparisonOffset != 0 {
+		dAtA[i] = 0x8
+		i++
+		i = encodeVarintSync(dAtA, i, uint64(m.ComparisonOffset))
+	}
+	if m.StartIndex != 0 {
+		dAtA[i] = 0x10
+		i++
+		i = encodeVarintSync(dAtA, i, uint64(m.StartIndex))
+	}
+	if m.EndIndex != 0 {
+		dAtA[i] = 0x18
+		i++
+		i = encodeVarintSync(dAtA, i, uint64(m.EndIndex))
+	}
+	if m.BlockSize != 0 {
+		dAtA[i] = 0x20
+		i++
+		i = encodeVarintSync(dAtA, i, uint64(m.BlockSize))
+	}
+	if len(m.Digest) > 0 {
+		dAtA[i] = 0x2a
+		i++
+		i = encodeVarintSync(dAtA, i, uint64(len(m.Digest)))
+		i += copy(dAtA[i:], m.Digest)
+	}
+	if m.LocalOffset != 0 {
+		dAtA[i] = 0x30
+		i++
+		i = encodeVarintSync(dAtA, i, uint64(m.LocalOffset))
+	}
+	if m.XXX_unrecognized != nil {
+		i += copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	return i, nil
+}
+
+func (m *MissingBlockSpan) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *MissingBlockSpan) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if m.StartOffset != 0 {
+		dAtA[i] = 0x8
+		i++
+		i = encodeVarintSync(dAtA, i, uint64(m.StartOffset))
+	}
+	if m.EndOffset != 0 {
+		dAtA[i] = 0x10
+		i++
+		i = encodeVarintSync(dAtA, i, uint64(m.EndOffset))
+	}
+	if len(m.Data) > 0 {
+		dAtA[i] = 0x1a
+		i++
+		i = encodeVarintSync(dAtA, i, uint64(len(m.Data)))
+		i += copy(dAtA[i:], m.Data)
+	}
+	if len(m.Digest) > 0 {
+		dAtA[i] = 0x22
+		i++
+		i = encodeVarintSync(dAtA, i, uint64(len(m.Digest)))
+		i += copy(dAtA[i:], m.Digest)
+	}
+	if m.XXX_unrecognized != nil {
+		i += copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	return i, nil
+}
+
+func (m *PatchTrailer) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *PatchTrailer) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if len(m.SourceDigest) > 0 {
+		dAtA[i] = 0xa
+		i++
+		i = encodeVarintSync(dAtA, i, uint64(len(m.SourceDigest)))
+		i += copy(dAtA[i:], m.SourceDigest)
+	}
+	if m.XXX_unrecognized != nil {
+		i += copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	return i, nil
+}
+
+func (m *BlockSpan) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *BlockSpan) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if m.Span != nil {
+		nn1, err := m.Span.MarshalTo(dAtA[i:])
+		if err != nil {
+			return 0, err
+		}
+		i += nn1
+	}
+	if m.XXX_unrecognized != nil {
+		i += copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	return i, nil
+}
+
+func (m *BlockSpan_Header) MarshalTo(dAtA []byte) (int, error) {
+	i := 0
+	if m.Header != nil {
+		dAtA[i] = 0xa
+		i++
+		i = encodeVarintSync(dAtA, i, uint64(m.Header.Size()))
+		n2, err := m.Header.MarshalTo(dAtA[i:])
+		if err != nil {
+			return 0, err
+		}
+		i += n2
+	}
+	return i, nil
+}
+func (m *BlockSpan_Found) MarshalTo(dAtA []byte) (int, error) {
+	i := 0
+	if m.Found != nil {
+		dAtA[i] = 0x12
+		i++
+		i = encodeVarintSync(dAtA, i, uint64(m.Found.Size()))
+		n3, err := m.Found.MarshalTo(dAtA[i:])
+		if err != nil {
+			return 0, err
+		}
+		i += n3
+	}
+	return i, nil
+}
+func (m *BlockSpan_Missing) MarshalTo(dAtA []byte) (int, error) {
+	i := 0
+	if m.Missing != nil {
+		dAtA[i] = 0x1a
+		i++
+		i = encodeVarintSync(dAtA, i, uint64(m.Missing.Size()))
+		n4, err := m.Missing.MarshalTo(dAtA[i:])
+		if err != nil {
+			return 0, err
+		}
+		i += n4
+	}
+	return i, nil
+}
+func (m *BlockSpan_Trailer) MarshalTo(dAtA []byte) (int, error) {
+	i := 0
+	if m.Trailer != nil {
+		dAtA[i] = 0x22
+		i++
+		i = encodeVarintSync(dAtA, i, uint64(m.Trailer.Size()))
+		n5, err := m.Trailer.MarshalTo(dAtA[i:])
+		if err != nil {
+			return 0, err
+		}
+		i += n5
+	}
+	return i, nil
+}
+func (m *SignatureRequest) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *SignatureRequest) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if len(m.Path) > 0 {
+		dAtA[i] = 0xa
+		i++
+		i = encodeVarintSync(dAtA, i, uint64(len(m.Path)))
+		i += copy(dAtA[i:], m.Path)
+	}
+	if m.XXX_unrecognized != nil {
+		i += copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	return i, nil
+}
+
+func (m *DeltaRequest) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *DeltaRequest) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if len(m.Path) > 0 {
+		dAtA[i] = 0xa
+		i++
+		i = encodeVarintSync(dAtA, i, uint64(len(m.Path)))
+		i += copy(dAtA[i:], m.Path)
+	}
+	if m.Checksums != nil {
+		dAtA[i] = 0x12
+		i++
+		i = encodeVarintSync(dAtA, i, uint64(m.Checksums.Size()))
+		n6, err := m.Checksums.MarshalTo(dAtA[i:])
+		if err != nil {
+			return 0, err
+		}
+		i += n6
+	}
+	if m.XXX_unrecognized != nil {
+		i += copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	return i, nil
+}
+
+func (m *FetchBlocksRequest) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *FetchBlocksRequest) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if len(m.Path) > 0 {
+		dAtA[i] = 0xa
+		i++
+		i = encodeVarintSync(dAtA, i, uint64(len(m.Path)))
+		i += copy(dAtA[i:], m.Path)
+	}
+	if len(m.Spans) > 0 {
+		for _, msg := range m.Spans {
+			dAtA[i] = 0x12
+			i++
+			i = encodeVarintSync(dAtA, i, uint64(msg.Size()))
+			n, err := msg.MarshalTo(dAtA[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+	}
+	if m.XXX_unrecognized != nil {
+		i += copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	return i, nil
+}
+
+func encodeVarintSync(dAtA []byte, offset int, v uint64) int {
+	for v >= 1<<7 {
+		dAtA[offset] = uint8(v&0x7f | 0x80)
+		v >>= 7
+		offset++
+	}
+	dAtA[offset] = uint8(v)
+	return offset + 1
+}
+func (m *ChunkChecksums) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.ConfigBlockSize != 0 {
+		n += 1 + sovSync(uint64(m.ConfigBlockSize))
+	}
+	if len(m.Checksums) > 0 {
+		for _, e := range m.Checksums {
+			l = e.Size()
+			n += 1 + l + sovSync(uint64(l))
+		}
+	}
+	if m.WeakHashAlgorithm != 0 {
+		n += 1 + sovSync(uint64(m.WeakHashAlgorithm))
+	}
+	if m.FormatVersion != 0 {
+		n += 1 + sovSync(uint64(m.FormatVersion))
+	}
+	if m.StrongHashAlgorithm != 0 {
+		n += 1 + sovSync(uint64(m.StrongHashAlgorithm))
+	}
+	if m.StrongHashLength != 0 {
+		n += 1 + sovSync(uint64(m.StrongHashLength))
+	}
+	if m.SourceLength != 0 {
+		n += 1 + sovSync(uint64(m.SourceLength))
+	}
+	l = len(m.BlockHashesDigest)
+	if l > 0 {
+		n += 1 + l + sovSync(uint64(l))
+	}
+	if m.ChunkingAlgorithm != 0 {
+		n += 1 + sovSync(uint64(m.ChunkingAlgorithm))
+	}
+	if m.MinChunkSize != 0 {
+		n += 1 + sovSync(uint64(m.MinChunkSize))
+	}
+	if m.MaxChunkSize != 0 {
+		n += 1 + sovSync(uint64(m.MaxChunkSize))
+	}
+	l = len(m.StrongHashProbe)
+	if l > 0 {
+		n += 1 + l + sovSync(uint64(l))
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func (m *ChunkChecksum) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.BlockIndex != 0 {
+		n += 1 + sovSync(uint64(m.BlockIndex))
+	}
+	if m.WeakHash != 0 {
+		n += 1 + sovSync(uint64(m.WeakHash))
+	}
+	l = len(m.StrongHash)
+	if l > 0 {
+		n += 1 + l + sovSync(uint64(l))
+	}
+	if m.BlockSize != 0 {
+		n += 1 + sovSync(uint64(m.BlockSize))
+	}
+	if m.Offset != 0 {
+		n += 1 + sovSync(uint64(m.Offset))
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func (m *PatcherBlockSpan) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if len(m.Found) > 0 {
+		for _, e := range m.Found {
+			l = e.Size()
+			n += 1 + l + sovSync(uint64(l))
+		}
+	}
+	if len(m.Missing) > 0 {
+		for _, e := range m.Missing {
+			l = e.Size()
+			n += 1 + l + sovSync(uint64(l))
+		}
+	}
+	if m.FormatVersion != 0 {
+		n += 1 + sovSync(uint64(m.FormatVersion))
+	}
+	if m.BasisLength != 0 {
+		n += 1 + sovSync(uint64(m.BasisLength))
+	}
+	l = len(m.SourceDigest)
+	if l > 0 {
+		n += 1 + l + sovSync(uint64(l))
+	}
+	if m.DigestAlgorithm != 0 {
+		n += 1 + sovSync(uint64(m.DigestAlgorithm))
+	}
+	if m.ConfigBlockSize != 0 {
+		n += 1 + sovSync(uint64(m.ConfigBlockSize))
+	}
+	l = len(m.DigestProbe)
+	if l > 0 {
+		n += 1 + l + sovSync(uint64(l))
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func (m *FoundBlockSpan) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.ComparisonOffset != 0 {
+		n += 1 + sovSync(uint64(m.ComparisonOffset))
+	}
+	if m.StartIndex != 0 {
+		n += 1 + sovSync(uint64(m.StartIndex))
+	}
+	if m.EndIndex != 0 {
+		n += 1 + sovSync(uint64(m.EndIndex))
+	}
+	if m.BlockSize != 0 {
+		n += 1 + sovSync(uint64(m.BlockSize))
+	}
+	l = len(m.Digest)
+	if l > 0 {
+		n += 1 + l + sovSync(uint64(l))
+	}
+	if m.LocalOffset != 0 {
+		n += 1 + sovSync(uint64(m.LocalOffset))
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func (m *MissingBlockSpan) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.StartOffset != 0 {
+		n += 1 + sovSync(uint64(m.StartOffset))
+	}
+	if m.EndOffset != 0 {
+		n += 1 + sovSync(uint64(m.EndOffset))
+	}
+	l = len(m.Data)
+	if l > 0 {
+		n += 1 + l + sovSync(uint64(l))
+	}
+	l = len(m.Digest)
+	if l > 0 {
+		n += 1 + l + sovSync(uint64(l))
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func (m *PatchTrailer) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.SourceDigest)
+	if l > 0 {
+		n += 1 + l + sovSync(uint64(l))
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func (m *BlockSpan) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.Span != nil {
+		n += m.Span.Size()
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func (m *BlockSpan_Header) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.Header != nil {
+		l = m.Header.Size()
+		n += 1 + l + sovSync(uint64(l))
+	}
+	return n
+}
+func (m *BlockSpan_Found) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.Found != nil {
+		l = m.Found.Size()
+		n += 1 + l + sovSync(uint64(l))
+	}
+	return n
+}
+func (m *BlockSpan_Missing) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.Missing != nil {
+		l = m.Missing.Size()
+		n += 1 + l + sovSync(uint64(l))
+	}
+	return n
+}
+func (m *BlockSpan_Trailer) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.Trailer != nil {
+		l = m.Trailer.Size()
+		n += 1 + l + sovSync(uint64(l))
+	}
+	return n
+}
+func (m *SignatureRequest) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.Path)
+	if l > 0 {
+		n += 1 + l + sovSync(uint64(l))
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func (m *DeltaRequest) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.Path)
+	if l > 0 {
+		n += 1 + l + sovSync(uint64(l))
+	}
+	if m.Checksums != nil {
+		l = m.Checksums.Size()
+		n += 1 + l + sovSync(uint64(l))
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func (m *FetchBlocksRequest) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.Path)
+	if l > 0 {
+		n += 1 + l + sovSync(uint64(l))
+	}
+	if len(m.Spans) > 0 {
+		for _, e := range m.Spans {
+			l = e.Size()
+			n += 1 + l + sovSync(uint64(l))
+		}
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func sovSync(x uint64) (n int) {
+	for {
+		n++
+		x >>= 7
+		if x == 0 {
+			break
+		}
+	}
+	return n
+}
+func sozSync(x uint64) (n int) {
+	return sovSync(uint64((x << 1) ^ uint64((int64(x) >> 63))))
+}
+func (m *ChunkChecksums) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowSync
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: ChunkChecksums: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: ChunkChecksums: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ConfigBlockSize", wireType)
+			}
+			m.ConfigBlockSize = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSync
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.ConfigBlockSize |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Checksums", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSync
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthSync
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthSync
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Checksums = append(m.Checksums, &ChunkChecksum{})
+			if err := m.Checksums[len(m.Checksums)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field WeakHashAlgorithm", wireType)
+			}
+			m.WeakHashAlgorithm = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSync
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.WeakHashAlgorithm |= WeakHashAlgorithm(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field FormatVersion", wireType)
+			}
+			m.FormatVersion = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSync
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.FormatVersion |= uint32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 5:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field StrongHashAlgorithm", wireType)
+			}
+			m.StrongHashAlgorithm = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSync
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.StrongHashAlgorithm |= StrongHashAlgorithm(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 6:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field StrongHashLength", wireType)
+			}
+			m.StrongHashLength = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSync
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.StrongHashLength |= uint32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 7:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SourceLength", wireType)
+			}
+			m.SourceLength = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSync
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.SourceLength |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 8:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field BlockHashesDigest", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSync
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthSync
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthSync
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.BlockHashesDigest = append(m.BlockHashesDigest[:0], dAtA[iNdEx:postIndex]...)
+			if m.BlockHashesDigest == nil {
+				m.BlockHashesDigest = []byte{}
+			}
+			iNdEx = postIndex
+		case 9:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ChunkingAlgorithm", wireType)
+			}
+			m.ChunkingAlgorithm = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSync
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.ChunkingAlgorithm |= ChunkingAlgorithm(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 10:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field MinChunkSize", wireType)
+			}
+			m.MinChunkSize = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSync
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.MinChunkSize |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 11:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field MaxChunkSize", wireType)
+			}
+			m.MaxChunkSize = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSync
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.MaxChunkSize |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 12:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field StrongHashProbe", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSync
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthSync
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthSync
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.StrongHashProbe = append(m.StrongHashProbe[:0], dAtA[iNdEx:postIndex]...)
+			if m.StrongHashProbe == nil {
+				m.StrongHashProbe = []byte{}
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipSync(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthSync
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthSync
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, dAtA[iNdEx:iNdEx+skippy]...)
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *ChunkChecksum) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowSync
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: ChunkChecksum: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: ChunkChecksum: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field BlockIndex", wireType)
+			}
+			m.BlockIndex = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSync
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.BlockIndex |= uint32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field WeakHash", wireType)
+			}
+			m.WeakHash = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSync
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.WeakHash |= uint32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field StrongHash", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSync
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthSync
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthSync
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.StrongHash = append(m.StrongHash[:0], dAtA[iNdEx:postIndex]...)
+			if m.StrongHash == nil {
+				m.StrongHash = []byte{}
+			}
+			iNdEx = postIndex
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field BlockSize", wireType)
+			}
+			m.BlockSize = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSync
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.BlockSize |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 5:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Offset", wireType)
+			}
+			m.Offset = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSync
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Offset |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipSync(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthSync
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthSync
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, dAtA[iNdEx:iNdEx+skippy]...)
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *PatcherBlockSpan) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowSync
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: PatcherBlockSpan: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: PatcherBlockSpan: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Found", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSync
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthSync
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthSync
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Found = append(m.Found, &FoundBlockSpan{})
+			if err := m.Found[len(m.Found)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Missing", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSync
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthSync
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthSync
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Missing = append(m.Missing, &MissingBlockSpan{})
+			if err := m.Missing[len(m.Missing)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field FormatVersion", wireType)
+			}
+			m.FormatVersion = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSync
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.FormatVersion |= uint32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field BasisLength", wireType)
+			}
+			m.BasisLength = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSync
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.BasisLength |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SourceDigest", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSync
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthSync
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthSync
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.SourceDigest = append(m.SourceDigest[:0], dAtA[iNdEx:postIndex]...)
+			if m.SourceDigest == nil {
+				m.SourceDigest = []byte{}
+			}
+			iNdEx = postIndex
+		case 6:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field DigestAlgorithm", wireType)
+			}
+			m.DigestAlgorithm = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSync
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.DigestAlgorithm |= StrongHashAlgorithm(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 7:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ConfigBlockSize", wireType)
+			}
+			m.ConfigBlockSize = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSync
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.ConfigBlockSize |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 8:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field DigestProbe", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSync
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthSync
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthSync
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.DigestProbe = append(m.DigestProbe[:0], dAtA[iNdEx:postIndex]...)
+			if m.DigestProbe == nil {
+				m.DigestProbe = []byte{}
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipSync(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthSync
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthSync
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, dAtA[iNdEx:iNdEx+skippy]...)
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *FoundBlockSpan) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowSync
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: FoundBlockSpan: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: FoundBlockSpan: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ComparisonOffset", wireType)
+			}
+			m.ComparisonOffset = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSync
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.ComparisonOffset |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field StartIndex", wireType)
+			}
+			m.StartIndex = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSync
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.StartIndex |= uint32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field EndIndex", wireType)
+			}
+			m.EndIndex = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSync
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.EndIndex |= uint32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field BlockSize", wireType)
+			}
+			m.BlockSize = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSync
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.BlockSize |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Digest", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSync
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthSync
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthSync
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Digest = append(m.Digest[:0], dAtA[iNdEx:postIndex]...)
+			if m.Digest == nil {
+				m.Digest = []byte{}
+			}
+			iNdEx = postIndex
+		case 6:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field LocalOffset", wireType)
+			}
+			m.LocalOffset = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSync
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.LocalOffset |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipSync(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthSync
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthSync
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, dAtA[iNdEx:iNdEx+skippy]...)
+			iNdEx += skippy
 		}
 	}
-	if m.XXX_unrecognized != nil {
-		n += len(m.XXX_unrecognized)
-	}
-	return n
-}
-
-func (m *FoundBlockSpan) Size() (n int) {
-	if m == nil {
-		return 0
-	}
-	var l int
-	_ = l
-	if m.ComparisonOffset != 0 {
-		n += 1 + sovSync(uint64(m.ComparisonOffset))
-	}
-	if m.StartIndex != 0 {
-		n += 1 + sovSync(uint64(m.StartIndex))
-	}
-	if m.EndIndex != 0 {
-		n += 1 + sovSync(uint64(m.EndIndex))
-	}
-	if m.BlockSize != 0 {
-		n += 1 + sovSync(uint64(m.BlockSize))
-	}
-	if m.XXX_unrecognized != nil {
-		n += len(m.XXX_unrecognized)
-	}
-	return n
-}
-
-func (m *MissingBlockSpan) Size() (n int) {
-	if m == nil {
-		return 0
-	}
-	var l int
-	_ = l
-	if m.StartOffset != 0 {
-		n += 1 + sovSync(uint64(m.StartOffset))
-	}
-	if m.EndOffset != 0 {
-		n += 1 + sovSync(uint64(m.EndOffset))
-	}
-	if m.XXX_unrecognized != nil {
-		n += len(m.XXX_unrecognized)
-	}
-	return n
-}
 
-func sovSync(x uint64) (n int) {
-	for {
-		n++
-		x >>= 7
-		if x == 0 {
-			break
-		}
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
 	}
-	return n
-}
-func sozSync(x uint64) (n int) {
-	return sovSync(uint64((x << 1) ^ uint64((int64(x) >> 63))))
+	return nil
 }
-func (m *ChunkChecksums) Unmarshal(dAtA []byte) error {
+func (m *MissingBlockSpan) Unmarshal(dAtA []byte) error {
 	l := len(dAtA)
 	iNdEx := 0
 	for iNdEx < l {
@@ -628,17 +2820,17 @@ func (m *ChunkChecksums) Unmarshal(dAtA []byte) error {
 		fieldNum := int32(wire >> 3)
 		wireType := int(wire & 0x7)
 		if wireType == 4 {
-			return fmt.Errorf("proto: ChunkChecksums: wiretype end group for non-group")
+			return fmt.Errorf("proto: MissingBlockSpan: wiretype end group for non-group")
 		}
 		if fieldNum <= 0 {
-			return fmt.Errorf("proto: ChunkChecksums: illegal tag %d (wire type %d)", fieldNum, wire)
+			return fmt.Errorf("proto: MissingBlockSpan: illegal tag %d (wire type %d)", fieldNum, wire)
 		}
 		switch fieldNum {
 		case 1:
 			if wireType != 0 {
-				return fmt.Errorf("proto: wrong wireType = %d for field ConfigBlockSize", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field StartOffset", wireType)
 			}
-			m.ConfigBlockSize = 0
+			m.StartOffset = 0
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowSync
@@ -648,16 +2840,157 @@ func (m *ChunkChecksums) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				m.ConfigBlockSize |= int64(b&0x7F) << shift
+				m.StartOffset |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field EndOffset", wireType)
+			}
+			m.EndOffset = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSync
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.EndOffset |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Data", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSync
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthSync
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthSync
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Data = append(m.Data[:0], dAtA[iNdEx:postIndex]...)
+			if m.Data == nil {
+				m.Data = []byte{}
+			}
+			iNdEx = postIndex
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Digest", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowSync
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
-		case 2:
+			if byteLen < 0 {
+				return ErrInvalidLengthSync
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthSync
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Digest = append(m.Digest[:0], dAtA[iNdEx:postIndex]...)
+			if m.Digest == nil {
+				m.Digest = []byte{}
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipSync(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthSync
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthSync
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, dAtA[iNdEx:iNdEx+skippy]...)
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *PatchTrailer) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowSync
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: PatchTrailer: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: PatchTrailer: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field Checksums", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field SourceDigest", wireType)
 			}
-			var msglen int
+			var byteLen int
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowSync
@@ -667,24 +3000,24 @@ func (m *ChunkChecksums) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				msglen |= int(b&0x7F) << shift
+				byteLen |= int(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
-			if msglen < 0 {
+			if byteLen < 0 {
 				return ErrInvalidLengthSync
 			}
-			postIndex := iNdEx + msglen
+			postIndex := iNdEx + byteLen
 			if postIndex < 0 {
 				return ErrInvalidLengthSync
 			}
 			if postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
-			m.Checksums = append(m.Checksums, &ChunkChecksum{})
-			if err := m.Checksums[len(m.Checksums)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
-				return err
+			m.SourceDigest = append(m.SourceDigest[:0], dAtA[iNdEx:postIndex]...)
+			if m.SourceDigest == nil {
+				m.SourceDigest = []byte{}
 			}
 			iNdEx = postIndex
 		default:
@@ -712,7 +3045,7 @@ func (m *ChunkChecksums) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
-func (m *ChunkChecksum) Unmarshal(dAtA []byte) error {
+func (m *BlockSpan) Unmarshal(dAtA []byte) error {
 	l := len(dAtA)
 	iNdEx := 0
 	for iNdEx < l {
@@ -735,17 +3068,17 @@ func (m *ChunkChecksum) Unmarshal(dAtA []byte) error {
 		fieldNum := int32(wire >> 3)
 		wireType := int(wire & 0x7)
 		if wireType == 4 {
-			return fmt.Errorf("proto: ChunkChecksum: wiretype end group for non-group")
+			return fmt.Errorf("proto: BlockSpan: wiretype end group for non-group")
 		}
 		if fieldNum <= 0 {
-			return fmt.Errorf("proto: ChunkChecksum: illegal tag %d (wire type %d)", fieldNum, wire)
+			return fmt.Errorf("proto: BlockSpan: illegal tag %d (wire type %d)", fieldNum, wire)
 		}
 		switch fieldNum {
 		case 1:
-			if wireType != 0 {
-				return fmt.Errorf("proto: wrong wireType = %d for field BlockIndex", wireType)
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Header", wireType)
 			}
-			m.BlockIndex = 0
+			var msglen int
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowSync
@@ -755,16 +3088,32 @@ func (m *ChunkChecksum) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				m.BlockIndex |= uint32(b&0x7F) << shift
+				msglen |= int(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
+			if msglen < 0 {
+				return ErrInvalidLengthSync
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthSync
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			v := &PatcherBlockSpan{}
+			if err := v.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			m.Span = &BlockSpan_Header{v}
+			iNdEx = postIndex
 		case 2:
-			if wireType != 0 {
-				return fmt.Errorf("proto: wrong wireType = %d for field WeakHash", wireType)
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Found", wireType)
 			}
-			m.WeakHash = 0
+			var msglen int
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowSync
@@ -774,16 +3123,32 @@ func (m *ChunkChecksum) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				m.WeakHash |= uint32(b&0x7F) << shift
+				msglen |= int(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
+			if msglen < 0 {
+				return ErrInvalidLengthSync
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthSync
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			v := &FoundBlockSpan{}
+			if err := v.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			m.Span = &BlockSpan_Found{v}
+			iNdEx = postIndex
 		case 3:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field StrongHash", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field Missing", wireType)
 			}
-			var byteLen int
+			var msglen int
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowSync
@@ -793,31 +3158,32 @@ func (m *ChunkChecksum) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				byteLen |= int(b&0x7F) << shift
+				msglen |= int(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
-			if byteLen < 0 {
+			if msglen < 0 {
 				return ErrInvalidLengthSync
 			}
-			postIndex := iNdEx + byteLen
+			postIndex := iNdEx + msglen
 			if postIndex < 0 {
 				return ErrInvalidLengthSync
 			}
 			if postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
-			m.StrongHash = append(m.StrongHash[:0], dAtA[iNdEx:postIndex]...)
-			if m.StrongHash == nil {
-				m.StrongHash = []byte{}
+			v := &MissingBlockSpan{}
+			if err := v.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
 			}
+			m.Span = &BlockSpan_Missing{v}
 			iNdEx = postIndex
 		case 4:
-			if wireType != 0 {
-				return fmt.Errorf("proto: wrong wireType = %d for field BlockSize", wireType)
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Trailer", wireType)
 			}
-			m.BlockSize = 0
+			var msglen int
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowSync
@@ -827,11 +3193,27 @@ func (m *ChunkChecksum) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				m.BlockSize |= int64(b&0x7F) << shift
+				msglen |= int(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
+			if msglen < 0 {
+				return ErrInvalidLengthSync
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthSync
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			v := &PatchTrailer{}
+			if err := v.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			m.Span = &BlockSpan_Trailer{v}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipSync(dAtA[iNdEx:])
@@ -857,7 +3239,7 @@ func (m *ChunkChecksum) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
-func (m *PatcherBlockSpan) Unmarshal(dAtA []byte) error {
+func (m *SignatureRequest) Unmarshal(dAtA []byte) error {
 	l := len(dAtA)
 	iNdEx := 0
 	for iNdEx < l {
@@ -880,51 +3262,17 @@ func (m *PatcherBlockSpan) Unmarshal(dAtA []byte) error {
 		fieldNum := int32(wire >> 3)
 		wireType := int(wire & 0x7)
 		if wireType == 4 {
-			return fmt.Errorf("proto: PatcherBlockSpan: wiretype end group for non-group")
+			return fmt.Errorf("proto: SignatureRequest: wiretype end group for non-group")
 		}
 		if fieldNum <= 0 {
-			return fmt.Errorf("proto: PatcherBlockSpan: illegal tag %d (wire type %d)", fieldNum, wire)
+			return fmt.Errorf("proto: SignatureRequest: illegal tag %d (wire type %d)", fieldNum, wire)
 		}
 		switch fieldNum {
 		case 1:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field Found", wireType)
-			}
-			var msglen int
-			for shift := uint(0); ; shift += 7 {
-				if shift >= 64 {
-					return ErrIntOverflowSync
-				}
-				if iNdEx >= l {
-					return io.ErrUnexpectedEOF
-				}
-				b := dAtA[iNdEx]
-				iNdEx++
-				msglen |= int(b&0x7F) << shift
-				if b < 0x80 {
-					break
-				}
-			}
-			if msglen < 0 {
-				return ErrInvalidLengthSync
-			}
-			postIndex := iNdEx + msglen
-			if postIndex < 0 {
-				return ErrInvalidLengthSync
-			}
-			if postIndex > l {
-				return io.ErrUnexpectedEOF
-			}
-			m.Found = append(m.Found, &FoundBlockSpan{})
-			if err := m.Found[len(m.Found)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
-				return err
-			}
-			iNdEx = postIndex
-		case 2:
-			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field Missing", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field Path", wireType)
 			}
-			var msglen int
+			var stringLen uint64
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowSync
@@ -934,25 +3282,23 @@ func (m *PatcherBlockSpan) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				msglen |= int(b&0x7F) << shift
+				stringLen |= uint64(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
-			if msglen < 0 {
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
 				return ErrInvalidLengthSync
 			}
-			postIndex := iNdEx + msglen
+			postIndex := iNdEx + intStringLen
 			if postIndex < 0 {
 				return ErrInvalidLengthSync
 			}
 			if postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
-			m.Missing = append(m.Missing, &MissingBlockSpan{})
-			if err := m.Missing[len(m.Missing)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
-				return err
-			}
+			m.Path = string(dAtA[iNdEx:postIndex])
 			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
@@ -979,7 +3325,7 @@ func (m *PatcherBlockSpan) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
-func (m *FoundBlockSpan) Unmarshal(dAtA []byte) error {
+func (m *DeltaRequest) Unmarshal(dAtA []byte) error {
 	l := len(dAtA)
 	iNdEx := 0
 	for iNdEx < l {
@@ -1002,17 +3348,17 @@ func (m *FoundBlockSpan) Unmarshal(dAtA []byte) error {
 		fieldNum := int32(wire >> 3)
 		wireType := int(wire & 0x7)
 		if wireType == 4 {
-			return fmt.Errorf("proto: FoundBlockSpan: wiretype end group for non-group")
+			return fmt.Errorf("proto: DeltaRequest: wiretype end group for non-group")
 		}
 		if fieldNum <= 0 {
-			return fmt.Errorf("proto: FoundBlockSpan: illegal tag %d (wire type %d)", fieldNum, wire)
+			return fmt.Errorf("proto: DeltaRequest: illegal tag %d (wire type %d)", fieldNum, wire)
 		}
 		switch fieldNum {
 		case 1:
-			if wireType != 0 {
-				return fmt.Errorf("proto: wrong wireType = %d for field ComparisonOffset", wireType)
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Path", wireType)
 			}
-			m.ComparisonOffset = 0
+			var stringLen uint64
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowSync
@@ -1022,16 +3368,29 @@ func (m *FoundBlockSpan) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				m.ComparisonOffset |= int64(b&0x7F) << shift
+				stringLen |= uint64(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthSync
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthSync
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Path = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
 		case 2:
-			if wireType != 0 {
-				return fmt.Errorf("proto: wrong wireType = %d for field StartIndex", wireType)
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Checksums", wireType)
 			}
-			m.StartIndex = 0
+			var msglen int
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowSync
@@ -1041,49 +3400,28 @@ func (m *FoundBlockSpan) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				m.StartIndex |= uint32(b&0x7F) << shift
+				msglen |= int(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
-		case 3:
-			if wireType != 0 {
-				return fmt.Errorf("proto: wrong wireType = %d for field EndIndex", wireType)
+			if msglen < 0 {
+				return ErrInvalidLengthSync
 			}
-			m.EndIndex = 0
-			for shift := uint(0); ; shift += 7 {
-				if shift >= 64 {
-					return ErrIntOverflowSync
-				}
-				if iNdEx >= l {
-					return io.ErrUnexpectedEOF
-				}
-				b := dAtA[iNdEx]
-				iNdEx++
-				m.EndIndex |= uint32(b&0x7F) << shift
-				if b < 0x80 {
-					break
-				}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthSync
 			}
-		case 4:
-			if wireType != 0 {
-				return fmt.Errorf("proto: wrong wireType = %d for field BlockSize", wireType)
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
 			}
-			m.BlockSize = 0
-			for shift := uint(0); ; shift += 7 {
-				if shift >= 64 {
-					return ErrIntOverflowSync
-				}
-				if iNdEx >= l {
-					return io.ErrUnexpectedEOF
-				}
-				b := dAtA[iNdEx]
-				iNdEx++
-				m.BlockSize |= int64(b&0x7F) << shift
-				if b < 0x80 {
-					break
-				}
+			if m.Checksums == nil {
+				m.Checksums = &ChunkChecksums{}
 			}
+			if err := m.Checksums.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipSync(dAtA[iNdEx:])
@@ -1109,7 +3447,7 @@ func (m *FoundBlockSpan) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
-func (m *MissingBlockSpan) Unmarshal(dAtA []byte) error {
+func (m *FetchBlocksRequest) Unmarshal(dAtA []byte) error {
 	l := len(dAtA)
 	iNdEx := 0
 	for iNdEx < l {
@@ -1132,17 +3470,17 @@ func (m *MissingBlockSpan) Unmarshal(dAtA []byte) error {
 		fieldNum := int32(wire >> 3)
 		wireType := int(wire & 0x7)
 		if wireType == 4 {
-			return fmt.Errorf("proto: MissingBlockSpan: wiretype end group for non-group")
+			return fmt.Errorf("proto: FetchBlocksRequest: wiretype end group for non-group")
 		}
 		if fieldNum <= 0 {
-			return fmt.Errorf("proto: MissingBlockSpan: illegal tag %d (wire type %d)", fieldNum, wire)
+			return fmt.Errorf("proto: FetchBlocksRequest: illegal tag %d (wire type %d)", fieldNum, wire)
 		}
 		switch fieldNum {
 		case 1:
-			if wireType != 0 {
-				return fmt.Errorf("proto: wrong wireType = %d for field StartOffset", wireType)
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Path", wireType)
 			}
-			m.StartOffset = 0
+			var stringLen uint64
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowSync
@@ -1152,16 +3490,29 @@ func (m *MissingBlockSpan) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				m.StartOffset |= int64(b&0x7F) << shift
+				stringLen |= uint64(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthSync
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthSync
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Path = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
 		case 2:
-			if wireType != 0 {
-				return fmt.Errorf("proto: wrong wireType = %d for field EndOffset", wireType)
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Spans", wireType)
 			}
-			m.EndOffset = 0
+			var msglen int
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowSync
@@ -1171,11 +3522,26 @@ func (m *MissingBlockSpan) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				m.EndOffset |= int64(b&0x7F) << shift
+				msglen |= int(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
+			if msglen < 0 {
+				return ErrInvalidLengthSync
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthSync
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Spans = append(m.Spans, &MissingBlockSpan{})
+			if err := m.Spans[len(m.Spans)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipSync(dAtA[iNdEx:])
@@ -1,8 +1,108 @@
 package gosync
 
-import "hash/adler32"
+import (
+	"context"
+	"hash/adler32"
+	"io"
+
+	"github.com/rkcloudchain/gosync/syncpb"
+)
+
+const (
+	adlerMod = 65521
+
+	// contextCheckInterval is the number of bytes scanned between two cancellation checks.
+	contextCheckInterval = 64 * 1024
+)
 
 // ComputeWeakHash computes a weak hash
 func ComputeWeakHash(v []byte) uint32 {
 	return adler32.Checksum(v)
 }
+
+// RollingHash is an Adler-32 checksum over a sliding window of bytes.
+// The window can be moved forward one byte at a time in constant time,
+// and Sum32 always equals ComputeWeakHash of the current window.
+type RollingHash struct {
+	a, b uint32
+	n    uint32
+}
+
+// NewRollingHash returns a rolling hash over an empty window.
+func NewRollingHash() *RollingHash {
+	h := &RollingHash{}
+	h.Reset()
+	return h
+}
+
+// Reset empties the window.
+func (h *RollingHash) Reset() {
+	h.a, h.b, h.n = 1, 0, 0
+}
+
+// Write appends p to the window.
+func (h *RollingHash) Write(p []byte) {
+	for _, c := range p {
+		h.a = (h.a + uint32(c)) % adlerMod
+		h.b = (h.b + h.a) % adlerMod
+	}
+	h.n += uint32(len(p))
+}
+
+// Roll removes the oldest byte out from the window and appends in,
+// keeping the window length unchanged.
+func (h *RollingHash) Roll(out, in byte) {
+	n := h.n % adlerMod
+	h.a = (h.a + adlerMod - uint32(out) + uint32(in)) % adlerMod
+	h.b = (h.b + adlerMod - (n*uint32(out))%adlerMod + h.a + adlerMod - 1) % adlerMod
+}
+
+// RollOut removes the oldest byte out from the window, shrinking it by one byte.
+func (h *RollingHash) RollOut(out byte) {
+	n := h.n % adlerMod
+	h.a = (h.a + adlerMod - uint32(out)) % adlerMod
+	h.b = (h.b + 2*adlerMod - (n*uint32(out))%adlerMod - 1) % adlerMod
+	h.n--
+}
+
+// Sum32 returns the checksum of the current window.
+func (h *RollingHash) Sum32() uint32 {
+	return h.b<<16 | h.a
+}
+
+// doRequest requests a range, with ctx when the requester supports it.
+func doRequest(ctx context.Context, requester BlockRequester, startOffset, endOffset int64) ([]byte, error) {
+	if r, ok := requester.(ContextBlockRequester); ok {
+		return r.DoRequestContext(ctx, startOffset, endOffset)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return requester.DoRequest(startOffset, endOffset)
+}
+
+// doRequests requests a batch of ranges, with ctx when the requester supports it.
+func doRequests(ctx context.Context, requester BatchBlockRequester, ranges []*syncpb.MissingBlockSpan) ([][]byte, error) {
+	if r, ok := requester.(ContextBatchBlockRequester); ok {
+		return r.DoRequestsContext(ctx, ranges)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return requester.DoRequests(ranges)
+}
+
+// contextWriter fails writes once its context is done.
+type contextWriter struct {
+	ctx    context.Context
+	writer io.Writer
+}
+
+func (w *contextWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return w.writer.Write(p)
+}
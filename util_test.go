@@ -0,0 +1,49 @@
+package gosync
+
+import (
+	"hash/adler32"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRollingHash(t *testing.T) {
+	data := make([]byte, 4096)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	for _, window := range []int{1, 2, 7, 64, 1024} {
+		h := NewRollingHash()
+		h.Write(data[:window])
+		assert.Equal(t, adler32.Checksum(data[:window]), h.Sum32())
+
+		for i := 1; i+window <= len(data); i++ {
+			h.Roll(data[i-1], data[i+window-1])
+			assert.Equal(t, adler32.Checksum(data[i:i+window]), h.Sum32())
+		}
+	}
+}
+
+func TestRollingHashRollOut(t *testing.T) {
+	data := make([]byte, 512)
+	for i := range data {
+		data[i] = 0xff
+	}
+
+	h := NewRollingHash()
+	h.Write(data)
+	for i := 1; i <= len(data); i++ {
+		h.RollOut(data[i-1])
+		assert.Equal(t, adler32.Checksum(data[i:]), h.Sum32())
+	}
+}
+
+func TestRollingHashReset(t *testing.T) {
+	h := NewRollingHash()
+	h.Write([]byte("hello world"))
+	h.Reset()
+	assert.Equal(t, ComputeWeakHash(nil), h.Sum32())
+
+	h.Write([]byte("hello"))
+	assert.Equal(t, ComputeWeakHash([]byte("hello")), h.Sum32())
+}
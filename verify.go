@@ -0,0 +1,96 @@
+package gosync
+
+import (
+	"bytes"
+	"hash"
+	"io"
+
+	"github.com/rkcloudchain/gosync/syncpb"
+)
+
+// outputVerifier writes the patched output while hashing it as a whole and by found span.
+type outputVerifier struct {
+	output    io.Writer
+	algorithm syncpb.StrongHashAlgorithm
+	file      hash.Hash
+	span      hash.Hash
+	offset    int64
+	start     int64
+}
+
+func (r *rsync) newOutputVerifier(output io.Writer) *outputVerifier {
+	return &outputVerifier{output: output, algorithm: r.strongAlgorithm, file: r.strongHasher(), span: r.strongHasher()}
+}
+
+func (v *outputVerifier) Write(p []byte) (int, error) {
+	n, err := v.output.Write(p)
+	v.file.Write(p[:n])
+	v.span.Write(p[:n])
+	v.offset += int64(n)
+	return n, err
+}
+
+// StartSpan marks the beginning of the data of a span.
+func (v *outputVerifier) StartSpan() {
+	v.span.Reset()
+	v.start = v.offset
+}
+
+// EndSpan checks the data written since StartSpan against the span digest, if any.
+func (v *outputVerifier) EndSpan(algorithm syncpb.StrongHashAlgorithm, digest []byte) error {
+	if len(digest) == 0 {
+		return nil
+	}
+	return v.check(algorithm, v.start, v.span, digest)
+}
+
+// Close checks the whole output against the source digest, if any.
+func (v *outputVerifier) Close(algorithm syncpb.StrongHashAlgorithm, digest []byte) error {
+	if len(digest) == 0 {
+		return nil
+	}
+	return v.check(algorithm, 0, v.file, digest)
+}
+
+func (v *outputVerifier) check(algorithm syncpb.StrongHashAlgorithm, start int64, h hash.Hash, digest []byte) error {
+	if algorithm != v.algorithm {
+		return &ErrSignatureMismatch{Field: "digest_algorithm", Remote: algorithm, Local: v.algorithm}
+	}
+
+	if actual := h.Sum(nil); !bytes.Equal(actual, digest) {
+		return &ErrChecksumMismatch{Offset: start, Length: v.offset - start, Expected: digest, Actual: actual}
+	}
+
+	return nil
+}
+
+// sourceTap holds the source data read ahead of a scan, until the spans it belongs to are known.
+type sourceTap struct {
+	offset  int64
+	pending []byte
+}
+
+func (t *sourceTap) Write(p []byte) (int, error) {
+	t.pending = append(t.pending, p...)
+	return len(p), nil
+}
+
+// Take writes the data from start to end, exclusive, to w when it is not nil,
+// and drops the data before end.
+func (t *sourceTap) Take(start, end int64, w io.Writer) {
+	if available := t.offset + int64(len(t.pending)); end > available {
+		end = available
+	}
+	if start < t.offset {
+		start = t.offset
+	}
+
+	if w != nil && start < end {
+		w.Write(t.pending[start-t.offset : end-t.offset])
+	}
+
+	if end > t.offset {
+		t.pending = t.pending[end-t.offset:]
+		t.offset = end
+	}
+}
@@ -0,0 +1,230 @@
+package gosync
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+
+	"github.com/rkcloudchain/gosync/syncpb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPatchVerifiesSourceDigest(t *testing.T) {
+	local := []byte("The qwik brown fox jumped 0v3r the lazy")
+	reference := []byte("The quick brown fox jumped over the lazy dog")
+
+	r := newTestGoSync(t, &Config{BlockSize: 4, MaxRequestBlockSize: 8}, reference)
+	checksums, err := r.Sign(bytes.NewReader(local))
+	require.NoError(t, err)
+
+	patcher, err := r.Delta(bytes.NewReader(reference), checksums)
+	require.NoError(t, err)
+	digest := md5.Sum(reference)
+	assert.Equal(t, digest[:], patcher.SourceDigest)
+	assert.Equal(t, syncpb.StrongHashMD5, patcher.DigestAlgorithm)
+
+	output := bytes.NewBuffer(nil)
+	require.NoError(t, r.Patch(bytes.NewReader(local), patcher, output))
+	assert.Equal(t, reference, output.Bytes())
+
+	corrupted := append([]byte(nil), local...)
+	corrupted[0] ^= 0xff
+	err = r.Patch(bytes.NewReader(corrupted), patcher, bytes.NewBuffer(nil))
+	require.IsType(t, &ErrChecksumMismatch{}, err)
+	mismatch := err.(*ErrChecksumMismatch)
+	assert.Equal(t, int64(0), mismatch.Offset)
+	assert.Equal(t, int64(len(reference)), mismatch.Length)
+	assert.Equal(t, digest[:], mismatch.Expected)
+}
+
+func TestPatchVerifiesSpanDigests(t *testing.T) {
+	local := []byte("The qwik brown fox jumped 0v3r the lazy")
+	reference := []byte("The quick brown fox jumped over the lazy dog")
+
+	r := newTestGoSync(t, &Config{BlockSize: 4, MaxRequestBlockSize: 8, SpanDigests: true}, reference)
+	checksums, err := r.Sign(bytes.NewReader(local))
+	require.NoError(t, err)
+
+	patcher, err := r.Delta(bytes.NewReader(reference), checksums)
+	require.NoError(t, err)
+	for _, block := range patcher.Found {
+		digest := md5.Sum(reference[block.ComparisonOffset : block.ComparisonOffset+block.BlockSize])
+		assert.Equal(t, digest[:], block.Digest)
+	}
+	for _, block := range patcher.Missing {
+		digest := md5.Sum(reference[block.StartOffset : block.EndOffset+1])
+		assert.Equal(t, digest[:], block.Digest)
+	}
+
+	missing := patcher.Missing[len(patcher.Missing)-1]
+	r = newTestGoSync(t, &Config{
+		BlockSize:           4,
+		MaxRequestBlockSize: 8,
+		SpanDigests:         true,
+		Requester:           singleRequests(&fakeRequester{BytesRequester: reference, offsets: []int64{missing.StartOffset}, corrupt: -1}),
+	}, reference)
+	err = r.Patch(bytes.NewReader(local), patcher, bytes.NewBuffer(nil))
+	require.IsType(t, &ErrChecksumMismatch{}, err)
+	assert.Equal(t, missing.StartOffset, err.(*ErrChecksumMismatch).Offset)
+	assert.Equal(t, missing.EndOffset-missing.StartOffset+1, err.(*ErrChecksumMismatch).Length)
+
+	corrupted := append([]byte(nil), local...)
+	found := patcher.Found[0]
+	corrupted[found.StartIndex*4] ^= 0xff
+	err = r.Patch(bytes.NewReader(corrupted), patcher, bytes.NewBuffer(nil))
+	require.IsType(t, &ErrChecksumMismatch{}, err)
+	assert.Equal(t, found.ComparisonOffset, err.(*ErrChecksumMismatch).Offset)
+	assert.Equal(t, found.BlockSize, err.(*ErrChecksumMismatch).Length)
+}
+
+// countingReaderAt counts the bytes read from a ReaderAt.
+type countingReaderAt struct {
+	io.ReaderAt
+	read int64
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.ReaderAt.ReadAt(p, off)
+	atomic.AddInt64(&c.read, int64(n))
+	return n, err
+}
+
+func TestDeltaReadsSourceOnce(t *testing.T) {
+	rnd := rand.New(rand.NewSource(10))
+	local := make([]byte, 64*1024)
+	rnd.Read(local)
+	reference := editedCopy(rnd, local, 20)
+
+	plans := make([]*syncpb.PatcherBlockSpan, 0)
+	for _, concurrency := range []int{1, 4} {
+		r, err := New(&Config{
+			BlockSize:     256,
+			SpanDigests:   true,
+			EmbedLiterals: true,
+			Concurrency:   concurrency,
+			SizeFunc:      BytesRequester(reference).Size,
+		})
+		require.NoError(t, err)
+
+		checksums, err := r.Sign(bytes.NewReader(local))
+		require.NoError(t, err)
+
+		source := &countingReaderAt{ReaderAt: bytes.NewReader(reference)}
+		patcher, err := r.Delta(source, checksums)
+		require.NoError(t, err)
+		// Concurrent segments read ahead a block past their end, and nothing else twice.
+		assert.True(t, source.read <= int64(len(reference)+(concurrency-1)*256), "read %d bytes", source.read)
+
+		for _, block := range patcher.Found {
+			digest := md5.Sum(reference[block.ComparisonOffset : block.ComparisonOffset+block.BlockSize])
+			assert.Equal(t, digest[:], block.Digest)
+		}
+		for _, block := range patcher.Missing {
+			assert.Equal(t, reference[block.StartOffset:block.EndOffset+1], block.Data)
+		}
+
+		output := bytes.NewBuffer(nil)
+		require.NoError(t, r.Patch(bytes.NewReader(local), patcher, output))
+		assert.Equal(t, reference, output.Bytes())
+		plans = append(plans, patcher)
+	}
+
+	assert.Equal(t, plans[0], plans[1])
+}
+
+func TestPatchDigestAlgorithmMismatch(t *testing.T) {
+	local := []byte("The qwik brown fox jumped 0v3r the lazy")
+	reference := []byte("The quick brown fox jumped over the lazy dog")
+
+	r := newTestGoSync(t, &Config{BlockSize: 4, MaxRequestBlockSize: 8}, reference)
+	checksums, err := r.Sign(bytes.NewReader(local))
+	require.NoError(t, err)
+
+	patcher, err := r.Delta(bytes.NewReader(reference), checksums)
+	require.NoError(t, err)
+
+	patcher.DigestAlgorithm = syncpb.StrongHashSHA256
+	err = r.Patch(bytes.NewReader(local), patcher, bytes.NewBuffer(nil))
+	require.IsType(t, &ErrSignatureMismatch{}, err)
+	assert.Equal(t, "digest_algorithm", err.(*ErrSignatureMismatch).Field)
+}
+
+func TestPatchStreamVerifiesTrailer(t *testing.T) {
+	local := []byte("The qwik brown fox jumped 0v3r the lazy")
+	reference := []byte("The quick brown fox jumped over the lazy dog")
+
+	r := newTestGoSync(t, &Config{BlockSize: 4, StrongHasher: sha256.New}, reference)
+	checksums, err := r.Sign(bytes.NewReader(local))
+	require.NoError(t, err)
+
+	buffer := bytes.NewBuffer(nil)
+	require.NoError(t, r.DeltaStream(bytes.NewReader(reference), checksums, NewDelimitedDeltaWriter(buffer)))
+	stream := buffer.Bytes()
+
+	output := bytes.NewBuffer(nil)
+	require.NoError(t, r.PatchStream(bytes.NewReader(local), NewDelimitedSpanReader(bytes.NewReader(stream)), output))
+	assert.Equal(t, reference, output.Bytes())
+
+	corrupted := append([]byte(nil), local...)
+	corrupted[0] ^= 0xff
+	err = r.PatchStream(bytes.NewReader(corrupted), NewDelimitedSpanReader(bytes.NewReader(stream)), bytes.NewBuffer(nil))
+	require.IsType(t, &ErrChecksumMismatch{}, err)
+	assert.Equal(t, int64(len(reference)), err.(*ErrChecksumMismatch).Length)
+
+	ch := make(chan *syncpb.BlockSpan, 2)
+	ch <- &syncpb.BlockSpan{Span: &syncpb.BlockSpan_Trailer{Trailer: &syncpb.PatchTrailer{}}}
+	ch <- &syncpb.BlockSpan{Span: &syncpb.BlockSpan_Found{Found: &syncpb.FoundBlockSpan{}}}
+	close(ch)
+	err = r.PatchStream(bytes.NewReader(local), NewChanSpanReader(ch), bytes.NewBuffer(nil))
+	assert.EqualError(t, err, "Unexpected span after the trailer")
+}
+
+func TestPatchRetriesBadResponses(t *testing.T) {
+	local := []byte("The qwik brown fox jumped 0v3r the lazy")
+	reference := []byte("The quick brown fox jumped over the lazy dog")
+
+	r := newTestGoSync(t, &Config{BlockSize: 4, MaxRequestBlockSize: 8}, reference)
+	checksums, err := r.Sign(bytes.NewReader(local))
+	require.NoError(t, err)
+
+	patcher, err := r.Delta(bytes.NewReader(reference), checksums)
+	require.NoError(t, err)
+	first := patcher.Missing[0]
+
+	requester := &fakeRequester{BytesRequester: reference, short: 1}
+	r = newTestGoSync(t, &Config{BlockSize: 4, MaxRequestBlockSize: 8, Requester: singleRequests(requester)}, reference)
+	err = r.Patch(bytes.NewReader(local), patcher, bytes.NewBuffer(nil))
+	assert.EqualError(t, err, fmt.Sprintf("Invalid response for range %d-%d: got %d bytes, expected %d",
+		first.StartOffset, first.EndOffset, first.EndOffset-first.StartOffset, first.EndOffset-first.StartOffset+1))
+
+	requester = &fakeRequester{BytesRequester: reference, corrupt: 1}
+	r = newTestGoSync(t, &Config{BlockSize: 4, MaxRequestBlockSize: 8, Requester: singleRequests(requester)}, reference)
+	err = r.Patch(bytes.NewReader(local), patcher, bytes.NewBuffer(nil))
+	require.IsType(t, &ErrChecksumMismatch{}, err)
+	assert.Equal(t, first.StartOffset, err.(*ErrChecksumMismatch).Offset)
+
+	r, err = New(&Config{BlockSize: 4, MaxRequestRetries: 2, Requester: singleRequests(&fakeRequester{BytesRequester: reference, short: 1, corrupt: 1})})
+	require.NoError(t, err)
+	output := bytes.NewBuffer(nil)
+	require.NoError(t, r.Patch(bytes.NewReader(local), patcher, output))
+	assert.Equal(t, reference, output.Bytes())
+
+	requester = &fakeRequester{BytesRequester: reference, corrupt: 3}
+	r, err = New(&Config{BlockSize: 4, MaxRequestRetries: 2, Requester: singleRequests(requester)})
+	require.NoError(t, err)
+	err = r.Patch(bytes.NewReader(local), patcher, bytes.NewBuffer(nil))
+	require.IsType(t, &ErrChecksumMismatch{}, err)
+	assert.Len(t, requester.ranges, 3)
+}
+
+func TestInvalidRequestRetries(t *testing.T) {
+	_, err := New(&Config{MaxRequestRetries: -1})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Invalid request retries")
+}
@@ -0,0 +1,196 @@
+package gosync
+
+import (
+	"fmt"
+	"math/bits"
+
+	"github.com/rkcloudchain/gosync/syncpb"
+)
+
+// RollingHasher is a weak checksum over a sliding window of bytes.
+type RollingHasher interface {
+	// Reset empties the window.
+	Reset()
+
+	// Write appends p to the window.
+	Write(p []byte)
+
+	// Roll removes the oldest byte out from the window and appends in.
+	Roll(out, in byte)
+
+	// RollOut removes the oldest byte out from the window.
+	RollOut(out byte)
+
+	// Sum32 returns the checksum of the current window.
+	Sum32() uint32
+}
+
+// WeakHasher creates rolling checksums of a single algorithm.
+type WeakHasher interface {
+	// Algorithm returns the identifier recorded in signatures.
+	Algorithm() syncpb.WeakHashAlgorithm
+
+	// New returns a rolling checksum over an empty window.
+	New() RollingHasher
+}
+
+// Built-in weak hash algorithms.
+var (
+	// Adler32 is the Adler-32 checksum, as computed by ComputeWeakHash.
+	Adler32 WeakHasher = &weakHasher{syncpb.WeakHashAdler32, func() RollingHasher { return NewRollingHash() }}
+
+	// Rollsum is the checksum used by rsync and librsync.
+	Rollsum WeakHasher = &weakHasher{syncpb.WeakHashRollsum, func() RollingHasher { return &rollsum{} }}
+
+	// RabinKarp is a polynomial hash modulo 2^32.
+	RabinKarp WeakHasher = &weakHasher{syncpb.WeakHashRabinKarp, func() RollingHasher { return &rabinKarp{pow: 1} }}
+
+	// Buzhash is a cyclic polynomial hash driven by a substitution table.
+	Buzhash WeakHasher = &weakHasher{syncpb.WeakHashBuzhash, func() RollingHasher { return &buzhash{} }}
+)
+
+var weakHashers = map[syncpb.WeakHashAlgorithm]WeakHasher{
+	syncpb.WeakHashAdler32:   Adler32,
+	syncpb.WeakHashRollsum:   Rollsum,
+	syncpb.WeakHashRabinKarp: RabinKarp,
+	syncpb.WeakHashBuzhash:   Buzhash,
+}
+
+// weakHasherFor returns the weak hasher of the algorithm: the configured one when it is
+// of this algorithm, otherwise the built-in one.
+func (r *rsync) weakHasherFor(alg syncpb.WeakHashAlgorithm) (WeakHasher, error) {
+	if r.weakHasher != nil && r.weakHasher.Algorithm() == alg {
+		return r.weakHasher, nil
+	}
+	if h, ok := weakHashers[alg]; ok {
+		return h, nil
+	}
+	return nil, fmt.Errorf("Unsupported weak hash algorithm %d", alg)
+}
+
+type weakHasher struct {
+	alg syncpb.WeakHashAlgorithm
+	new func() RollingHasher
+}
+
+func (w *weakHasher) Algorithm() syncpb.WeakHashAlgorithm {
+	return w.alg
+}
+
+func (w *weakHasher) New() RollingHasher {
+	return w.new()
+}
+
+const rollsumCharOffset = 31
+
+type rollsum struct {
+	s1, s2 uint32
+	n      uint32
+}
+
+func (r *rollsum) Reset() {
+	r.s1, r.s2, r.n = 0, 0, 0
+}
+
+func (r *rollsum) Write(p []byte) {
+	for _, c := range p {
+		r.s1 += uint32(c) + rollsumCharOffset
+		r.s2 += r.s1
+	}
+	r.n += uint32(len(p))
+}
+
+func (r *rollsum) Roll(out, in byte) {
+	r.s1 += uint32(in) - uint32(out)
+	r.s2 += r.s1 - r.n*(uint32(out)+rollsumCharOffset)
+}
+
+func (r *rollsum) RollOut(out byte) {
+	r.s1 -= uint32(out) + rollsumCharOffset
+	r.s2 -= r.n * (uint32(out) + rollsumCharOffset)
+	r.n--
+}
+
+func (r *rollsum) Sum32() uint32 {
+	return r.s2<<16 | r.s1&0xffff
+}
+
+const rabinKarpBase = 16777619
+
+var rabinKarpInverse = func() uint32 {
+	x := uint32(rabinKarpBase)
+	for i := 0; i < 5; i++ {
+		x *= 2 - rabinKarpBase*x
+	}
+	return x
+}()
+
+type rabinKarp struct {
+	h   uint32
+	pow uint32
+}
+
+func (r *rabinKarp) Reset() {
+	r.h, r.pow = 0, 1
+}
+
+func (r *rabinKarp) Write(p []byte) {
+	for _, c := range p {
+		r.h = r.h*rabinKarpBase + uint32(c)
+		r.pow *= rabinKarpBase
+	}
+}
+
+func (r *rabinKarp) Roll(out, in byte) {
+	r.h = r.h*rabinKarpBase + uint32(in) - uint32(out)*r.pow
+}
+
+func (r *rabinKarp) RollOut(out byte) {
+	r.pow *= rabinKarpInverse
+	r.h -= uint32(out) * r.pow
+}
+
+func (r *rabinKarp) Sum32() uint32 {
+	return r.h
+}
+
+var buzhashTable = func() (table [256]uint32) {
+	seed := uint64(0x9e3779b97f4a7c15)
+	for i := range table {
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = uint32(z ^ (z >> 31))
+	}
+	return
+}()
+
+type buzhash struct {
+	h uint32
+	n uint32
+}
+
+func (b *buzhash) Reset() {
+	b.h, b.n = 0, 0
+}
+
+func (b *buzhash) Write(p []byte) {
+	for _, c := range p {
+		b.h = bits.RotateLeft32(b.h, 1) ^ buzhashTable[c]
+	}
+	b.n += uint32(len(p))
+}
+
+func (b *buzhash) Roll(out, in byte) {
+	b.h = bits.RotateLeft32(b.h, 1) ^ bits.RotateLeft32(buzhashTable[out], int(b.n%32)) ^ buzhashTable[in]
+}
+
+func (b *buzhash) RollOut(out byte) {
+	b.n--
+	b.h ^= bits.RotateLeft32(buzhashTable[out], int(b.n%32))
+}
+
+func (b *buzhash) Sum32() uint32 {
+	return b.h
+}
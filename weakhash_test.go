@@ -0,0 +1,109 @@
+package gosync
+
+import (
+	"bytes"
+	"crypto/md5"
+	"math/rand"
+	"testing"
+
+	"github.com/rkcloudchain/gosync/syncpb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var allWeakHashers = []WeakHasher{Adler32, Rollsum, RabinKarp, Buzhash}
+
+func weakSum(h WeakHasher, p []byte) uint32 {
+	rolling := h.New()
+	rolling.Write(p)
+	return rolling.Sum32()
+}
+
+func TestWeakHasherRoll(t *testing.T) {
+	data := make([]byte, 2048)
+	rand.New(rand.NewSource(3)).Read(data)
+
+	for _, h := range allWeakHashers {
+		for _, window := range []int{1, 5, 32, 33, 700} {
+			rolling := h.New()
+			rolling.Write(data[:window])
+
+			for i := 1; i+window <= len(data); i++ {
+				rolling.Roll(data[i-1], data[i+window-1])
+				require.Equal(t, weakSum(h, data[i:i+window]), rolling.Sum32(), "%s window %d offset %d", h.Algorithm(), window, i)
+			}
+
+			for i := len(data) - window + 1; i < len(data); i++ {
+				rolling.RollOut(data[i-1])
+				require.Equal(t, weakSum(h, data[i:]), rolling.Sum32(), "%s roll out at %d", h.Algorithm(), i)
+			}
+		}
+	}
+}
+
+func TestWeakHasherReset(t *testing.T) {
+	for _, h := range allWeakHashers {
+		rolling := h.New()
+		rolling.Write([]byte("hello world"))
+		rolling.Reset()
+		rolling.Write([]byte("hello"))
+		assert.Equal(t, weakSum(h, []byte("hello")), rolling.Sum32(), "%s", h.Algorithm())
+	}
+}
+
+func TestAdler32WeakHasher(t *testing.T) {
+	assert.Equal(t, ComputeWeakHash([]byte("hello world")), weakSum(Adler32, []byte("hello world")))
+}
+
+func TestDeltaUsesSignatureWeakHasher(t *testing.T) {
+	local := []byte("The qwik brown fox jumped 0v3r the lazy")
+	reference := []byte("The quick brown fox jumped over the lazy dog")
+
+	for _, h := range allWeakHashers {
+		signer := &rsync{blockSize: 4, strongHasher: md5.New, weakHasher: h}
+		checksums, err := signer.Sign(bytes.NewReader(local))
+		require.NoError(t, err)
+		assert.Equal(t, h.Algorithm(), checksums.WeakHashAlgorithm)
+
+		r := &rsync{blockSize: 4, strongHasher: md5.New, weakHasher: Adler32, sizeFunc: func() (int64, error) { return int64(len(reference)), nil }, reference: BytesRequester(reference)}
+		patcher, err := r.Delta(bytes.NewReader(reference), checksums)
+		require.NoError(t, err)
+		assert.NotEmpty(t, patcher.Found)
+
+		output := bytes.NewBuffer(nil)
+		require.NoError(t, r.Patch(bytes.NewReader(local), patcher, output))
+		assert.Equal(t, reference, output.Bytes())
+	}
+}
+
+func TestDeltaUnknownWeakHasher(t *testing.T) {
+	r := &rsync{blockSize: 4, strongHasher: md5.New, weakHasher: Adler32, sizeFunc: func() (int64, error) { return 0, nil }}
+	_, err := r.Delta(bytes.NewReader(nil), &syncpb.ChunkChecksums{ConfigBlockSize: 4, WeakHashAlgorithm: syncpb.WeakHashAlgorithm(42)})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Unsupported weak hash algorithm")
+}
+
+func TestCustomWeakHasher(t *testing.T) {
+	local := []byte("The qwik brown fox jumped 0v3r the lazy")
+	reference := []byte("The quick brown fox jumped over the lazy dog")
+
+	custom := &weakHasher{syncpb.WeakHashAlgorithm(42), func() RollingHasher { return &rollsum{} }}
+	r, err := New(&Config{BlockSize: 4, WeakHasher: custom, Requester: BytesRequester(reference), SizeFunc: BytesRequester(reference).Size})
+	require.NoError(t, err)
+
+	checksums, err := r.Sign(bytes.NewReader(local))
+	require.NoError(t, err)
+	assert.Equal(t, syncpb.WeakHashAlgorithm(42), checksums.WeakHashAlgorithm)
+
+	patcher, err := r.Delta(bytes.NewReader(reference), checksums)
+	require.NoError(t, err)
+	assert.NotEmpty(t, patcher.Found)
+
+	output := bytes.NewBuffer(nil)
+	require.NoError(t, r.Patch(bytes.NewReader(local), patcher, output))
+	assert.Equal(t, reference, output.Bytes())
+
+	// Custom hashers cannot take the identifier of a built-in one.
+	_, err = New(&Config{WeakHasher: &weakHasher{syncpb.WeakHashRollsum, func() RollingHasher { return &buzhash{} }}})
+	assert.EqualError(t, err, "Invalid weak hash algorithm 1, reserved for a built-in one")
+}
@@ -0,0 +1,95 @@
+package gosync
+
+import "io"
+
+const windowBufferBlocks = 4
+
+// slidingWindow reads a source sequentially through a buffer and exposes
+// a window of at most blockSize bytes that can be moved forward.
+type slidingWindow struct {
+	source    io.Reader
+	buffer    []byte
+	blockSize int
+	start     int
+	end       int
+	offset    int64
+	eof       bool
+}
+
+func newSlidingWindow(source io.Reader, blockSize int64) *slidingWindow {
+	return &slidingWindow{
+		source:    source,
+		buffer:    make([]byte, windowBufferBlocks*blockSize),
+		blockSize: int(blockSize),
+	}
+}
+
+// Offset returns the position of the window in the source.
+func (w *slidingWindow) Offset() int64 {
+	return w.offset
+}
+
+// Bytes returns the current window. It is shorter than the block size only
+// at the end of the source, and empty once the source is exhausted.
+func (w *slidingWindow) Bytes() []byte {
+	end := w.start + w.blockSize
+	if end > w.end {
+		end = w.end
+	}
+	return w.buffer[w.start:end]
+}
+
+// Advance moves the window forward by n bytes, reading from the source when
+// the buffered data no longer covers a full window.
+func (w *slidingWindow) Advance(n int) error {
+	w.start += n
+	w.offset += int64(n)
+
+	if w.eof {
+		if w.start > w.end {
+			w.offset -= int64(w.start - w.end)
+			w.start = w.end
+		}
+		return nil
+	}
+
+	if w.end-w.start >= w.blockSize {
+		return nil
+	}
+
+	return w.fill()
+}
+
+func (w *slidingWindow) fill() error {
+	if w.start > w.end {
+		skip := int64(w.start - w.end)
+		w.start, w.end = 0, 0
+
+		if n, err := io.CopyN(io.Discard, w.source, skip); err != nil {
+			if err == io.EOF {
+				w.eof = true
+				w.offset -= skip - n
+				return nil
+			}
+			return err
+		}
+	}
+
+	w.end = copy(w.buffer, w.buffer[w.start:w.end])
+	w.start = 0
+
+	for w.end < len(w.buffer) {
+		n, err := w.source.Read(w.buffer[w.end:])
+		w.end += n
+
+		if err == io.EOF {
+			w.eof = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
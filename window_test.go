@@ -0,0 +1,42 @@
+package gosync
+
+import (
+	"bytes"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlidingWindow(t *testing.T) {
+	data := []byte("0123456789abcdefghij")
+	w := newSlidingWindow(iotest.OneByteReader(bytes.NewReader(data)), 3)
+	require.NoError(t, w.Advance(0))
+	assert.Equal(t, []byte("012"), w.Bytes())
+
+	require.NoError(t, w.Advance(1))
+	assert.Equal(t, int64(1), w.Offset())
+	assert.Equal(t, []byte("123"), w.Bytes())
+
+	require.NoError(t, w.Advance(15))
+	assert.Equal(t, []byte("ghi"), w.Bytes())
+
+	require.NoError(t, w.Advance(2))
+	assert.Equal(t, []byte("ij"), w.Bytes())
+
+	require.NoError(t, w.Advance(2))
+	assert.Equal(t, int64(len(data)), w.Offset())
+	assert.Len(t, w.Bytes(), 0)
+
+	require.NoError(t, w.Advance(5))
+	assert.Equal(t, int64(len(data)), w.Offset())
+	assert.Len(t, w.Bytes(), 0)
+}
+
+func TestSlidingWindowError(t *testing.T) {
+	w := newSlidingWindow(iotest.TimeoutReader(bytes.NewReader([]byte("0123456789abcdefghij"))), 4)
+	assert.NoError(t, w.Advance(0))
+	assert.NoError(t, w.Advance(1))
+	assert.Equal(t, iotest.ErrTimeout, w.Advance(12))
+}